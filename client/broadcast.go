@@ -0,0 +1,227 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/client/conn"
+	"github.com/skynetservices/skynet/client/loadbalancer"
+	"github.com/skynetservices/skynet/config"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	QuorumNotReached = errors.New("Quorum not reached")
+	BroadcastFailed  = errors.New("Broadcast failed on every instance")
+)
+
+/*
+client.BroadcastOptions controls how ServiceClient.Broadcast() sends a request to every instance
+*/
+type BroadcastOptions struct {
+	// Quorum is how many instances must respond successfully before Broadcast returns, abandoning
+	// the requests still in flight. 0 waits for every instance.
+	Quorum int
+
+	// Concurrency is the most requests sent at once. 0 sends to every instance at once.
+	Concurrency int
+}
+
+/*
+client.BroadcastResult is the response of a single instance to ServiceClient.Broadcast()
+*/
+type BroadcastResult struct {
+	Service skynet.ServiceInfo
+
+	// Out is a new value of the type pointed to by the out given to Broadcast, filled in if the
+	// request succeeded
+	Out   interface{}
+	Error error
+}
+
+// a request to mux() for the registered instances given to the load balancer
+type balancedInstances chan []skynet.ServiceInfo
+
+// registeredInstances must be called from mux()
+func (c *ServiceClient) registeredInstances() (instances []skynet.ServiceInfo) {
+	for _, s := range c.balanced {
+		if s.Registered {
+			instances = append(instances, s)
+		}
+	}
+
+	sort.Sort(byUUID(instances))
+
+	return
+}
+
+type byUUID []skynet.ServiceInfo
+
+func (s byUUID) Len() int           { return len(s) }
+func (s byUUID) Less(i, j int) bool { return s[i].UUID < s[j].UUID }
+func (s byUUID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+/*
+ServiceClient.Broadcast() sends a request to every registered instance the ServiceClient would
+balance requests between, such as to invalidate caches or collect diagnostics from each instance.
+It returns the result of each instance, ordered by UUID, once every instance has responded or
+opts.Quorum instances have succeeded. Requests that didn't complete have the error
+context.Canceled. out is only used for its type, each result has its own Out.
+
+QuorumNotReached is returned as soon as too many instances have failed for opts.Quorum to be
+reached. Without a quorum BroadcastFailed is returned if no instance succeeded, and callers that
+need every instance to succeed must check the Error of each result. Requests aren't retried, and
+give up with RequestTimeout once the giveup time has passed, or the context error once ctx is done.
+*/
+func (c *ServiceClient) Broadcast(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}, opts BroadcastOptions) (results []BroadcastResult, err error) {
+	reply := make(balancedInstances, 1)
+	select {
+	case c.muxChan <- reply:
+	case <-c.stoppedChan:
+		return nil, ServiceClientClosed
+	}
+
+	instances := <-reply
+
+	if len(instances) == 0 {
+		return nil, loadbalancer.NoInstances
+	}
+
+	if ri == nil {
+		ri = c.NewRequestInfo()
+	} else {
+		r := *ri
+		ri = &r
+	}
+
+	ri.CallID = config.NewUUID()
+
+	tls, err := c.timeouts()
+	if err != nil {
+		return
+	}
+
+	ctx, cancelDeadline := requestContext(ctx, ri, tls.giveup)
+	defer cancelDeadline()
+
+	// requests still in flight are abandoned once we return, and we wait for them to unwind so
+	// that none outlive the broadcast
+	var inFlight sync.WaitGroup
+	defer inFlight.Wait()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results = make([]BroadcastResult, len(instances))
+	for i, s := range instances {
+		results[i] = BroadcastResult{Service: s, Error: context.Canceled}
+	}
+
+	if opts.Quorum > len(instances) {
+		return results, QuorumNotReached
+	}
+
+	type completion struct {
+		i      int
+		result BroadcastResult
+	}
+
+	// buffered so that abandoned requests don't block
+	completions := make(chan completion, len(instances))
+
+	var sem chan bool
+	if opts.Concurrency > 0 {
+		sem = make(chan bool, opts.Concurrency)
+	}
+
+	inFlight.Add(1)
+	go func() {
+		defer inFlight.Done()
+
+		for i, s := range instances {
+			if sem != nil {
+				select {
+				case sem <- true:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			inFlight.Add(1)
+			go func(i int, s skynet.ServiceInfo) {
+				defer inFlight.Done()
+
+				r := BroadcastResult{Service: s}
+				r.Out, r.Error = c.sendTo(ctx, s, ri, fn, in, out)
+
+				if sem != nil {
+					<-sem
+				}
+
+				completions <- completion{i, r}
+			}(i, s)
+		}
+	}()
+
+	successes, remaining := 0, len(instances)
+	for remaining > 0 {
+		select {
+		case cmp := <-completions:
+			remaining--
+			results[cmp.i] = cmp.result
+
+			if cmp.result.Error == nil {
+				successes++
+			}
+
+			if opts.Quorum > 0 && successes >= opts.Quorum {
+				return results, nil
+			}
+
+			if opts.Quorum > 0 && successes+remaining < opts.Quorum {
+				return results, QuorumNotReached
+			}
+
+		case <-ctx.Done():
+			// as ServiceClient.Send() does once the giveup time has passed
+			if conn.IsTimeout(context.Cause(ctx)) {
+				return results, RequestTimeout
+			}
+
+			return results, ctx.Err()
+		}
+	}
+
+	if successes == 0 {
+		return results, BroadcastFailed
+	}
+
+	return
+}
+
+// sendTo sends a request to an instance the load balancer didn't choose
+func (c *ServiceClient) sendTo(ctx context.Context, s skynet.ServiceInfo, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (result interface{}, err error) {
+	if err = c.instanceBreaker(s.UUID).allow(); err != nil {
+		return
+	}
+
+	start := time.Now()
+
+	cn, err := acquire(s)
+	if err != nil {
+		c.recordResult(s, time.Now().Sub(start), err)
+		return
+	}
+
+	defer release(cn)
+
+	result = reflect.New(reflect.Indirect(reflect.ValueOf(out)).Type()).Interface()
+	err = timedOut(ctx, cn.SendContext(ctx, ri, fn, in, result))
+
+	c.recordResult(s, time.Now().Sub(start), err)
+
+	return
+}
@@ -0,0 +1,248 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/client/conn"
+	"github.com/skynetservices/skynet/client/loadbalancer"
+	"github.com/skynetservices/skynet/test"
+	"sync"
+	"testing"
+	"time"
+)
+
+// returns a ServiceClient knowing of the given registered instances, each responding with its UUID
+// or the result of f if it isn't nil
+func broadcastServiceClient(uuids []string, f func(ctx context.Context, uuid string) error) *ServiceClient {
+	criteria := &skynet.Criteria{Services: []skynet.ServiceCriteria{
+		skynet.ServiceCriteria{Name: "TestService"},
+	}}
+
+	sc := NewServiceClient(criteria).(*ServiceClient)
+	sc.loadBalancer = &test.LoadBalancer{}
+
+	for _, uuid := range uuids {
+		sc.handleInstanceNotification(skynet.InstanceNotification{
+			Type:    skynet.InstanceAdded,
+			Service: skynet.ServiceInfo{UUID: uuid, Name: "TestService", Registered: true},
+		})
+	}
+
+	pool = &test.Pool{
+		AcquireFunc: func(s skynet.ServiceInfo) (conn.Connection, error) {
+			return &test.Connection{
+				SendContextFunc: func(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+					if f != nil {
+						if err = f(ctx, s.UUID); err != nil {
+							return
+						}
+					}
+
+					*out.(*string) = s.UUID
+					return
+				},
+			}, nil
+		},
+	}
+
+	return sc
+}
+
+func TestBroadcast(t *testing.T) {
+	failed := errors.New("failed")
+
+	sc := broadcastServiceClient([]string{"3", "1", "2"}, func(ctx context.Context, uuid string) error {
+		if uuid == "2" {
+			return failed
+		}
+
+		return nil
+	})
+
+	// unregistered instances aren't sent the request
+	sc.handleInstanceNotification(skynet.InstanceNotification{
+		Type:    skynet.InstanceAdded,
+		Service: skynet.ServiceInfo{UUID: "4", Name: "TestService"},
+	})
+
+	var out string
+	results, err := sc.Broadcast(context.Background(), nil, "Invalidate", "", &out, BroadcastOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 3 {
+		t.Fatal("Unexpected number of results", results)
+	}
+
+	for i, uuid := range []string{"1", "2", "3"} {
+		r := results[i]
+
+		if r.Service.UUID != uuid {
+			t.Fatal("Results not ordered by UUID", r.Service.UUID)
+		}
+
+		if uuid == "2" {
+			if r.Error != failed {
+				t.Fatal("Expected error of failed instance", r.Error)
+			}
+
+			continue
+		}
+
+		if r.Error != nil || *r.Out.(*string) != uuid {
+			t.Fatal("Unexpected result", r.Service.UUID, r.Error)
+		}
+	}
+}
+
+func TestBroadcastNoInstances(t *testing.T) {
+	sc := broadcastServiceClient(nil, nil)
+
+	var out string
+	if _, err := sc.Broadcast(context.Background(), nil, "Invalidate", "", &out, BroadcastOptions{}); err != loadbalancer.NoInstances {
+		t.Fatal("Expected NoInstances", err)
+	}
+}
+
+func TestBroadcastEveryInstanceFailed(t *testing.T) {
+	failed := errors.New("failed")
+
+	sc := broadcastServiceClient([]string{"1", "2"}, func(ctx context.Context, uuid string) error {
+		return failed
+	})
+
+	var out string
+	results, err := sc.Broadcast(context.Background(), nil, "Invalidate", "", &out, BroadcastOptions{})
+	if err != BroadcastFailed {
+		t.Fatal("Expected BroadcastFailed", err)
+	}
+
+	for _, r := range results {
+		if r.Error != failed {
+			t.Fatal("Expected error of failed instance", r.Service.UUID, r.Error)
+		}
+	}
+}
+
+func TestBroadcastClosed(t *testing.T) {
+	sc := broadcastServiceClient([]string{"1"}, nil)
+	sc.Close()
+
+	var out string
+	if _, err := sc.Broadcast(context.Background(), nil, "Invalidate", "", &out, BroadcastOptions{}); err != ServiceClientClosed {
+		t.Fatal("Expected ServiceClientClosed", err)
+	}
+}
+
+func TestBroadcastGiveup(t *testing.T) {
+	sc := broadcastServiceClient([]string{"1"}, func(ctx context.Context, uuid string) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	sc.SetDefaultTimeout(0, 10*time.Millisecond)
+
+	var out string
+	if _, err := sc.Broadcast(context.Background(), nil, "Invalidate", "", &out, BroadcastOptions{}); err != RequestTimeout {
+		t.Fatal("Expected RequestTimeout, as returned by Send", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	sc.SetDefaultTimeout(0, time.Minute)
+
+	if _, err := sc.Broadcast(ctx, nil, "Invalidate", "", &out, BroadcastOptions{}); err != context.DeadlineExceeded {
+		t.Fatal("Expected the context error", err)
+	}
+}
+
+func TestBroadcastQuorum(t *testing.T) {
+	abandoned := make(chan bool, 1)
+
+	sc := broadcastServiceClient([]string{"1", "2", "3"}, func(ctx context.Context, uuid string) error {
+		if uuid == "3" {
+			<-ctx.Done()
+			abandoned <- true
+
+			return ctx.Err()
+		}
+
+		return nil
+	})
+
+	var out string
+	results, err := sc.Broadcast(context.Background(), nil, "Invalidate", "", &out, BroadcastOptions{Quorum: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results[0].Error != nil || results[1].Error != nil || results[2].Error != context.Canceled {
+		t.Fatal("Unexpected results", results)
+	}
+
+	select {
+	case <-abandoned:
+	case <-time.After(time.Second):
+		t.Fatal("Request in flight once quorum was reached not abandoned")
+	}
+}
+
+func TestBroadcastQuorumNotReached(t *testing.T) {
+	sc := broadcastServiceClient([]string{"1", "2", "3"}, func(ctx context.Context, uuid string) error {
+		if uuid != "1" {
+			return errors.New("failed")
+		}
+
+		return nil
+	})
+
+	var out string
+	if _, err := sc.Broadcast(context.Background(), nil, "Invalidate", "", &out, BroadcastOptions{Quorum: 2}); err != QuorumNotReached {
+		t.Fatal("Expected QuorumNotReached", err)
+	}
+
+	if _, err := sc.Broadcast(context.Background(), nil, "Invalidate", "", &out, BroadcastOptions{Quorum: 4}); err != QuorumNotReached {
+		t.Fatal("Expected QuorumNotReached with quorum larger than instances", err)
+	}
+}
+
+func TestBroadcastConcurrency(t *testing.T) {
+	var mutex sync.Mutex
+	inFlight, most := 0, 0
+
+	sc := broadcastServiceClient([]string{"1", "2", "3", "4", "5"}, func(ctx context.Context, uuid string) error {
+		mutex.Lock()
+		inFlight++
+		if inFlight > most {
+			most = inFlight
+		}
+		mutex.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mutex.Lock()
+		inFlight--
+		mutex.Unlock()
+
+		return nil
+	})
+
+	var out string
+	results, err := sc.Broadcast(context.Background(), nil, "Invalidate", "", &out, BroadcastOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range results {
+		if r.Error != nil {
+			t.Fatal("Unexpected error", r.Service.UUID, r.Error)
+		}
+	}
+
+	if most > 2 {
+		t.Fatal("More requests in flight than allowed", most)
+	}
+}
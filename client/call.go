@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"github.com/skynetservices/skynet"
+	"reflect"
+)
+
+/*
+client.Call is a request sent asynchronously by client.Go(). Done is closed once the request
+completes, after which Error is the result of the request and Out has been filled in if it
+succeeded. Error and Out must not be used before Done is closed.
+*/
+type Call struct {
+	Method string
+	In     interface{}
+	Out    interface{}
+	Error  error
+	Done   chan bool
+
+	cancel context.CancelFunc
+}
+
+/*
+client.Go() sends a request with sc.SendContext() without waiting for it to complete, so that
+requests to several services may be in flight at once
+*/
+func Go(ctx context.Context, sc ServiceClientProvider, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) *Call {
+	ctx, cancel := context.WithCancel(ctx)
+
+	call := &Call{
+		Method: fn,
+		In:     in,
+		Out:    out,
+		Done:   make(chan bool),
+		cancel: cancel,
+	}
+
+	go func() {
+		call.Error = sc.SendContext(ctx, ri, fn, in, out)
+		cancel()
+
+		close(call.Done)
+	}()
+
+	return call
+}
+
+/*
+ServiceClient.Go() sends a request without waiting for it to complete, see client.Go()
+*/
+func (c *ServiceClient) Go(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) *Call {
+	return Go(ctx, c, ri, fn, in, out)
+}
+
+/*
+Call.Cancel() abandons the request, which completes with context.Canceled unless it already
+completed
+*/
+func (call *Call) Cancel() {
+	call.cancel()
+}
+
+/*
+Call.Wait() waits for the request to complete and returns its error
+*/
+func (call *Call) Wait() error {
+	<-call.Done
+	return call.Error
+}
+
+/*
+client.WaitAll() waits for every call to complete, and returns the error of the first call
+in the list that failed
+*/
+func WaitAll(calls ...*Call) (err error) {
+	for _, call := range calls {
+		if cerr := call.Wait(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return
+}
+
+/*
+client.WaitAny() waits for any of the calls to complete and returns it, or nil if there are
+no calls
+*/
+func WaitAny(calls ...*Call) *Call {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	cases := make([]reflect.SelectCase, len(calls))
+	for i, call := range calls {
+		cases[i] = reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(call.Done),
+		}
+	}
+
+	chosen, _, _ := reflect.Select(cases)
+
+	return calls[chosen]
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/test"
+	"testing"
+	"time"
+)
+
+// a ServiceClient that responds to each method after the given delay, with its name or error
+func delayedServiceClient(delays map[string]time.Duration, errs map[string]error) ServiceClientProvider {
+	return &test.ServiceClient{
+		SendContextFunc: func(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+			select {
+			case <-time.After(delays[fn]):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			if errs[fn] != nil {
+				return errs[fn]
+			}
+
+			*out.(*string) = fn
+			return
+		},
+	}
+}
+
+func TestGo(t *testing.T) {
+	sc := delayedServiceClient(map[string]time.Duration{"Foo": time.Millisecond}, nil)
+
+	var out string
+	call := Go(context.Background(), sc, nil, "Foo", "", &out)
+
+	select {
+	case <-call.Done:
+	case <-time.After(time.Second):
+		t.Fatal("Call did not complete")
+	}
+
+	if call.Error != nil || out != "Foo" || call.Out != &out {
+		t.Fatal("Unexpected result of call", call.Error, out)
+	}
+}
+
+func TestCallCancel(t *testing.T) {
+	sc := delayedServiceClient(map[string]time.Duration{"Foo": time.Minute}, nil)
+
+	var out string
+	call := Go(context.Background(), sc, nil, "Foo", "", &out)
+	call.Cancel()
+
+	if err := call.Wait(); err != context.Canceled {
+		t.Fatal("Expected context.Canceled", err)
+	}
+}
+
+func TestWaitAll(t *testing.T) {
+	failed := errors.New("failed")
+	sc := delayedServiceClient(map[string]time.Duration{
+		"Foo": 5 * time.Millisecond,
+		"Bar": time.Millisecond,
+		"Baz": 10 * time.Millisecond,
+	}, map[string]error{
+		"Baz": failed,
+	})
+
+	var foo, bar, baz string
+	calls := []*Call{
+		Go(context.Background(), sc, nil, "Foo", "", &foo),
+		Go(context.Background(), sc, nil, "Bar", "", &bar),
+		Go(context.Background(), sc, nil, "Baz", "", &baz),
+	}
+
+	if err := WaitAll(calls...); err != failed {
+		t.Fatal("Expected the error of the failed call", err)
+	}
+
+	if foo != "Foo" || bar != "Bar" {
+		t.Fatal("WaitAll returned before every call completed", foo, bar)
+	}
+}
+
+func TestWaitAny(t *testing.T) {
+	sc := delayedServiceClient(map[string]time.Duration{
+		"Foo": time.Minute,
+		"Bar": time.Millisecond,
+	}, nil)
+
+	var foo, bar string
+	slow := Go(context.Background(), sc, nil, "Foo", "", &foo)
+	fast := Go(context.Background(), sc, nil, "Bar", "", &bar)
+	defer slow.Cancel()
+
+	if call := WaitAny(slow, fast); call != fast {
+		t.Fatal("WaitAny did not return the first call to complete", call.Method)
+	}
+
+	if WaitAny() != nil {
+		t.Fatal("WaitAny without calls returned a call")
+	}
+}
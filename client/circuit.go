@@ -0,0 +1,202 @@
+package client
+
+import (
+	"github.com/skynetservices/skynet/config"
+	"github.com/skynetservices/skynet/log"
+	"github.com/skynetservices/skynet/stats"
+	"sync"
+	"time"
+)
+
+type BreakerState int
+
+const (
+	// requests are sent
+	BreakerClosed BreakerState = iota
+	// requests fail immediately with CircuitOpen
+	BreakerOpen
+	// a limited number of requests are sent to test whether the service has recovered
+	BreakerHalfOpen
+)
+
+func (cs BreakerState) String() string {
+	switch cs {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+// how a request went, as far as the health of the instance or service is concerned
+type requestOutcome int
+
+const (
+	requestSucceeded requestOutcome = iota
+	requestFailed
+	// the caller gave up on the request, which says nothing about the instance or service
+	requestAbandoned
+)
+
+type circuitConfig struct {
+	threshold int
+	timeout   time.Duration
+	halfOpen  int
+}
+
+func getCircuitConfig(service, version string) (cc circuitConfig) {
+	cc = circuitConfig{
+		threshold: config.DefaultCircuitThreshold,
+		timeout:   config.DefaultCircuitTimeout,
+		halfOpen:  config.DefaultCircuitHalfOpenRequests,
+	}
+
+	if n, err := config.Int(service, version, "client.circuit.threshold"); err == nil {
+		cc.threshold = n
+	}
+
+	if d, err := config.Duration(service, version, "client.circuit.timeout"); err == nil {
+		cc.timeout = d
+	}
+
+	if n, err := config.Int(service, version, "client.circuit.halfopen"); err == nil && n > 0 {
+		cc.halfOpen = n
+	}
+
+	return
+}
+
+/*
+circuitBreaker stops requests being sent after threshold consecutive failures. Once timeout has
+passed, up to halfOpen requests are let through, and the circuit closes again if they succeed.
+*/
+type circuitBreaker struct {
+	config circuitConfig
+
+	// the service, and instance if the breaker is for a single instance, reported on changes
+	service  string
+	instance string
+
+	mutex    sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+
+	// requests let through while half-open that haven't completed
+	probes int
+
+	// replaced in tests
+	now func() time.Time
+}
+
+func newCircuitBreaker(cc circuitConfig, service, instance string) *circuitBreaker {
+	return &circuitBreaker{
+		config:   cc,
+		service:  service,
+		instance: instance,
+		now:      time.Now,
+	}
+}
+
+/*
+circuitBreaker.allow() returns CircuitOpen if a request may not be sent. Every request that is
+allowed must be followed by a call to circuitBreaker.record()
+*/
+func (cb *circuitBreaker) allow() error {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	// a threshold of 0 disables the breaker
+	if cb.config.threshold <= 0 {
+		return nil
+	}
+
+	if cb.state == BreakerOpen && cb.now().Sub(cb.openedAt) >= cb.config.timeout {
+		cb.setState(BreakerHalfOpen)
+	}
+
+	switch cb.state {
+	case BreakerOpen:
+		return CircuitOpen
+	case BreakerHalfOpen:
+		if cb.probes >= cb.config.halfOpen {
+			return CircuitOpen
+		}
+
+		cb.probes++
+	}
+
+	return nil
+}
+
+func (cb *circuitBreaker) record(o requestOutcome) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.config.threshold <= 0 {
+		return
+	}
+
+	switch cb.state {
+	case BreakerClosed:
+		switch o {
+		case requestSucceeded:
+			cb.failures = 0
+		case requestFailed:
+			cb.failures++
+			if cb.failures >= cb.config.threshold {
+				cb.open()
+			}
+		}
+	case BreakerHalfOpen:
+		// an abandoned probe only frees its place for another
+		if cb.probes > 0 {
+			cb.probes--
+		}
+
+		switch o {
+		case requestFailed:
+			cb.open()
+		case requestSucceeded:
+			if cb.probes == 0 {
+				cb.failures = 0
+				cb.setState(BreakerClosed)
+			}
+		}
+	}
+}
+
+// open must be called with mutex held
+func (cb *circuitBreaker) open() {
+	cb.openedAt = cb.now()
+	cb.probes = 0
+	cb.setState(BreakerOpen)
+}
+
+// setState must be called with mutex held
+func (cb *circuitBreaker) setState(state BreakerState) {
+	if cb.state == state {
+		return
+	}
+
+	cb.state = state
+
+	if state == BreakerOpen {
+		log.Printf(log.WARN, "%+v", CircuitChanged{cb.service, cb.instance, state})
+	} else {
+		log.Printf(log.INFO, "%+v", CircuitChanged{cb.service, cb.instance, state})
+	}
+
+	stats.CircuitChanged(cb.service, cb.instance, state.String())
+}
+
+func (cb *circuitBreaker) currentState() BreakerState {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	return cb.state
+}
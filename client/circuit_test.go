@@ -0,0 +1,221 @@
+package client
+
+import (
+	"errors"
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/client/loadbalancer"
+	"github.com/skynetservices/skynet/test"
+	"testing"
+	"time"
+)
+
+func testCircuitBreaker() (*circuitBreaker, *test.Clock) {
+	clock := test.NewClock()
+
+	cb := newCircuitBreaker(circuitConfig{
+		threshold: 3,
+		timeout:   time.Second,
+		halfOpen:  2,
+	}, "foo:1.0.0", "")
+	cb.now = clock.Now
+
+	return cb, clock
+}
+
+func TestCircuitOpensAfterConsecutiveFailures(t *testing.T) {
+	cb, _ := testCircuitBreaker()
+
+	cb.record(requestFailed)
+	cb.record(requestFailed)
+	cb.record(requestSucceeded)
+	cb.record(requestFailed)
+	cb.record(requestFailed)
+
+	if cb.currentState() != BreakerClosed || cb.allow() != nil {
+		t.Fatal("Circuit opened before too many consecutive failures")
+	}
+
+	cb.record(requestFailed)
+
+	if cb.currentState() != BreakerOpen {
+		t.Fatal("Circuit not opened after consecutive failures", cb.currentState())
+	}
+
+	if cb.allow() != CircuitOpen {
+		t.Fatal("Open circuit allowed a request")
+	}
+}
+
+func TestCircuitHalfOpenCloses(t *testing.T) {
+	cb, clock := testCircuitBreaker()
+
+	for i := 0; i < 3; i++ {
+		cb.record(requestFailed)
+	}
+
+	clock.Advance(time.Second)
+
+	if cb.allow() != nil || cb.allow() != nil {
+		t.Fatal("Half-open circuit refused probes")
+	}
+
+	if cb.currentState() != BreakerHalfOpen {
+		t.Fatal("Circuit not half-open after timeout", cb.currentState())
+	}
+
+	if cb.allow() != CircuitOpen {
+		t.Fatal("Half-open circuit allowed more than halfOpen probes")
+	}
+
+	cb.record(requestSucceeded)
+
+	if cb.currentState() != BreakerHalfOpen {
+		t.Fatal("Circuit closed before every probe succeeded")
+	}
+
+	cb.record(requestSucceeded)
+
+	if cb.currentState() != BreakerClosed {
+		t.Fatal("Circuit not closed after probes succeeded", cb.currentState())
+	}
+}
+
+func TestCircuitHalfOpenReopens(t *testing.T) {
+	cb, clock := testCircuitBreaker()
+
+	for i := 0; i < 3; i++ {
+		cb.record(requestFailed)
+	}
+
+	clock.Advance(time.Second)
+
+	cb.allow()
+	cb.record(requestFailed)
+
+	if cb.currentState() != BreakerOpen {
+		t.Fatal("Circuit not reopened after a probe failed", cb.currentState())
+	}
+
+	clock.Advance(time.Second / 2)
+
+	if cb.allow() != CircuitOpen {
+		t.Fatal("Reopened circuit allowed a request before timeout")
+	}
+}
+
+func TestCircuitAbandonedProbe(t *testing.T) {
+	cb, clock := testCircuitBreaker()
+
+	for i := 0; i < 3; i++ {
+		cb.record(requestFailed)
+	}
+
+	clock.Advance(time.Second)
+
+	cb.allow()
+	cb.allow()
+	cb.record(requestAbandoned)
+
+	if cb.currentState() != BreakerHalfOpen {
+		t.Fatal("Abandoned probe changed the circuit's state", cb.currentState())
+	}
+
+	if cb.allow() != nil {
+		t.Fatal("Abandoned probe didn't free its place for another")
+	}
+}
+
+func TestCircuitAbandonedWhileClosed(t *testing.T) {
+	cb, _ := testCircuitBreaker()
+
+	cb.record(requestFailed)
+	cb.record(requestFailed)
+	cb.record(requestAbandoned)
+	cb.record(requestFailed)
+
+	if cb.currentState() != BreakerOpen {
+		t.Fatal("Abandoned request reset consecutive failures", cb.currentState())
+	}
+}
+
+func TestCircuitDisabled(t *testing.T) {
+	cb, _ := testCircuitBreaker()
+	cb.config.threshold = 0
+
+	for i := 0; i < 10; i++ {
+		cb.record(requestFailed)
+	}
+
+	if cb.allow() != nil {
+		t.Fatal("Disabled circuit refused a request")
+	}
+}
+
+func TestSendCircuitOpen(t *testing.T) {
+	sc := GetService("foo", "1.0.0", "", "")
+
+	sent := 0
+	stubForSend(sc, func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+		sent++
+		return errors.New("failed")
+	})
+
+	c := sc.(*ServiceClient)
+	c.breaker.config.threshold = 2
+
+	var response string
+	for i := 0; i < 2; i++ {
+		sc.SendOnce(nil, "bar", "", &response)
+	}
+
+	if err := sc.SendOnce(nil, "bar", "", &response); err != CircuitOpen {
+		t.Fatal("Expected CircuitOpen", err)
+	}
+
+	if sent != 2 {
+		t.Fatal("Request sent while circuit open", sent)
+	}
+
+	service, _ := c.CircuitStates()
+	if service != BreakerOpen {
+		t.Fatal("Unexpected service circuit state", service)
+	}
+}
+
+func TestSendSkipsOpenInstances(t *testing.T) {
+	sc := GetService("foo", "1.0.0", "", "")
+	stubForSend(sc, func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+		return
+	})
+
+	c := sc.(*ServiceClient)
+	cb := c.instanceBreaker("")
+	cb.mutex.Lock()
+	cb.open()
+	cb.mutex.Unlock()
+
+	completed := make(chan error, maxChoices)
+	c.loadBalancer.(*test.LoadBalancer).CompleteFunc = func(s skynet.ServiceInfo, duration time.Duration, err error) {
+		completed <- err
+	}
+
+	var response string
+	if err := sc.SendOnce(nil, "bar", "", &response); err != CircuitOpen {
+		t.Fatal("Expected CircuitOpen when every instance's circuit is open", err)
+	}
+
+	if len(completed) != maxChoices {
+		t.Fatal("Instances chosen not completed", len(completed))
+	}
+
+	for len(completed) > 0 {
+		if err := <-completed; err != loadbalancer.NotSent {
+			t.Fatal("Request to an instance whose circuit is open not completed as unsent", err)
+		}
+	}
+
+	_, instances := c.CircuitStates()
+	if instances[""] != BreakerOpen {
+		t.Fatal("Unexpected instance circuit state", instances[""])
+	}
+}
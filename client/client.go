@@ -20,14 +20,21 @@ func init() {
 	go mux()
 }
 
-// TODO: implement a way to report/remove instances that fail a number of times
 var (
 	network        = "tcp"
 	knownNetworks  = []string{"tcp", "tcp4", "tcp6", "udp", "udp4", "udp6", "ip", "ip4", "ip6", "unix", "unixgram", "unixpacket"}
 	serviceClients = []ServiceClientProvider{}
+	subscriptions  = map[ServiceClientProvider]skynet.Subscription{}
+
+	// instances known to the pool, by UUID
+	knownInstances = map[string]skynet.ServiceInfo{}
+
+	// protects serviceClients, subscriptions and knownInstances
+	serviceClientsMutex sync.Mutex
 
 	closeChan       = make(chan bool, 1)
 	instanceWatcher = make(chan skynet.InstanceNotification, 100)
+	muxStopChan     = make(chan chan bool)
 
 	pool                ConnectionPooler     = NewPool()
 	LoadBalancerFactory loadbalancer.Factory = roundrobin.New
@@ -71,7 +78,7 @@ func SetLoadBalancerFactory(factory loadbalancer.Factory) {
 client.GetServiceFromCriteria() Returns a client specific to the skynet.Criteria provided.
 Only instances that match this criteria will service the requests.
 
-The core reason to use this over GetService() is that the load balancer will use the order of the criteria items to determine which datacenter it should roll over to first etc.
+The core reason to use this over GetService() is that load balancers such as failover will use the order of the criteria items to determine which datacenter it should roll over to first etc.
 */
 func GetServiceFromCriteria(c *skynet.Criteria) ServiceClientProvider {
 	sc := NewServiceClient(c)
@@ -124,13 +131,26 @@ func mux() {
 		case n := <-instanceWatcher:
 			updateInstance(n)
 		case <-closeChan:
-			for _, sc := range serviceClients {
+			serviceClientsMutex.Lock()
+			clients, subs := serviceClients, subscriptions
+			serviceClients = []ServiceClientProvider{}
+			subscriptions = map[ServiceClientProvider]skynet.Subscription{}
+			knownInstances = map[string]skynet.ServiceInfo{}
+			serviceClientsMutex.Unlock()
+
+			for _, sub := range subs {
+				closeSubscription(sub)
+			}
+
+			for _, sc := range clients {
 				sc.Close()
 			}
 
 			pool.Close()
-			serviceClients = []ServiceClientProvider{}
 			waiter.Done()
+		case stopped := <-muxStopChan:
+			close(stopped)
+			return
 		}
 	}
 }
@@ -151,9 +171,19 @@ func release(c conn.Connection) {
 }
 
 func addServiceClient(sc ServiceClientProvider) {
+	serviceClientsMutex.Lock()
 	serviceClients = append(serviceClients, sc)
+	serviceClientsMutex.Unlock()
+
+	// Don't hold the lock while watching, the ServiceManager may be blocked delivering to mux()
+	instances, sub := skynet.GetServiceManager().Watch(sc, instanceWatcher)
 
-	instances := skynet.GetServiceManager().Watch(sc, instanceWatcher)
+	serviceClientsMutex.Lock()
+	subscriptions[sc] = sub
+	for _, i := range instances {
+		knownInstances[i.UUID] = i
+	}
+	serviceClientsMutex.Unlock()
 
 	for _, i := range instances {
 		pool.AddInstance(i)
@@ -161,19 +191,100 @@ func addServiceClient(sc ServiceClientProvider) {
 	}
 }
 
-// TODO: we need a method here to removeServiceClient
-// it should remove instances from the pool if there are no remaining
-// ServiceClients that match the instance, and should end the watch from ServiceManager
+/*
+client.removeServiceClient ends the ServiceManager watch for a ServiceClient, and removes
+instances from the pool that no remaining ServiceClient matches
+*/
+func removeServiceClient(sc ServiceClientProvider) {
+	serviceClientsMutex.Lock()
+
+	found := false
+	for i, c := range serviceClients {
+		if c == sc {
+			serviceClients = append(serviceClients[:i], serviceClients[i+1:]...)
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		serviceClientsMutex.Unlock()
+		return
+	}
+
+	sub := subscriptions[sc]
+	delete(subscriptions, sc)
+
+	var orphaned []skynet.ServiceInfo
+	for uuid, s := range knownInstances {
+		if !matchesServiceClient(s) {
+			orphaned = append(orphaned, s)
+			delete(knownInstances, uuid)
+		}
+	}
+
+	serviceClientsMutex.Unlock()
+
+	closeSubscription(sub)
+
+	for _, s := range orphaned {
+		pool.RemoveInstance(s)
+	}
+}
+
+// must be called with serviceClientsMutex held
+func matchesServiceClient(s skynet.ServiceInfo) bool {
+	for _, sc := range serviceClients {
+		if sc.Matches(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func closeSubscription(sub skynet.Subscription) {
+	if sub == nil {
+		return
+	}
+
+	if err := sub.Close(); err != nil {
+		log.Println(log.ERROR, "Failed to close watch", err)
+	}
+}
+
+// stopMux stops mux() once it has finished with the current notification
+func stopMux() {
+	stopped := make(chan bool)
+	muxStopChan <- stopped
+	<-stopped
+}
 
 // only call from mux()
 func updateInstance(n skynet.InstanceNotification) {
-	// Forward notification on to ServiceClients that match
+	serviceClientsMutex.Lock()
+
+	var matching []ServiceClientProvider
 	for _, sc := range serviceClients {
 		if sc.Matches(n.Service) {
-			go sc.Notify(n)
+			matching = append(matching, sc)
 		}
 	}
 
+	switch n.Type {
+	case skynet.InstanceAdded, skynet.InstanceUpdated:
+		knownInstances[n.Service.UUID] = n.Service
+	case skynet.InstanceRemoved:
+		delete(knownInstances, n.Service.UUID)
+	}
+
+	serviceClientsMutex.Unlock()
+
+	// Don't hold the lock while forwarding, a ServiceClient that is busy would block GetService()
+	for _, sc := range matching {
+		sc.Notify(n)
+	}
+
 	// Update our internal pools
 	switch n.Type {
 	case skynet.InstanceAdded:
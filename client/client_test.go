@@ -189,6 +189,74 @@ func TestInstanceNotificationsUpdatePool(t *testing.T) {
 	}
 }
 
+func TestRemoveServiceClient(t *testing.T) {
+	defer resetClient()
+
+	si := serviceInfo()
+	si.UUID = "FOO"
+
+	closed := false
+	removed := make(chan skynet.ServiceInfo, 1)
+
+	skynet.SetServiceManager(&test.ServiceManager{
+		WatchFunc: func(criteria skynet.CriteriaMatcher, c chan<- skynet.InstanceNotification) ([]skynet.ServiceInfo, skynet.Subscription) {
+			return []skynet.ServiceInfo{*si}, skynet.SubscriptionFunc(func() error {
+				closed = true
+				return nil
+			})
+		},
+	})
+	defer skynet.SetServiceManager(serviceManager)
+
+	pool = &test.Pool{
+		RemoveInstanceFunc: func(s skynet.ServiceInfo) {
+			removed <- s
+		},
+	}
+
+	matchAll := func(s skynet.ServiceInfo) bool {
+		return true
+	}
+
+	sc1 := &test.ServiceClient{MatchesFunc: matchAll}
+	sc2 := &test.ServiceClient{MatchesFunc: matchAll}
+
+	addServiceClient(sc1)
+	addServiceClient(sc2)
+
+	// sc2 still matches the instance, it must stay in the pool
+	removeServiceClient(sc1)
+
+	if !closed {
+		t.Fatal("removeServiceClient() did not close the watch")
+	}
+
+	if len(serviceClients) != 1 || serviceClients[0] != sc2 {
+		t.Fatal("removeServiceClient() did not remove ServiceClient", serviceClients)
+	}
+
+	select {
+	case <-removed:
+		t.Fatal("removeServiceClient() removed instance still matched by another ServiceClient")
+	default:
+	}
+
+	removeServiceClient(sc2)
+
+	if len(serviceClients) != 0 {
+		t.Fatal("removeServiceClient() did not remove ServiceClient", serviceClients)
+	}
+
+	select {
+	case s := <-removed:
+		if s.UUID != si.UUID {
+			t.Fatal("removeServiceClient() removed incorrect instance")
+		}
+	default:
+		t.Fatal("removeServiceClient() did not remove unmatched instance from pool")
+	}
+}
+
 func serviceInfo() *skynet.ServiceInfo {
 	si := skynet.NewServiceInfo("TestService", "1.0.0")
 	si.Registered = true
@@ -197,13 +265,20 @@ func serviceInfo() *skynet.ServiceInfo {
 }
 
 func resetClient() {
+	// mux() reads the globals being reset
+	stopMux()
+
 	serviceClients = []ServiceClientProvider{}
+	subscriptions = map[ServiceClientProvider]skynet.Subscription{}
+	knownInstances = map[string]skynet.ServiceInfo{}
 
 	network = "tcp"
 	knownNetworks = []string{"tcp", "tcp4", "tcp6", "udp", "udp4", "udp6", "ip", "ip4", "ip6", "unix", "unixgram", "unixpacket"}
 
 	pool = NewPool()
 	LoadBalancerFactory = roundrobin.New
+
+	go mux()
 }
 
 func sendInstanceNotification(typ int, si skynet.ServiceInfo) {
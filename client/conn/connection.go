@@ -1,6 +1,7 @@
 package conn
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/kr/pretty"
@@ -31,6 +32,34 @@ func (se serviceError) Error() string {
 	return se.msg
 }
 
+/*
+conn.TimeoutError is returned by Conn.SendTimeout() when no response is received in time
+*/
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (te TimeoutError) Error() string {
+	return fmt.Sprintf("Connection: timing out request after %s", te.Timeout.String())
+}
+
+/*
+conn.IsServiceError() returns true if err was returned by the service, rather than being a
+failure to reach it or receive its response
+*/
+func IsServiceError(err error) bool {
+	_, ok := err.(serviceError)
+	return ok
+}
+
+/*
+conn.IsTimeout() returns true if err is a TimeoutError
+*/
+func IsTimeout(err error) bool {
+	_, ok := err.(TimeoutError)
+	return ok
+}
+
 /*
 Connection
 */
@@ -44,6 +73,7 @@ type Connection interface {
 
 	Send(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error)
 	SendTimeout(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}, timeout time.Duration) (err error)
+	SendContext(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error)
 }
 
 /*
@@ -133,10 +163,40 @@ func (c *Conn) Send(ri *skynet.RequestInfo, fn string, in interface{}, out inter
 Conn.SendTimeout() Acts like Send but takes a timeout
 */
 func (c *Conn) SendTimeout(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}, timeout time.Duration) (err error) {
+	return c.send(context.Background(), ri, fn, in, out, timeout)
+}
+
+/*
+Conn.SendContext() Acts like Send but gives up, returning ctx.Err(), once ctx is done. The deadline
+of ctx is sent to the service in RequestInfo.Deadline
+*/
+func (c *Conn) SendContext(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		// don't modify the caller's RequestInfo, it may be in use by other attempts of the request
+		r := skynet.RequestInfo{}
+		if ri != nil {
+			r = *ri
+		}
+
+		if r.Deadline.IsZero() || deadline.Before(r.Deadline) {
+			r.Deadline = deadline
+		}
+
+		ri = &r
+	}
+
+	return c.send(ctx, ri, fn, in, out, 0)
+}
+
+func (c *Conn) send(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}, timeout time.Duration) (err error) {
 	if c.IsClosed() {
 		return ConnectionClosed
 	}
 
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
 	sin := skynet.ServiceRPCInWrite{
 		RequestInfo: ri,
 		Method:      fn,
@@ -159,7 +219,8 @@ func (c *Conn) SendTimeout(ri *skynet.RequestInfo, fn string, in interface{}, ou
 		Err error
 	}
 
-	respChan := make(chan *Resp)
+	// buffered so the call can complete after we've stopped waiting for it
+	respChan := make(chan *Resp, 1)
 
 	go func() {
 		log.Println(log.TRACE, fmt.Sprintf("Sending Method call %s with ClientID %s to: %s", sin.Method, sin.ClientID, c.addr))
@@ -182,12 +243,23 @@ func (c *Conn) SendTimeout(ri *skynet.RequestInfo, fn string, in interface{}, ou
 	select {
 	case r = <-respChan:
 		if r.Err != nil {
-			err = serviceError{r.Err.Error()}
+			// errors from Forward itself, such as an unknown method, come from the service too
+			if _, ok := r.Err.(rpc.ServerError); ok {
+				err = serviceError{r.Err.Error()}
+			} else {
+				err = r.Err
+			}
+
 			c.Close()
 			return
 		}
 	case <-t:
-		err = fmt.Errorf("Connection: timing out request after %s", timeout.String())
+		err = TimeoutError{timeout}
+		c.Close()
+		return
+	case <-ctx.Done():
+		// the response may still arrive, the connection can't be used for anything else
+		err = ctx.Err()
 		c.Close()
 		return
 	}
@@ -1,6 +1,7 @@
 package conn
 
 import (
+	"context"
 	"errors"
 	"github.com/skynetservices/skynet"
 	"github.com/skynetservices/skynet/rpc/bsonrpc"
@@ -15,7 +16,7 @@ import (
 func TestHandshake(t *testing.T) {
 	client, server := net.Pipe()
 
-	go doServiceHandshake(server, true, t)
+	go doServiceHandshake(server, "TestService", true, t)
 
 	cn, err := NewConnectionFromNetConn("TestService", client)
 	c := cn.(*Conn)
@@ -37,7 +38,7 @@ func TestErrorOnUnregistered(t *testing.T) {
 	defer client.Close()
 	defer server.Close()
 
-	go doServiceHandshake(server, false, t)
+	go doServiceHandshake(server, "TestService", false, t)
 
 	_, err := NewConnectionFromNetConn("TestService", client)
 
@@ -57,7 +58,7 @@ func TestDialConn(t *testing.T) {
 	go func() {
 		conn, err := ln.Accept()
 		if err == nil {
-			go doServiceHandshake(conn, true, t)
+			go doServiceHandshake(conn, "TestService", true, t)
 		}
 	}()
 
@@ -91,7 +92,7 @@ func TestSendTimeout(t *testing.T) {
 	go func() {
 		conn, err := ln.Accept()
 		if err == nil {
-			doServiceHandshake(conn, true, t)
+			doServiceHandshake(conn, "TestService", true, t)
 			time.Sleep(10 * time.Millisecond)
 		}
 	}()
@@ -110,9 +111,46 @@ func TestSendTimeout(t *testing.T) {
 	}
 }
 
+func TestSendContextCancelled(t *testing.T) {
+	ln, err := net.Listen("tcp", ":51900")
+	defer ln.Close()
+
+	if err != nil {
+		t.Error("Failed to bind to port for test")
+	}
+
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			doServiceHandshake(conn, "TestService", true, t)
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	c, err := NewConnection("TestService", "tcp", ":51900", 500*time.Millisecond)
+
+	if err != nil {
+		t.Error("Failed to establish connection for test", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Millisecond)
+	defer cancel()
+
+	var tp TestParam
+	err = c.SendContext(ctx, &skynet.RequestInfo{}, "foo", tp, &tp)
+
+	if err != context.DeadlineExceeded {
+		t.Fatal("Expected SendContext to return context.DeadlineExceeded", err)
+	}
+
+	if !c.IsClosed() {
+		t.Fatal("Expected connection to be closed after abandoning request")
+	}
+}
+
 func TestSend(t *testing.T) {
 	client, server := net.Pipe()
-	go doServiceHandshake(server, true, t)
+	go doServiceHandshake(server, "TestRPCService", true, t)
 
 	cn, err := NewConnectionFromNetConn("TestRPCService", client)
 	c := cn.(*Conn)
@@ -128,8 +166,9 @@ func TestSend(t *testing.T) {
 
 	ri := &skynet.RequestInfo{}
 
-	ts.TestMethod = func(in skynet.ServiceRPCIn, out *skynet.ServiceRPCOut) (err error) {
-		out.Out, err = bson.Marshal(&tp)
+	ts.TestMethod = func(in skynet.ServiceRPCInRead, out *skynet.ServiceRPCOutWrite) (err error) {
+		var b []byte
+		b, err = bson.Marshal(&tp)
 
 		var t TestParam
 
@@ -137,6 +176,8 @@ func TestSend(t *testing.T) {
 			return
 		}
 
+		out.Out = bson.Binary{Kind: 0x00, Data: b}
+
 		if in.ClientID != c.clientID {
 			return errors.New("Failed to set ClientID on request")
 		}
@@ -173,7 +214,7 @@ func TestSend(t *testing.T) {
 
 func TestSendOnClosedConnection(t *testing.T) {
 	client, server := net.Pipe()
-	go doServiceHandshake(server, true, t)
+	go doServiceHandshake(server, "TestService", true, t)
 
 	c, err := NewConnectionFromNetConn("TestService", client)
 	c.Close()
@@ -201,10 +242,10 @@ type TestParam struct {
 }
 
 type TestRPCService struct {
-	TestMethod func(in skynet.ServiceRPCIn, out *skynet.ServiceRPCOut) (err error)
+	TestMethod func(in skynet.ServiceRPCInRead, out *skynet.ServiceRPCOutWrite) (err error)
 }
 
-func (ts *TestRPCService) Forward(in skynet.ServiceRPCIn, out *skynet.ServiceRPCOut) (err error) {
+func (ts *TestRPCService) Forward(in skynet.ServiceRPCInRead, out *skynet.ServiceRPCOutWrite) (err error) {
 	if ts.TestMethod != nil {
 		return ts.TestMethod(in, out)
 	}
@@ -218,8 +259,9 @@ func (ts TestRPCService) Foo(in TestParam, out *TestParam) (err error) {
 	return
 }
 
-func doServiceHandshake(server net.Conn, registered bool, t *testing.T) {
+func doServiceHandshake(server net.Conn, name string, registered bool, t *testing.T) {
 	sh := skynet.ServiceHandshake{
+		Name:       name,
 		Registered: registered,
 		ClientID:   "abc",
 	}
@@ -227,13 +269,14 @@ func doServiceHandshake(server net.Conn, registered bool, t *testing.T) {
 	encoder := bsonrpc.NewEncoder(server)
 	err := encoder.Encode(sh)
 	if err != nil {
-		t.Fatal("Failed to encode server handshake", err)
+		t.Error("Failed to encode server handshake", err)
+		return
 	}
 
 	var ch skynet.ClientHandshake
 	decoder := bsonrpc.NewDecoder(server)
 	err = decoder.Decode(&ch)
 	if err != nil {
-		t.Fatal("Error calling bsonrpc.NewDecoder: ", err)
+		t.Error("Error calling bsonrpc.NewDecoder: ", err)
 	}
 }
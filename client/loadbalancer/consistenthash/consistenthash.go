@@ -0,0 +1,142 @@
+/*
+Package consistenthash provides a load balancer that sends requests with the same
+RequestInfo.RoutingKey to the same instance while the registered instances stay the same.
+It uses rendezvous (highest random weight) hashing: each instance is scored by a hash of
+the key and its UUID, and the highest scoring instance is chosen. When an instance is
+added or removed, only the keys it scores highest for move.
+
+	client.SetLoadBalancerFactory(consistenthash.New)
+	...
+	serviceClient.Send(&skynet.RequestInfo{RoutingKey: userID}, "Get", in, &out)
+
+Retries of a request are sent to the next highest scoring instance, and requests without a
+routing key are spread by their RequestID.
+*/
+package consistenthash
+
+import (
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/client/loadbalancer"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+consistenthash.LoadBalancer chooses the registered instance that scores highest for a request's
+routing key
+*/
+type LoadBalancer struct {
+	mutex     sync.Mutex
+	instances map[string]skynet.ServiceInfo
+
+	// used as the key of requests without a RoutingKey or RequestID
+	counter uint64
+}
+
+/*
+* New() returns a new consistent hashing LoadBalancer
+ */
+func New(instances []skynet.ServiceInfo) loadbalancer.LoadBalancer {
+	lb := &LoadBalancer{
+		instances: make(map[string]skynet.ServiceInfo),
+	}
+
+	for _, i := range instances {
+		lb.AddInstance(i)
+	}
+
+	return lb
+}
+
+func (lb *LoadBalancer) AddInstance(s skynet.ServiceInfo) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	lb.instances[s.UUID] = s
+}
+
+func (lb *LoadBalancer) UpdateInstance(s skynet.ServiceInfo) {
+	lb.AddInstance(s)
+}
+
+func (lb *LoadBalancer) RemoveInstance(s skynet.ServiceInfo) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	delete(lb.instances, s.UUID)
+}
+
+type scored struct {
+	score uint64
+	info  skynet.ServiceInfo
+}
+
+type byScore []scored
+
+func (s byScore) Len() int      { return len(s) }
+func (s byScore) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byScore) Less(i, j int) bool {
+	if s[i].score == s[j].score {
+		return s[i].info.UUID < s[j].info.UUID
+	}
+
+	return s[i].score > s[j].score
+}
+
+func (lb *LoadBalancer) Choose(ri *skynet.RequestInfo) (s skynet.ServiceInfo, err error) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	key, retry := "", 0
+	if ri != nil {
+		key, retry = ri.RoutingKey, ri.RetryCount
+
+		if key == "" {
+			key = ri.RequestID
+		}
+	}
+
+	if key == "" {
+		lb.counter++
+		key = strconv.FormatUint(lb.counter, 10)
+	}
+
+	var candidates []scored
+	for _, i := range lb.instances {
+		if i.Registered {
+			candidates = append(candidates, scored{score(key, i.UUID), i})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return s, loadbalancer.NoInstances
+	}
+
+	sort.Sort(byScore(candidates))
+
+	return candidates[retry%len(candidates)].info, nil
+}
+
+// Complete is a no-op, the instance for a key depends only on which instances are registered
+func (lb *LoadBalancer) Complete(s skynet.ServiceInfo, duration time.Duration, err error) {
+}
+
+func score(key, uuid string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write([]byte(uuid))
+
+	// fnv alone doesn't spread similar keys well, finish with the splitmix64 mixer
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+
+	return x
+}
@@ -0,0 +1,141 @@
+package consistenthash
+
+import (
+	"fmt"
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/client/loadbalancer"
+	"testing"
+)
+
+func TestSameKeySameInstance(t *testing.T) {
+	lb := New(instances(5)).(*LoadBalancer)
+
+	for k := 0; k < 100; k++ {
+		ri := &skynet.RequestInfo{RoutingKey: fmt.Sprint("key", k)}
+
+		first, err := lb.Choose(ri)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 3; i++ {
+			if s, _ := lb.Choose(ri); s.UUID != first.UUID {
+				t.Fatal("Key was not routed to the same instance", ri.RoutingKey)
+			}
+		}
+	}
+}
+
+func TestMinimalReshuffling(t *testing.T) {
+	lb := New(instances(5)).(*LoadBalancer)
+
+	before := assignments(lb, 1000)
+
+	lb.AddInstance(serviceInfo("6", true))
+	added := assignments(lb, 1000)
+
+	for k, uuid := range added {
+		if uuid != before[k] && uuid != "6" {
+			t.Fatal("Adding an instance moved a key between other instances", k)
+		}
+	}
+
+	// the new instance should take about a sixth of the keys
+	moved := 0
+	for k := range added {
+		if added[k] != before[k] {
+			moved++
+		}
+	}
+
+	if moved < 100 || moved > 250 {
+		t.Fatal("Unexpected number of keys moved to the new instance", moved)
+	}
+
+	lb.RemoveInstance(serviceInfo("6", true))
+
+	for k, uuid := range assignments(lb, 1000) {
+		if uuid != before[k] {
+			t.Fatal("Removing an instance moved a key it didn't have", k)
+		}
+	}
+
+	// unregistering is the same as removing
+	lb.UpdateInstance(serviceInfo("2", false))
+
+	for k, uuid := range assignments(lb, 1000) {
+		if uuid != before[k] && before[k] != "2" {
+			t.Fatal("Unregistering an instance moved a key it didn't have", k)
+		}
+
+		if uuid == "2" {
+			t.Fatal("Key routed to an unregistered instance", k)
+		}
+	}
+}
+
+func TestRetriesMoveToNextInstance(t *testing.T) {
+	lb := New(instances(3)).(*LoadBalancer)
+
+	ri := &skynet.RequestInfo{RoutingKey: "key"}
+	seen := make(map[string]bool)
+
+	for ri.RetryCount = 0; ri.RetryCount < 3; ri.RetryCount++ {
+		s, _ := lb.Choose(ri)
+		seen[s.UUID] = true
+	}
+
+	if len(seen) != 3 {
+		t.Fatal("Retries were not sent to other instances", seen)
+	}
+}
+
+func TestWithoutRoutingKey(t *testing.T) {
+	lb := New(nil).(*LoadBalancer)
+
+	if _, err := lb.Choose(nil); err != loadbalancer.NoInstances {
+		t.Fatal("LoadBalancer should fail if no instances exist")
+	}
+
+	for _, i := range instances(3) {
+		lb.AddInstance(i)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		s, err := lb.Choose(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		seen[s.UUID] = true
+	}
+
+	if len(seen) != 3 {
+		t.Fatal("Requests without a routing key were not spread across instances", seen)
+	}
+}
+
+func assignments(lb *LoadBalancer, keys int) map[string]string {
+	a := make(map[string]string)
+
+	for k := 0; k < keys; k++ {
+		key := fmt.Sprint("key", k)
+		s, _ := lb.Choose(&skynet.RequestInfo{RoutingKey: key})
+		a[key] = s.UUID
+	}
+
+	return a
+}
+
+func instances(n int) (instances []skynet.ServiceInfo) {
+	for i := 1; i <= n; i++ {
+		instances = append(instances, serviceInfo(fmt.Sprint(i), true))
+	}
+
+	return
+}
+
+func serviceInfo(uuid string, registered bool) skynet.ServiceInfo {
+	return skynet.ServiceInfo{UUID: uuid, Name: "TestService", Registered: registered}
+}
@@ -0,0 +1,323 @@
+/*
+Package failover provides a load balancer that honors the order of the regions in a
+ServiceClient's criteria. Instances are grouped into tiers, one for each region in the
+order they were given, followed by a tier for any other region. Requests are sent to the
+first tier with registered instances whose recent error rate is below the threshold, and
+spill over to the next tier otherwise.
+
+	client.SetLoadBalancerFactory(failover.New)
+	client.GetService("Billing", "", "us-west", "") // or GetServiceFromCriteria() for several regions
+*/
+package failover
+
+import (
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/client/conn"
+	"github.com/skynetservices/skynet/client/loadbalancer"
+	"github.com/skynetservices/skynet/client/loadbalancer/leastoutstanding"
+	"github.com/skynetservices/skynet/log"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultErrorThreshold is the fraction of recent requests to a tier that may fail before
+	// requests spill over to the next tier.
+	DefaultErrorThreshold = 0.5
+	// DefaultRecoveryTime is how long a tier that exceeded the error threshold is avoided before it
+	// is tried again.
+	DefaultRecoveryTime = 10 * time.Second
+
+	// the number of recent requests to a tier its error rate is measured over, and the number
+	// that must have been made before the error rate is considered
+	window      = 20
+	minRequests = 5
+)
+
+type tier struct {
+	region string
+	lb     loadbalancer.LoadBalancer
+
+	// results of recent requests, true for those that failed
+	results  []bool
+	next     int
+	failures int
+
+	// when the error threshold was exceeded, zero while the tier is healthy
+	unhealthySince time.Time
+
+	served uint64
+}
+
+func (t *tier) record(failed bool) {
+	if len(t.results) < window {
+		t.results = append(t.results, failed)
+	} else {
+		if t.results[t.next] {
+			t.failures--
+		}
+
+		t.results[t.next] = failed
+		t.next = (t.next + 1) % window
+	}
+
+	if failed {
+		t.failures++
+	}
+}
+
+func (t *tier) reset() {
+	t.results, t.next, t.failures = nil, 0, 0
+	t.unhealthySince = time.Time{}
+}
+
+/*
+failover.LoadBalancer chooses instances from the first healthy tier, using a LoadBalancer
+from Factory within each tier
+*/
+type LoadBalancer struct {
+	// ErrorThreshold and RecoveryTime may be changed before the LoadBalancer is used
+	ErrorThreshold float64
+	RecoveryTime   time.Duration
+
+	factory loadbalancer.Factory
+
+	mutex     sync.Mutex
+	criteria  *skynet.Criteria
+	tiers     []*tier
+	instances map[string]skynet.ServiceInfo
+
+	// the tier of each instance given to a tier's LoadBalancer
+	tierOf map[string]int
+
+	// the tier the last request was sent to
+	current int
+
+	// replaced in tests
+	now func() time.Time
+}
+
+/*
+* New() returns a new failover LoadBalancer choosing the instance of a tier with the fewest requests in flight
+ */
+func New(instances []skynet.ServiceInfo) loadbalancer.LoadBalancer {
+	return NewFactory(leastoutstanding.New)(instances)
+}
+
+/*
+failover.NewFactory() returns a Factory for failover LoadBalancers which choose between the
+instances of a tier with LoadBalancers from factory
+*/
+func NewFactory(factory loadbalancer.Factory) loadbalancer.Factory {
+	return func(instances []skynet.ServiceInfo) loadbalancer.LoadBalancer {
+		lb := &LoadBalancer{
+			ErrorThreshold: DefaultErrorThreshold,
+			RecoveryTime:   DefaultRecoveryTime,
+			factory:        factory,
+			criteria:       &skynet.Criteria{},
+			instances:      make(map[string]skynet.ServiceInfo),
+			now:            time.Now,
+		}
+
+		lb.buildTiers()
+
+		for _, i := range instances {
+			lb.AddInstance(i)
+		}
+
+		return lb
+	}
+}
+
+/*
+LoadBalancer.SetCriteria() orders the tiers by the regions of c
+*/
+func (lb *LoadBalancer) SetCriteria(c *skynet.Criteria) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	lb.criteria = c
+	lb.buildTiers()
+}
+
+// buildTiers must be called with mutex held
+func (lb *LoadBalancer) buildTiers() {
+	lb.tiers = nil
+	lb.tierOf = make(map[string]int)
+	lb.current = 0
+
+	regions := append(append([]string(nil), lb.criteria.Regions...), "")
+
+	for _, r := range regions {
+		lb.tiers = append(lb.tiers, &tier{region: r, lb: lb.factory([]skynet.ServiceInfo{})})
+	}
+
+	for _, s := range lb.instances {
+		lb.place(s)
+	}
+}
+
+// place gives s to the LoadBalancer of its tier, must be called with mutex held
+func (lb *LoadBalancer) place(s skynet.ServiceInfo) {
+	t := len(lb.tiers) - 1
+	for i, r := range lb.criteria.Regions {
+		if r == s.Region {
+			t = i
+			break
+		}
+	}
+
+	if old, ok := lb.tierOf[s.UUID]; ok {
+		if old == t {
+			lb.tiers[t].lb.UpdateInstance(s)
+			return
+		}
+
+		lb.tiers[old].lb.RemoveInstance(s)
+	}
+
+	lb.tiers[t].lb.AddInstance(s)
+	lb.tierOf[s.UUID] = t
+}
+
+func (lb *LoadBalancer) AddInstance(s skynet.ServiceInfo) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	lb.instances[s.UUID] = s
+	lb.place(s)
+}
+
+func (lb *LoadBalancer) UpdateInstance(s skynet.ServiceInfo) {
+	lb.AddInstance(s)
+}
+
+func (lb *LoadBalancer) RemoveInstance(s skynet.ServiceInfo) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	if t, ok := lb.tierOf[s.UUID]; ok {
+		lb.tiers[t].lb.RemoveInstance(lb.instances[s.UUID])
+		delete(lb.tierOf, s.UUID)
+	}
+
+	delete(lb.instances, s.UUID)
+}
+
+/*
+LoadBalancer.Choose() returns an instance from the first tier with registered instances that
+hasn't exceeded the error threshold. If every such tier has, the first tier with registered
+instances is used.
+*/
+func (lb *LoadBalancer) Choose(ri *skynet.RequestInfo) (s skynet.ServiceInfo, err error) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	now := lb.now()
+
+	for _, healthyOnly := range []bool{true, false} {
+		for i, t := range lb.tiers {
+			if healthyOnly && !lb.healthy(t, now) {
+				continue
+			}
+
+			if s, err = t.lb.Choose(ri); err == nil {
+				lb.chose(i)
+				return
+			}
+		}
+	}
+
+	return s, loadbalancer.NoInstances
+}
+
+// healthy must be called with mutex held
+func (lb *LoadBalancer) healthy(t *tier, now time.Time) bool {
+	if t.unhealthySince.IsZero() {
+		return true
+	}
+
+	// give the tier another chance
+	if now.Sub(t.unhealthySince) >= lb.RecoveryTime {
+		t.reset()
+		return true
+	}
+
+	return false
+}
+
+// chose records that tier i was chosen, must be called with mutex held
+func (lb *LoadBalancer) chose(i int) {
+	lb.tiers[i].served++
+
+	if i == lb.current {
+		return
+	}
+
+	name := ""
+	if len(lb.criteria.Services) > 0 {
+		name = lb.criteria.Services[0].String()
+	}
+
+	if i > lb.current {
+		log.Printf(log.WARN, "%+v", FailedOver{name, lb.tiers[lb.current].region, lb.tiers[i].region})
+	} else {
+		log.Printf(log.INFO, "%+v", FailedBack{name, lb.tiers[lb.current].region, lb.tiers[i].region})
+	}
+
+	lb.current = i
+}
+
+func (lb *LoadBalancer) Complete(s skynet.ServiceInfo, duration time.Duration, err error) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	i, ok := lb.tierOf[s.UUID]
+	if !ok {
+		return
+	}
+
+	t := lb.tiers[i]
+	t.lb.Complete(s, duration, err)
+
+	if loadbalancer.Abandoned(err) {
+		return
+	}
+
+	// errors returned by the service are answers, not a sign the tier is unhealthy
+	t.record(err != nil && !conn.IsServiceError(err))
+
+	if t.unhealthySince.IsZero() && len(t.results) >= minRequests && float64(t.failures)/float64(len(t.results)) > lb.ErrorThreshold {
+		t.unhealthySince = lb.now()
+	}
+}
+
+/*
+LoadBalancer.Tier() returns the tier an instance belongs to, 0 being the first region of the
+criteria, and the region of that tier, which is empty for the tier of any other region
+*/
+func (lb *LoadBalancer) Tier(s skynet.ServiceInfo) (t int, region string) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	t, ok := lb.tierOf[s.UUID]
+	if !ok {
+		return -1, ""
+	}
+
+	return t, lb.tiers[t].region
+}
+
+/*
+LoadBalancer.Served() returns the number of requests sent to each tier
+*/
+func (lb *LoadBalancer) Served() (served []uint64) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	for _, t := range lb.tiers {
+		served = append(served, t.served)
+	}
+
+	return
+}
@@ -0,0 +1,118 @@
+package failover
+
+import (
+	"errors"
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/client/loadbalancer"
+	"github.com/skynetservices/skynet/test"
+	"testing"
+	"time"
+)
+
+func TestPrefersFirstRegion(t *testing.T) {
+	lb, _ := newLoadBalancer("us-west", "us-east")
+
+	lb.AddInstance(serviceInfo("east", "us-east", true))
+	lb.AddInstance(serviceInfo("other", "eu-west", true))
+
+	if s, _ := lb.Choose(nil); s.UUID != "east" {
+		t.Fatal("LoadBalancer did not spill over to the second region", s.UUID)
+	}
+
+	lb.AddInstance(serviceInfo("west", "us-west", true))
+
+	for i := 0; i < 3; i++ {
+		if s, _ := lb.Choose(nil); s.UUID != "west" {
+			t.Fatal("LoadBalancer did not prefer the first region", s.UUID)
+		}
+	}
+
+	// unregistered instances aren't healthy
+	lb.UpdateInstance(serviceInfo("west", "us-west", false))
+	lb.RemoveInstance(serviceInfo("east", "us-east", true))
+
+	s, _ := lb.Choose(nil)
+	if tier, region := lb.Tier(s); s.UUID != "other" || tier != 2 || region != "" {
+		t.Fatal("LoadBalancer did not spill over to other regions", s.UUID, tier, region)
+	}
+
+	if served := lb.Served(); served[0] != 3 || served[1] != 1 || served[2] != 1 {
+		t.Fatal("Requests served by each tier not reported", served)
+	}
+
+	lb.RemoveInstance(serviceInfo("other", "eu-west", true))
+
+	if _, err := lb.Choose(nil); err != loadbalancer.NoInstances {
+		t.Fatal("LoadBalancer should fail if no instances are registered")
+	}
+}
+
+func TestErrorThreshold(t *testing.T) {
+	lb, clock := newLoadBalancer("us-west", "us-east")
+
+	lb.AddInstance(serviceInfo("west", "us-west", true))
+	lb.AddInstance(serviceInfo("east", "us-east", true))
+
+	failed := errors.New("failed")
+
+	for i := 0; i < minRequests; i++ {
+		s, _ := lb.Choose(nil)
+		if s.UUID != "west" {
+			t.Fatal("LoadBalancer failed over before the error threshold was exceeded")
+		}
+
+		lb.Complete(s, time.Millisecond, failed)
+	}
+
+	if s, _ := lb.Choose(nil); s.UUID != "east" {
+		t.Fatal("LoadBalancer did not fail over when the error threshold was exceeded", s.UUID)
+	}
+
+	// the second region failing too leaves the first region with instances
+	for i := 0; i < minRequests; i++ {
+		lb.Complete(serviceInfo("east", "us-east", true), time.Millisecond, failed)
+	}
+
+	if s, _ := lb.Choose(nil); s.UUID != "west" {
+		t.Fatal("LoadBalancer did not fall back to the first region", s.UUID)
+	}
+
+	clock.Advance(DefaultRecoveryTime)
+
+	for i := 0; i < 3; i++ {
+		if s, _ := lb.Choose(nil); s.UUID != "west" {
+			t.Fatal("LoadBalancer did not recover the first region", s.UUID)
+		}
+
+		lb.Complete(serviceInfo("west", "us-west", true), time.Millisecond, nil)
+	}
+}
+
+func TestSetCriteriaReordersTiers(t *testing.T) {
+	lb := New([]skynet.ServiceInfo{serviceInfo("west", "us-west", true), serviceInfo("east", "us-east", true)}).(*LoadBalancer)
+
+	lb.SetCriteria(&skynet.Criteria{Regions: []string{"us-east", "us-west"}})
+
+	if s, _ := lb.Choose(nil); s.UUID != "east" {
+		t.Fatal("LoadBalancer did not order tiers by criteria", s.UUID)
+	}
+
+	if tier, region := lb.Tier(serviceInfo("west", "us-west", true)); tier != 1 || region != "us-west" {
+		t.Fatal("Instance not in the tier of its region", tier, region)
+	}
+}
+
+func newLoadBalancer(regions ...string) (*LoadBalancer, *test.Clock) {
+	clock := test.NewClock()
+
+	lb := New(nil).(*LoadBalancer)
+	lb.now = clock.Now
+
+	lb.SetCriteria(&skynet.Criteria{Regions: regions})
+
+	return lb, clock
+}
+
+func serviceInfo(uuid, region string, registered bool) skynet.ServiceInfo {
+	return skynet.ServiceInfo{UUID: uuid, Name: "TestService", Region: region, Registered: registered}
+}
@@ -0,0 +1,25 @@
+package failover
+
+import (
+	"fmt"
+)
+
+type FailedOver struct {
+	Service string
+	From    string
+	To      string
+}
+
+func (fo FailedOver) String() string {
+	return fmt.Sprintf("Requests for %s failed over from region %q to %q", fo.Service, fo.From, fo.To)
+}
+
+type FailedBack struct {
+	Service string
+	From    string
+	To      string
+}
+
+func (fb FailedBack) String() string {
+	return fmt.Sprintf("Requests for %s failed back from region %q to %q", fb.Service, fb.From, fb.To)
+}
@@ -0,0 +1,130 @@
+package leastoutstanding
+
+import (
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/client/loadbalancer"
+	"sync"
+	"time"
+)
+
+type instance struct {
+	info        skynet.ServiceInfo
+	outstanding int
+}
+
+/*
+leastoutstanding.LoadBalancer chooses the registered instance with the fewest requests in
+flight, taking turns between instances that are equally busy
+*/
+type LoadBalancer struct {
+	mutex     sync.Mutex
+	instances map[string]*instance
+
+	// instances in the order they were added, and where the search for the least busy begins
+	order []string
+	next  int
+}
+
+/*
+* New() returns a new least outstanding requests LoadBalancer
+ */
+func New(instances []skynet.ServiceInfo) loadbalancer.LoadBalancer {
+	lb := &LoadBalancer{
+		instances: make(map[string]*instance),
+	}
+
+	for _, i := range instances {
+		lb.AddInstance(i)
+	}
+
+	return lb
+}
+
+func (lb *LoadBalancer) AddInstance(s skynet.ServiceInfo) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	if i, ok := lb.instances[s.UUID]; ok {
+		i.info = s
+		return
+	}
+
+	lb.instances[s.UUID] = &instance{info: s}
+	lb.order = append(lb.order, s.UUID)
+}
+
+func (lb *LoadBalancer) UpdateInstance(s skynet.ServiceInfo) {
+	lb.AddInstance(s)
+}
+
+func (lb *LoadBalancer) RemoveInstance(s skynet.ServiceInfo) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	if _, ok := lb.instances[s.UUID]; !ok {
+		return
+	}
+
+	delete(lb.instances, s.UUID)
+
+	for i, uuid := range lb.order {
+		if uuid == s.UUID {
+			lb.order = append(lb.order[:i], lb.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (lb *LoadBalancer) Choose(ri *skynet.RequestInfo) (s skynet.ServiceInfo, err error) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	var chosen *instance
+	chosenAt := 0
+
+	for n := 0; n < len(lb.order); n++ {
+		at := (lb.next + n) % len(lb.order)
+		i := lb.instances[lb.order[at]]
+
+		if !i.info.Registered {
+			continue
+		}
+
+		if chosen == nil || i.outstanding < chosen.outstanding {
+			chosen, chosenAt = i, at
+		}
+	}
+
+	if chosen == nil {
+		return s, loadbalancer.NoInstances
+	}
+
+	chosen.outstanding++
+	lb.next = chosenAt + 1
+
+	return chosen.info, nil
+}
+
+func (lb *LoadBalancer) Complete(s skynet.ServiceInfo, duration time.Duration, err error) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	// the instance may have been removed, and even added again, since it was chosen
+	if i, ok := lb.instances[s.UUID]; ok && i.outstanding > 0 {
+		i.outstanding--
+	}
+}
+
+/*
+LoadBalancer.Outstanding() returns the number of requests in flight to the instance
+*/
+func (lb *LoadBalancer) Outstanding(uuid string) int {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	if i, ok := lb.instances[uuid]; ok {
+		return i.outstanding
+	}
+
+	return 0
+}
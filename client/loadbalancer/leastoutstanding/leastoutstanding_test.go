@@ -0,0 +1,91 @@
+package leastoutstanding
+
+import (
+	"errors"
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/client/loadbalancer"
+	"testing"
+)
+
+func TestChooseLeastOutstanding(t *testing.T) {
+	lb := New([]skynet.ServiceInfo{serviceInfo("1", true), serviceInfo("2", true), serviceInfo("3", true)}).(*LoadBalancer)
+
+	// with nothing in flight each instance is chosen in turn
+	for _, uuid := range []string{"1", "2", "3"} {
+		if s, err := lb.Choose(nil); err != nil || s.UUID != uuid {
+			t.Fatal("LoadBalancer did not take turns between idle instances", s.UUID, err)
+		}
+	}
+
+	lb.Complete(serviceInfo("2", true), 0, nil)
+
+	if s, _ := lb.Choose(nil); s.UUID != "2" {
+		t.Fatal("LoadBalancer did not choose the instance with the fewest requests in flight", s.UUID)
+	}
+
+	lb.Complete(serviceInfo("3", true), 0, errors.New("failed"))
+	lb.Complete(serviceInfo("1", true), 0, nil)
+	lb.Complete(serviceInfo("1", true), 0, nil)
+
+	// 1 and 3 are idle, 3 is next in turn
+	if s, _ := lb.Choose(nil); s.UUID != "3" {
+		t.Fatal("LoadBalancer did not take turns between idle instances", s.UUID)
+	}
+
+	if s, _ := lb.Choose(nil); s.UUID != "1" {
+		t.Fatal("LoadBalancer did not choose the instance with the fewest requests in flight", s.UUID)
+	}
+
+	if lb.Outstanding("1") != 1 || lb.Outstanding("2") != 1 || lb.Outstanding("3") != 1 {
+		t.Fatal("Outstanding requests not tracked", lb.Outstanding("1"), lb.Outstanding("2"), lb.Outstanding("3"))
+	}
+}
+
+func TestChooseIgnoresUnregistered(t *testing.T) {
+	lb := New([]skynet.ServiceInfo{serviceInfo("1", false), serviceInfo("2", true)}).(*LoadBalancer)
+
+	for i := 0; i < 3; i++ {
+		if s, _ := lb.Choose(nil); s.UUID != "2" {
+			t.Fatal("LoadBalancer chose an unregistered instance")
+		}
+	}
+
+	lb.UpdateInstance(serviceInfo("2", false))
+
+	if _, err := lb.Choose(nil); err != loadbalancer.NoInstances {
+		t.Fatal("LoadBalancer should fail if no instances are registered")
+	}
+
+	lb.UpdateInstance(serviceInfo("1", true))
+
+	if s, _ := lb.Choose(nil); s.UUID != "1" {
+		t.Fatal("LoadBalancer did not choose newly registered instance")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	lb := New([]skynet.ServiceInfo{serviceInfo("1", true), serviceInfo("2", true)}).(*LoadBalancer)
+
+	s, _ := lb.Choose(nil)
+	lb.RemoveInstance(s)
+
+	// completing a request to a removed instance is ignored
+	lb.Complete(s, 0, nil)
+
+	for i := 0; i < 3; i++ {
+		if c, _ := lb.Choose(nil); c.UUID == s.UUID {
+			t.Fatal("LoadBalancer chose a removed instance")
+		}
+	}
+
+	lb.RemoveInstance(serviceInfo("2", true))
+	lb.RemoveInstance(serviceInfo("2", true))
+
+	if _, err := lb.Choose(nil); err != loadbalancer.NoInstances {
+		t.Fatal("LoadBalancer should fail if no instances exist")
+	}
+}
+
+func serviceInfo(uuid string, registered bool) skynet.ServiceInfo {
+	return skynet.ServiceInfo{UUID: uuid, Name: "TestService", Registered: registered}
+}
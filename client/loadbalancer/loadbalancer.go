@@ -1,19 +1,41 @@
 package loadbalancer
 
 import (
+	"context"
 	"errors"
 	"github.com/skynetservices/skynet"
+	"time"
 )
 
 var (
 	NoInstances = errors.New("No instances")
+	NotSent     = errors.New("Request not sent")
 )
 
 type LoadBalancer interface {
 	AddInstance(s skynet.ServiceInfo)
 	UpdateInstance(s skynet.ServiceInfo)
 	RemoveInstance(s skynet.ServiceInfo)
-	Choose() (skynet.ServiceInfo, error)
+	// Choose returns the instance to send the request to, ri may be nil
+	Choose(ri *skynet.RequestInfo) (skynet.ServiceInfo, error)
+
+	// Complete is called once the request sent to an instance returned by Choose has finished,
+	// with how long it took and the error if it failed. Requests the caller gave up on, or never
+	// sent to the instance, finish with an error for which Abandoned returns true.
+	Complete(s skynet.ServiceInfo, duration time.Duration, err error)
 }
 
 type Factory func(instances []skynet.ServiceInfo) LoadBalancer
+
+// CriteriaAware is implemented by LoadBalancers that choose between instances using the criteria
+// of the ServiceClient they balance for, such as the order of its regions. SetCriteria is called
+// before any requests are sent.
+type CriteriaAware interface {
+	SetCriteria(c *skynet.Criteria)
+}
+
+// Abandoned returns true if err means the caller gave up on the request, or never sent it, rather
+// than the instance failing it
+func Abandoned(err error) bool {
+	return err == context.Canceled || err == context.DeadlineExceeded || err == NotSent
+}
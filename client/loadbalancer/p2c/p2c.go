@@ -0,0 +1,214 @@
+/*
+Package p2c provides a latency aware load balancer. It keeps an exponentially weighted
+moving average (EWMA) of the latency and error rate of each instance, and for every
+request picks two registered instances at random and chooses the one that costs less,
+so slow or failing instances shed traffic without every client flocking to the
+single fastest instance.
+*/
+package p2c
+
+import (
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/client/conn"
+	"github.com/skynetservices/skynet/client/loadbalancer"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// DecayTime is how long it takes for an observation's weight in the averages to fall to 1/e
+	DecayTime = 10 * time.Second
+
+	// the lowest success rate used when costing an instance, so that costs stay finite
+	minSuccessRate = 0.01
+)
+
+type instance struct {
+	info skynet.ServiceInfo
+
+	// nanoseconds, and the fraction of requests that failed
+	latency float64
+	errors  float64
+
+	// whether latency has been sampled, which not every request does
+	hasLatency  bool
+	lastSample  time.Time
+	outstanding int
+}
+
+/*
+p2c.LoadBalancer chooses between two random registered instances by their average latency,
+error rate and requests in flight
+*/
+type LoadBalancer struct {
+	mutex     sync.Mutex
+	instances map[string]*instance
+	order     []string
+	rand      *rand.Rand
+
+	// replaced in tests
+	now func() time.Time
+}
+
+/*
+* New() returns a new power of two choices LoadBalancer
+ */
+func New(instances []skynet.ServiceInfo) loadbalancer.LoadBalancer {
+	lb := &LoadBalancer{
+		instances: make(map[string]*instance),
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		now:       time.Now,
+	}
+
+	for _, i := range instances {
+		lb.AddInstance(i)
+	}
+
+	return lb
+}
+
+func (lb *LoadBalancer) AddInstance(s skynet.ServiceInfo) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	if i, ok := lb.instances[s.UUID]; ok {
+		i.info = s
+		return
+	}
+
+	// averages begin decaying from when the instance was added, so that a single early failure
+	// doesn't count as much as a history of them
+	lb.instances[s.UUID] = &instance{info: s, lastSample: lb.now()}
+	lb.order = append(lb.order, s.UUID)
+}
+
+func (lb *LoadBalancer) UpdateInstance(s skynet.ServiceInfo) {
+	lb.AddInstance(s)
+}
+
+func (lb *LoadBalancer) RemoveInstance(s skynet.ServiceInfo) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	if _, ok := lb.instances[s.UUID]; !ok {
+		return
+	}
+
+	delete(lb.instances, s.UUID)
+
+	for i, uuid := range lb.order {
+		if uuid == s.UUID {
+			lb.order = append(lb.order[:i], lb.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (lb *LoadBalancer) Choose(ri *skynet.RequestInfo) (s skynet.ServiceInfo, err error) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	var registered []*instance
+	for _, uuid := range lb.order {
+		if i := lb.instances[uuid]; i.info.Registered {
+			registered = append(registered, i)
+		}
+	}
+
+	var chosen *instance
+
+	switch len(registered) {
+	case 0:
+		return s, loadbalancer.NoInstances
+	case 1:
+		chosen = registered[0]
+	default:
+		a := lb.rand.Intn(len(registered))
+		b := lb.rand.Intn(len(registered) - 1)
+		if b >= a {
+			b++
+		}
+
+		chosen = registered[a]
+		if lb.cost(registered[b], registered) < lb.cost(chosen, registered) {
+			chosen = registered[b]
+		}
+	}
+
+	chosen.outstanding++
+
+	return chosen.info, nil
+}
+
+/*
+LoadBalancer.Complete() records the latency and outcome of a request. Requests that failed
+quickly say nothing about how fast an instance is, so only the latency of successful requests
+and timeouts is averaged.
+*/
+func (lb *LoadBalancer) Complete(s skynet.ServiceInfo, duration time.Duration, err error) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	i, ok := lb.instances[s.UUID]
+	if !ok {
+		return
+	}
+
+	if i.outstanding > 0 {
+		i.outstanding--
+	}
+
+	// says nothing about how the instance is doing
+	if loadbalancer.Abandoned(err) {
+		return
+	}
+
+	now := lb.now()
+
+	// the weight of the previous averages decays with the time since they were last updated
+	w := math.Exp(-float64(now.Sub(i.lastSample)) / float64(DecayTime))
+
+	// errors returned by the service are answers, not a sign the instance is unhealthy
+	failed := 0.0
+	if err != nil && !conn.IsServiceError(err) {
+		failed = 1
+	}
+
+	i.errors = i.errors*w + failed*(1-w)
+
+	if err == nil || conn.IsTimeout(err) {
+		if i.hasLatency {
+			i.latency = i.latency*w + float64(duration)*(1-w)
+		} else {
+			i.latency = float64(duration)
+			i.hasLatency = true
+		}
+	}
+
+	i.lastSample = now
+}
+
+// cost must be called with mutex held. Instances without a latency yet are assumed to be as
+// fast as the average of the others.
+func (lb *LoadBalancer) cost(i *instance, registered []*instance) float64 {
+	latency := i.latency
+
+	if !i.hasLatency {
+		n := 0
+
+		for _, r := range registered {
+			if r.hasLatency {
+				latency += r.latency
+				n++
+			}
+		}
+
+		if n > 0 {
+			latency /= float64(n)
+		}
+	}
+
+	return (latency + 1) * float64(i.outstanding+1) / math.Max(1-i.errors, minSuccessRate)
+}
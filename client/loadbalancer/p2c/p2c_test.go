@@ -0,0 +1,135 @@
+package p2c
+
+import (
+	"errors"
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/client/conn"
+	"github.com/skynetservices/skynet/client/loadbalancer"
+	"github.com/skynetservices/skynet/test"
+	"testing"
+	"time"
+)
+
+func TestPrefersFasterInstance(t *testing.T) {
+	lb, clock := newLoadBalancer(serviceInfo("fast", true), serviceInfo("slow", true))
+
+	clock.Advance(time.Second)
+	lb.Complete(serviceInfo("fast", true), 10*time.Millisecond, nil)
+	lb.Complete(serviceInfo("slow", true), 100*time.Millisecond, nil)
+
+	for i := 0; i < 10; i++ {
+		s, err := lb.Choose(nil)
+		if err != nil || s.UUID != "fast" {
+			t.Fatal("LoadBalancer did not choose the faster instance", s.UUID, err)
+		}
+
+		lb.Complete(s, 10*time.Millisecond, nil)
+	}
+}
+
+func TestOutstandingRequestsShedTraffic(t *testing.T) {
+	lb, clock := newLoadBalancer(serviceInfo("fast", true), serviceInfo("slow", true))
+
+	clock.Advance(time.Second)
+	lb.Complete(serviceInfo("fast", true), 10*time.Millisecond, nil)
+	lb.Complete(serviceInfo("slow", true), 23*time.Millisecond, nil)
+
+	// without completions requests pile up on the faster instance until it costs more
+	chosen := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		s, _ := lb.Choose(nil)
+		chosen[s.UUID]++
+	}
+
+	if chosen["fast"] != 6 || chosen["slow"] != 2 {
+		t.Fatal("Requests in flight not considered", chosen)
+	}
+}
+
+func TestErrorsAndTimeouts(t *testing.T) {
+	lb, clock := newLoadBalancer(serviceInfo("failing", true), serviceInfo("healthy", true))
+
+	clock.Advance(10 * time.Second)
+	lb.Complete(serviceInfo("healthy", true), 50*time.Millisecond, nil)
+
+	// fast failures don't make an instance look fast
+	lb.Complete(serviceInfo("failing", true), time.Millisecond, errors.New("failed"))
+
+	if s, _ := lb.Choose(nil); s.UUID != "healthy" {
+		t.Fatal("LoadBalancer chose the failing instance")
+	}
+
+	lb, clock = newLoadBalancer(serviceInfo("timingout", true), serviceInfo("healthy", true))
+
+	clock.Advance(10 * time.Second)
+	lb.Complete(serviceInfo("healthy", true), 50*time.Millisecond, nil)
+	lb.Complete(serviceInfo("timingout", true), 20*time.Millisecond, nil)
+
+	clock.Advance(10 * time.Second)
+	lb.Complete(serviceInfo("timingout", true), time.Second, conn.TimeoutError{Timeout: time.Second})
+
+	i := lb.instances["timingout"]
+	if i.latency < float64(500*time.Millisecond) || i.errors < 0.5 {
+		t.Fatal("Timeout not recorded", i.latency, i.errors)
+	}
+
+	if s, _ := lb.Choose(nil); s.UUID != "healthy" {
+		t.Fatal("LoadBalancer chose the instance that timed out")
+	}
+
+	// the timeout is forgotten as time passes and requests succeed
+	clock.Advance(time.Minute)
+	lb.Complete(serviceInfo("timingout", true), 20*time.Millisecond, nil)
+
+	if s, _ := lb.Choose(nil); s.UUID != "timingout" {
+		t.Fatal("LoadBalancer did not recover instance")
+	}
+}
+
+func TestNotSentIgnored(t *testing.T) {
+	lb, clock := newLoadBalancer(serviceInfo("open", true))
+
+	clock.Advance(10 * time.Second)
+	lb.Complete(serviceInfo("open", true), 20*time.Millisecond, nil)
+
+	s, _ := lb.Choose(nil)
+	lb.Complete(s, 0, loadbalancer.NotSent)
+
+	i := lb.instances["open"]
+	if i.outstanding != 0 || i.errors != 0 || i.latency != float64(20*time.Millisecond) {
+		t.Fatal("Request that was never sent recorded", i.outstanding, i.errors, i.latency)
+	}
+}
+
+func TestChooseIgnoresUnregistered(t *testing.T) {
+	lb, _ := newLoadBalancer(serviceInfo("1", false), serviceInfo("2", true), serviceInfo("3", false))
+
+	for i := 0; i < 5; i++ {
+		if s, _ := lb.Choose(nil); s.UUID != "2" {
+			t.Fatal("LoadBalancer chose an unregistered instance")
+		}
+	}
+
+	lb.RemoveInstance(serviceInfo("2", true))
+
+	if _, err := lb.Choose(nil); err != loadbalancer.NoInstances {
+		t.Fatal("LoadBalancer should fail if no instances are registered")
+	}
+}
+
+func newLoadBalancer(instances ...skynet.ServiceInfo) (*LoadBalancer, *test.Clock) {
+	clock := test.NewClock()
+
+	lb := New(nil).(*LoadBalancer)
+	lb.now = clock.Now
+
+	for _, i := range instances {
+		lb.AddInstance(i)
+	}
+
+	return lb, clock
+}
+
+func serviceInfo(uuid string, registered bool) skynet.ServiceInfo {
+	return skynet.ServiceInfo{UUID: uuid, Name: "TestService", Registered: registered}
+}
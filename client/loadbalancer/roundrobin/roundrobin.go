@@ -5,6 +5,7 @@ import (
 	"github.com/skynetservices/skynet"
 	"github.com/skynetservices/skynet/client/loadbalancer"
 	"sync"
+	"time"
 )
 
 type LoadBalancer struct {
@@ -78,7 +79,7 @@ func (lb *LoadBalancer) RemoveInstance(s skynet.ServiceInfo) {
 	}
 }
 
-func (lb *LoadBalancer) Choose() (s skynet.ServiceInfo, err error) {
+func (lb *LoadBalancer) Choose(ri *skynet.RequestInfo) (s skynet.ServiceInfo, err error) {
 	if lb.current == nil {
 		if lb.instanceList.Len() == 0 {
 			return s, loadbalancer.NoInstances
@@ -98,3 +99,7 @@ func (lb *LoadBalancer) Choose() (s skynet.ServiceInfo, err error) {
 
 	return s, nil
 }
+
+// Complete is a no-op, instances are chosen in turn regardless of how requests went
+func (lb *LoadBalancer) Complete(s skynet.ServiceInfo, duration time.Duration, err error) {
+}
@@ -1,9 +1,12 @@
 package roundrobin
 
 import (
+	"errors"
 	"github.com/skynetservices/skynet"
 	"github.com/skynetservices/skynet/client/loadbalancer"
+	"github.com/skynetservices/skynet/config"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -185,7 +188,7 @@ func TestRemove(t *testing.T) {
 func TestChooseReturnsErrorWhenEmpty(t *testing.T) {
 	lb := New([]skynet.ServiceInfo{}).(*LoadBalancer)
 
-	_, err := lb.Choose()
+	_, err := lb.Choose(nil)
 
 	if err != loadbalancer.NoInstances {
 		t.Fatal("LoadBalancer should fail if no instances exist")
@@ -199,7 +202,7 @@ func TestChoose(t *testing.T) {
 
 	// Check order
 	for i := 0; i <= 3; i++ {
-		s, err := lb.Choose()
+		s, err := lb.Choose(nil)
 
 		if err != nil || s.UUID != instances[i].UUID {
 			t.Fatal("LoadBalancer did not properly iterate over instances")
@@ -207,15 +210,50 @@ func TestChoose(t *testing.T) {
 	}
 
 	// Ensure Choose loops around when it hits the end
-	s, err := lb.Choose()
+	s, err := lb.Choose(nil)
 	if err != nil || s.UUID != instances[0].UUID {
 		t.Fatal("LoadBalancer did not properly iterate over instances")
 	}
 }
 
-func serviceInfo(registered bool) skynet.ServiceInfo {
-	si := skynet.NewServiceInfo(nil)
-	si.Registered = registered
+func TestChooseIgnoresRoutingKey(t *testing.T) {
+	instances := []skynet.ServiceInfo{serviceInfo(true), serviceInfo(true), serviceInfo(true)}
+
+	lb := New(instances).(*LoadBalancer)
+
+	// requests with the same key aren't kept on one instance
+	ri := &skynet.RequestInfo{RequestID: "id", RoutingKey: "key"}
+
+	for i := 0; i < 6; i++ {
+		s, err := lb.Choose(ri)
+
+		if err != nil || s.UUID != instances[i%3].UUID {
+			t.Fatal("LoadBalancer did not properly iterate over instances")
+		}
+	}
+}
+
+func TestCompleteDoesNotChangeOrder(t *testing.T) {
+	instances := []skynet.ServiceInfo{serviceInfo(true), serviceInfo(true), serviceInfo(true)}
 
-	return si
+	lb := New(instances).(*LoadBalancer)
+
+	// instances are chosen in turn however their requests went
+	for i := 0; i < 6; i++ {
+		s, err := lb.Choose(nil)
+
+		if err != nil || s.UUID != instances[i%3].UUID {
+			t.Fatal("LoadBalancer did not properly iterate over instances")
+		}
+
+		if s.UUID == instances[0].UUID {
+			lb.Complete(s, time.Second, errors.New("failed"))
+		} else {
+			lb.Complete(s, time.Millisecond, nil)
+		}
+	}
+}
+
+func serviceInfo(registered bool) skynet.ServiceInfo {
+	return skynet.ServiceInfo{UUID: config.NewUUID(), Name: "TestService", Registered: registered}
 }
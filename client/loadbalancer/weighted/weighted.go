@@ -0,0 +1,132 @@
+/*
+Package weighted provides a load balancer that sends each registered instance a share of
+requests proportional to its ServiceInfo.Weight, such as to send more traffic to larger
+machines or to gradually ramp up traffic to a canary.
+
+Instances are chosen by smooth weighted round robin: every choice, each instance's current
+weight grows by its weight, the instance with the highest current weight is chosen, and the
+total weight is taken from it. Requests are interleaved rather than sent to an instance in
+bursts, and changing an instance's weight keeps its place rather than starting over.
+*/
+package weighted
+
+import (
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/client/loadbalancer"
+	"github.com/skynetservices/skynet/config"
+	"sync"
+	"time"
+)
+
+type instance struct {
+	info    skynet.ServiceInfo
+	current int
+}
+
+func (i *instance) weight() int {
+	if i.info.Weight <= 0 {
+		return config.DefaultWeight
+	}
+
+	return i.info.Weight
+}
+
+/*
+weighted.LoadBalancer chooses registered instances in proportion to their weights
+*/
+type LoadBalancer struct {
+	mutex     sync.Mutex
+	instances map[string]*instance
+
+	// instances in the order they were added, so that equal instances are chosen in turn
+	order []string
+}
+
+/*
+* New() returns a new smooth weighted round robin LoadBalancer
+ */
+func New(instances []skynet.ServiceInfo) loadbalancer.LoadBalancer {
+	lb := &LoadBalancer{
+		instances: make(map[string]*instance),
+	}
+
+	for _, i := range instances {
+		lb.AddInstance(i)
+	}
+
+	return lb
+}
+
+func (lb *LoadBalancer) AddInstance(s skynet.ServiceInfo) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	if i, ok := lb.instances[s.UUID]; ok {
+		// an instance that stops taking requests starts over when it returns
+		if !s.Registered {
+			i.current = 0
+		}
+
+		i.info = s
+		return
+	}
+
+	lb.instances[s.UUID] = &instance{info: s}
+	lb.order = append(lb.order, s.UUID)
+}
+
+func (lb *LoadBalancer) UpdateInstance(s skynet.ServiceInfo) {
+	lb.AddInstance(s)
+}
+
+func (lb *LoadBalancer) RemoveInstance(s skynet.ServiceInfo) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	if _, ok := lb.instances[s.UUID]; !ok {
+		return
+	}
+
+	delete(lb.instances, s.UUID)
+
+	for i, uuid := range lb.order {
+		if uuid == s.UUID {
+			lb.order = append(lb.order[:i], lb.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func (lb *LoadBalancer) Choose(ri *skynet.RequestInfo) (s skynet.ServiceInfo, err error) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	var chosen *instance
+	total := 0
+
+	for _, uuid := range lb.order {
+		i := lb.instances[uuid]
+		if !i.info.Registered {
+			continue
+		}
+
+		i.current += i.weight()
+		total += i.weight()
+
+		if chosen == nil || i.current > chosen.current {
+			chosen = i
+		}
+	}
+
+	if chosen == nil {
+		return s, loadbalancer.NoInstances
+	}
+
+	chosen.current -= total
+
+	return chosen.info, nil
+}
+
+// Complete is a no-op, instances are chosen by weight regardless of how requests went
+func (lb *LoadBalancer) Complete(s skynet.ServiceInfo, duration time.Duration, err error) {
+}
@@ -0,0 +1,69 @@
+package weighted
+
+import (
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/client/loadbalancer"
+	"testing"
+)
+
+func TestSmoothWeighting(t *testing.T) {
+	lb := New([]skynet.ServiceInfo{serviceInfo("a", 5, true), serviceInfo("b", 1, true), serviceInfo("c", 1, true)}).(*LoadBalancer)
+
+	// the sequence from nginx's description of smooth weighted round robin
+	for _, uuid := range []string{"a", "a", "b", "a", "c", "a", "a"} {
+		if s, _ := lb.Choose(nil); s.UUID != uuid {
+			t.Fatal("Unexpected instance chosen", s.UUID, "expected", uuid)
+		}
+	}
+}
+
+func TestDefaultWeight(t *testing.T) {
+	lb := New([]skynet.ServiceInfo{serviceInfo("a", 0, true), serviceInfo("b", 1, true)}).(*LoadBalancer)
+
+	chosen := choose(lb, 10)
+	if chosen["a"] != 5 || chosen["b"] != 5 {
+		t.Fatal("Instances without a weight not given the default weight", chosen)
+	}
+}
+
+func TestUpdateWeight(t *testing.T) {
+	lb := New([]skynet.ServiceInfo{serviceInfo("stable", 9, true), serviceInfo("canary", 1, true)}).(*LoadBalancer)
+
+	if chosen := choose(lb, 100); chosen["stable"] != 90 || chosen["canary"] != 10 {
+		t.Fatal("Requests not proportional to weight", chosen)
+	}
+
+	// ramp up the canary
+	lb.UpdateInstance(serviceInfo("canary", 9, true))
+
+	if chosen := choose(lb, 100); chosen["stable"] != 50 || chosen["canary"] != 50 {
+		t.Fatal("Weight change not honored", chosen)
+	}
+
+	lb.UpdateInstance(serviceInfo("canary", 9, false))
+
+	if chosen := choose(lb, 10); chosen["stable"] != 10 {
+		t.Fatal("Unregistered instance chosen", chosen)
+	}
+
+	lb.RemoveInstance(serviceInfo("stable", 9, true))
+
+	if _, err := lb.Choose(nil); err != loadbalancer.NoInstances {
+		t.Fatal("LoadBalancer should fail if no instances are registered")
+	}
+}
+
+func choose(lb *LoadBalancer, n int) map[string]int {
+	chosen := make(map[string]int)
+
+	for i := 0; i < n; i++ {
+		s, _ := lb.Choose(nil)
+		chosen[s.UUID]++
+	}
+
+	return chosen
+}
+
+func serviceInfo(uuid string, weight int, registered bool) skynet.ServiceInfo {
+	return skynet.ServiceInfo{UUID: uuid, Name: "TestService", Weight: weight, Registered: registered}
+}
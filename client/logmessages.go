@@ -0,0 +1,38 @@
+package client
+
+import (
+	"fmt"
+	"github.com/skynetservices/skynet"
+	"time"
+)
+
+type InstanceEjected struct {
+	ServiceInfo skynet.ServiceInfo
+	Duration    time.Duration
+}
+
+func (ie InstanceEjected) String() string {
+	return fmt.Sprintf("Instance %s of service %q at %s ejected for %s after failed requests", ie.ServiceInfo.UUID, ie.ServiceInfo.Name, ie.ServiceInfo.AddrString(), ie.Duration.String())
+}
+
+type InstanceRestored struct {
+	ServiceInfo skynet.ServiceInfo
+}
+
+func (ir InstanceRestored) String() string {
+	return fmt.Sprintf("Instance %s of service %q at %s restored after ejection", ir.ServiceInfo.UUID, ir.ServiceInfo.Name, ir.ServiceInfo.AddrString())
+}
+
+type CircuitChanged struct {
+	Service  string
+	Instance string
+	State    BreakerState
+}
+
+func (cc CircuitChanged) String() string {
+	if cc.Instance == "" {
+		return fmt.Sprintf("Circuit for service %s is %s", cc.Service, cc.State)
+	}
+
+	return fmt.Sprintf("Circuit for instance %s of service %s is %s", cc.Instance, cc.Service, cc.State)
+}
@@ -0,0 +1,233 @@
+package client
+
+import (
+	"github.com/skynetservices/skynet/config"
+	"time"
+)
+
+const (
+	// the number of recent requests to an instance its error rate is measured over, and the number
+	// that must have been made before the error rate is considered
+	outlierWindow      = 20
+	outlierMinRequests = 10
+)
+
+type outlierConfig struct {
+	consecutive       int
+	errorPercent      int
+	maxEjectedPercent int
+	ejection          time.Duration
+	maxEjection       time.Duration
+}
+
+func getOutlierConfig(service, version string) (oc outlierConfig) {
+	oc = outlierConfig{
+		consecutive:       config.DefaultOutlierConsecutiveFailures,
+		errorPercent:      config.DefaultOutlierErrorPercent,
+		maxEjectedPercent: config.DefaultOutlierMaxEjectedPercent,
+		ejection:          config.DefaultOutlierEjectionDuration,
+		maxEjection:       config.DefaultOutlierMaxEjectionDuration,
+	}
+
+	if n, err := config.Int(service, version, "client.outlier.consecutive"); err == nil {
+		oc.consecutive = n
+	}
+
+	if n, err := config.Int(service, version, "client.outlier.errors"); err == nil {
+		oc.errorPercent = n
+	}
+
+	if n, err := config.Int(service, version, "client.outlier.maxejected"); err == nil {
+		oc.maxEjectedPercent = n
+	}
+
+	if d, err := config.Duration(service, version, "client.outlier.ejection"); err == nil {
+		oc.ejection = d
+	}
+
+	if d, err := config.Duration(service, version, "client.outlier.ejection.max"); err == nil {
+		oc.maxEjection = d
+	}
+
+	return
+}
+
+// outlier tracks the results of requests to an instance
+type outlier struct {
+	consecutiveFailures int
+
+	// results of recent requests, true for those that failed
+	results  []bool
+	next     int
+	failures int
+
+	// how many times the instance has been ejected without staying healthy in between
+	ejections    int
+	ejectedUntil time.Time
+	restoredAt   time.Time
+}
+
+func (o *outlier) record(failed bool) {
+	if failed {
+		o.consecutiveFailures++
+	} else {
+		o.consecutiveFailures = 0
+	}
+
+	if len(o.results) < outlierWindow {
+		o.results = append(o.results, failed)
+	} else {
+		if o.results[o.next] {
+			o.failures--
+		}
+
+		o.results[o.next] = failed
+		o.next = (o.next + 1) % outlierWindow
+	}
+
+	if failed {
+		o.failures++
+	}
+}
+
+func (o *outlier) ejected() bool {
+	return !o.ejectedUntil.IsZero()
+}
+
+/*
+outlierDetector decides which instances to eject from a ServiceClient's load balancer. It must
+only be used from the ServiceClient's mux()
+*/
+type outlierDetector struct {
+	config    outlierConfig
+	instances map[string]*outlier
+
+	// replaced in tests
+	now func() time.Time
+}
+
+func newOutlierDetector(oc outlierConfig) *outlierDetector {
+	return &outlierDetector{
+		config:    oc,
+		instances: make(map[string]*outlier),
+		now:       time.Now,
+	}
+}
+
+func (od *outlierDetector) get(uuid string) *outlier {
+	o, ok := od.instances[uuid]
+	if !ok {
+		o = &outlier{}
+		od.instances[uuid] = o
+	}
+
+	return o
+}
+
+func (od *outlierDetector) remove(uuid string) {
+	delete(od.instances, uuid)
+}
+
+func (od *outlierDetector) isEjected(uuid string) bool {
+	o, ok := od.instances[uuid]
+	return ok && o.ejected()
+}
+
+/*
+outlierDetector.record() records the result of a request to an instance, and returns true if the
+instance should be ejected. known is the number of instances the ServiceClient knows of, which
+limits how many may be ejected at once.
+*/
+func (od *outlierDetector) record(uuid string, failed bool, known int) (eject bool) {
+	o := od.get(uuid)
+
+	// requests sent before the instance was ejected may still complete
+	if o.ejected() {
+		return false
+	}
+
+	o.record(failed)
+
+	tooManyConsecutive := od.config.consecutive > 0 && o.consecutiveFailures >= od.config.consecutive
+	tooManyErrors := len(o.results) >= outlierMinRequests && o.failures*100 > od.config.errorPercent*len(o.results)
+
+	if !tooManyConsecutive && !tooManyErrors {
+		return false
+	}
+
+	ejected := 0
+	for _, other := range od.instances {
+		if other.ejected() {
+			ejected++
+		}
+	}
+
+	if (ejected+1)*100 > od.config.maxEjectedPercent*known {
+		return false
+	}
+
+	now := od.now()
+
+	// an instance that stayed healthy for as long as it was last ejected starts over
+	if o.ejections > 0 && now.Sub(o.restoredAt) > od.duration(o.ejections) {
+		o.ejections = 0
+	}
+
+	o.ejections++
+	o.ejectedUntil = now.Add(od.duration(o.ejections))
+
+	return true
+}
+
+// duration returns how long an instance is ejected for the nth time in a row
+func (od *outlierDetector) duration(n int) time.Duration {
+	d := od.config.ejection
+
+	for i := 1; i < n && d < od.config.maxEjection; i++ {
+		d *= 2
+	}
+
+	if d > od.config.maxEjection {
+		d = od.config.maxEjection
+	}
+
+	return d
+}
+
+/*
+outlierDetector.restore() returns the instances whose ejection has ended, and when the next
+ejection ends if any remain
+*/
+func (od *outlierDetector) restore() (restored []string, next time.Time) {
+	now := od.now()
+
+	for uuid, o := range od.instances {
+		if !o.ejected() {
+			continue
+		}
+
+		if !now.Before(o.ejectedUntil) {
+			o.ejectedUntil = time.Time{}
+			o.restoredAt = now
+			o.consecutiveFailures = 0
+			o.results, o.next, o.failures = nil, 0, 0
+
+			restored = append(restored, uuid)
+		} else if next.IsZero() || o.ejectedUntil.Before(next) {
+			next = o.ejectedUntil
+		}
+	}
+
+	return
+}
+
+/*
+outlierDetector.ejectedFor() returns how long remains of an instance's ejection
+*/
+func (od *outlierDetector) ejectedFor(uuid string) time.Duration {
+	if o, ok := od.instances[uuid]; ok && o.ejected() {
+		return o.ejectedUntil.Sub(od.now())
+	}
+
+	return 0
+}
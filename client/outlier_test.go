@@ -0,0 +1,170 @@
+package client
+
+import (
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/test"
+	"testing"
+	"time"
+)
+
+func testOutlierDetector() (*outlierDetector, *test.Clock) {
+	clock := test.NewClock()
+
+	od := newOutlierDetector(outlierConfig{
+		consecutive:       3,
+		errorPercent:      50,
+		maxEjectedPercent: 50,
+		ejection:          time.Second,
+		maxEjection:       3 * time.Second,
+	})
+	od.now = clock.Now
+
+	return od, clock
+}
+
+func TestEjectConsecutiveFailures(t *testing.T) {
+	od, _ := testOutlierDetector()
+
+	if od.record("1", true, 4) || od.record("1", true, 4) {
+		t.Fatal("Instance ejected before too many consecutive failures")
+	}
+
+	od.record("1", false, 4)
+
+	if od.record("1", true, 4) || od.record("1", true, 4) {
+		t.Fatal("Consecutive failures not reset by a success")
+	}
+
+	if !od.record("1", true, 4) || !od.isEjected("1") {
+		t.Fatal("Instance not ejected after consecutive failures")
+	}
+
+	if od.ejectedFor("1") != time.Second {
+		t.Fatal("Unexpected ejection duration", od.ejectedFor("1"))
+	}
+}
+
+func TestEjectErrorRate(t *testing.T) {
+	od, _ := testOutlierDetector()
+
+	for i := 0; i < outlierMinRequests/2; i++ {
+		od.record("1", false, 4)
+		od.record("1", true, 4)
+	}
+
+	if od.isEjected("1") {
+		t.Fatal("Instance ejected at the error threshold")
+	}
+
+	od.record("1", false, 4)
+	od.record("1", true, 4)
+
+	if od.record("1", true, 4); !od.isEjected("1") {
+		t.Fatal("Instance not ejected over the error threshold")
+	}
+}
+
+func TestMaxEjected(t *testing.T) {
+	od, _ := testOutlierDetector()
+
+	for _, uuid := range []string{"1", "2", "3"} {
+		for i := 0; i < 3; i++ {
+			od.record(uuid, true, 4)
+		}
+	}
+
+	if !od.isEjected("1") || !od.isEjected("2") || od.isEjected("3") {
+		t.Fatal("More than half of the instances ejected")
+	}
+}
+
+func TestEjectionBackoff(t *testing.T) {
+	od, clock := testOutlierDetector()
+
+	fail := func() {
+		for i := 0; i < 3; i++ {
+			od.record("1", true, 2)
+		}
+	}
+
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		fail()
+
+		if d := od.ejectedFor("1"); d != expected {
+			t.Fatal("Unexpected ejection duration", d, "expected", expected)
+		}
+
+		if restored, next := od.restore(); len(restored) != 0 || next != clock.Now().Add(expected) {
+			t.Fatal("Instance restored early", restored, next)
+		}
+
+		clock.Advance(expected)
+
+		if restored, next := od.restore(); len(restored) != 1 || !next.IsZero() || od.isEjected("1") {
+			t.Fatal("Instance not restored", restored, next)
+		}
+	}
+
+	// staying healthy for as long as the last ejection starts over
+	clock.Advance(4 * time.Second)
+	fail()
+
+	if d := od.ejectedFor("1"); d != time.Second {
+		t.Fatal("Ejection backoff not reset", d)
+	}
+}
+
+func TestServiceClientEjectsOutliers(t *testing.T) {
+	criteria := &skynet.Criteria{Services: []skynet.ServiceCriteria{
+		skynet.ServiceCriteria{Name: "TestService"},
+	}}
+
+	sc := NewServiceClient(criteria).(*ServiceClient)
+	defer sc.Close()
+
+	var clock *test.Clock
+	sc.outliers, clock = testOutlierDetector()
+
+	restore := make(chan time.Time)
+	sc.after = func(d time.Duration) <-chan time.Time {
+		return restore
+	}
+
+	// changes to the load balancer, made by mux()
+	changes := make(chan string, 10)
+	sc.loadBalancer = &test.LoadBalancer{
+		AddInstanceFunc: func(s skynet.ServiceInfo) {
+			changes <- "+" + s.UUID
+		},
+		RemoveInstanceFunc: func(s skynet.ServiceInfo) {
+			changes <- "-" + s.UUID
+		},
+	}
+
+	expectChange := func(change, msg string) {
+		select {
+		case c := <-changes:
+			if c != change {
+				t.Fatal(msg, c)
+			}
+		case <-time.After(time.Second):
+			t.Fatal(msg)
+		}
+	}
+
+	for _, uuid := range []string{"1", "2"} {
+		sc.Notify(skynet.InstanceNotification{Type: skynet.InstanceAdded, Service: skynet.ServiceInfo{UUID: uuid, Name: "TestService", Registered: true}})
+		expectChange("+"+uuid, "Instance not added to the load balancer")
+	}
+
+	for i := 0; i < 3; i++ {
+		sc.requestResults <- requestResult{uuid: "1", failed: true}
+	}
+
+	expectChange("-1", "Instance not ejected from the load balancer")
+
+	clock.Advance(time.Second)
+	restore <- clock.Now()
+
+	expectChange("+1", "Instance not restored to the load balancer")
+}
@@ -141,7 +141,10 @@ func (p *Pool) RemoveInstance(s skynet.ServiceInfo) {
 }
 
 func (p *Pool) removeInstanceMux(s skynet.ServiceInfo) {
-	delete(p.servicePools, s.AddrString())
+	if sp, ok := p.servicePools[s.AddrString()]; ok {
+		sp.Close()
+		delete(p.servicePools, s.AddrString())
+	}
 }
 
 /*
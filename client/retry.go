@@ -0,0 +1,155 @@
+package client
+
+import (
+	"github.com/skynetservices/skynet/config"
+	"github.com/skynetservices/skynet/stats"
+	"sync"
+	"time"
+)
+
+const (
+	// the number of recent request latencies the hedge delay is taken from, and the number of
+	// requests that must have succeeded before hedging
+	hedgeWindow     = 100
+	hedgeMinSamples = 20
+
+	// the most retries that may be saved up while requests are succeeding
+	retryBudgetCapacity = 10
+)
+
+type retryConfig struct {
+	hedgePercentile int
+	budgetPercent   int
+	minPerSecond    int
+}
+
+func getRetryConfig(service, version string) (rc retryConfig) {
+	rc = retryConfig{
+		hedgePercentile: config.DefaultHedgePercentile,
+		budgetPercent:   config.DefaultRetryBudgetPercent,
+		minPerSecond:    config.DefaultRetryBudgetMinPerSecond,
+	}
+
+	if n, err := config.Int(service, version, "client.hedge.percentile"); err == nil {
+		rc.hedgePercentile = n
+	}
+
+	if n, err := config.Int(service, version, "client.retry.budget"); err == nil {
+		rc.budgetPercent = n
+	}
+
+	if n, err := config.Int(service, version, "client.retry.budget.min"); err == nil {
+		rc.minPerSecond = n
+	}
+
+	return
+}
+
+/*
+retryBudget limits retries to a percentage of requests, so that retries don't add to the load on
+a service that is already failing. Every request deposits a fraction of a token, and every retry
+takes a whole one. minPerSecond tokens are added every second so that a client sending few
+requests can still retry.
+*/
+type retryBudget struct {
+	config retryConfig
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+
+	// replaced in tests
+	now func() time.Time
+}
+
+func newRetryBudget(rc retryConfig) *retryBudget {
+	return &retryBudget{
+		config: rc,
+		tokens: retryBudgetCapacity,
+		last:   time.Now(),
+		now:    time.Now,
+	}
+}
+
+// deposit must be called with mutex held
+func (rb *retryBudget) deposit(tokens float64) {
+	rb.tokens += tokens
+
+	if rb.tokens > retryBudgetCapacity {
+		rb.tokens = retryBudgetCapacity
+	}
+}
+
+// refill must be called with mutex held
+func (rb *retryBudget) refill() {
+	now := rb.now()
+
+	rb.deposit(now.Sub(rb.last).Seconds() * float64(rb.config.minPerSecond))
+	rb.last = now
+}
+
+/*
+retryBudget.request() records that a request is being sent
+*/
+func (rb *retryBudget) request() {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+
+	rb.refill()
+	rb.deposit(float64(rb.config.budgetPercent) / 100)
+}
+
+/*
+retryBudget.retry() returns true if a request may be retried, taking a token from the budget
+*/
+func (rb *retryBudget) retry() bool {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+
+	// a budget of 0 doesn't limit retries
+	if rb.config.budgetPercent <= 0 {
+		return true
+	}
+
+	rb.refill()
+
+	if rb.tokens < 1 {
+		return false
+	}
+
+	rb.tokens--
+
+	return true
+}
+
+/*
+hedger decides how long to wait for a request before sending another attempt, from the latencies
+of recent requests
+*/
+type hedger struct {
+	percentile int
+	latencies  *stats.Window
+}
+
+func newHedger(rc retryConfig) *hedger {
+	return &hedger{
+		percentile: rc.hedgePercentile,
+		latencies:  stats.NewWindow(hedgeWindow),
+	}
+}
+
+func (h *hedger) add(d time.Duration) {
+	h.latencies.Add(d)
+}
+
+/*
+hedger.delay() returns how long to wait before sending a second attempt of a request, or 0 if
+hedging is disabled or too few requests have succeeded to tell
+*/
+func (h *hedger) delay() time.Duration {
+	if h.percentile <= 0 || h.latencies.Len() < hedgeMinSamples {
+		return 0
+	}
+
+	return h.latencies.Percentiles(float64(h.percentile))[0]
+}
@@ -0,0 +1,176 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/client/conn"
+	"github.com/skynetservices/skynet/test"
+	"testing"
+	"time"
+)
+
+func testRetryBudget(percent, minPerSecond int) (*retryBudget, *test.Clock) {
+	clock := test.NewClock()
+
+	rb := newRetryBudget(retryConfig{
+		budgetPercent: percent,
+		minPerSecond:  minPerSecond,
+	})
+	rb.last = clock.Now()
+	rb.now = clock.Now
+
+	return rb, clock
+}
+
+func drain(rb *retryBudget) {
+	for rb.retry() {
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	rb, _ := testRetryBudget(50, 0)
+
+	for i := 0; i < retryBudgetCapacity; i++ {
+		if !rb.retry() {
+			t.Fatal("Retry refused with budget saved up")
+		}
+	}
+
+	if rb.retry() {
+		t.Fatal("Retry allowed with budget spent")
+	}
+
+	rb.request()
+	rb.request()
+
+	if !rb.retry() {
+		t.Fatal("Retry refused after requests added to the budget")
+	}
+
+	if rb.retry() {
+		t.Fatal("Allowed more retries than the budget percentage")
+	}
+}
+
+func TestRetryBudgetMinPerSecond(t *testing.T) {
+	rb, clock := testRetryBudget(10, 2)
+	drain(rb)
+
+	clock.Advance(time.Second)
+
+	if !rb.retry() || !rb.retry() {
+		t.Fatal("Minimum retries per second refused")
+	}
+
+	if rb.retry() {
+		t.Fatal("Allowed more than the minimum retries per second")
+	}
+}
+
+func TestRetryBudgetDisabled(t *testing.T) {
+	rb, _ := testRetryBudget(0, 0)
+
+	for i := 0; i < retryBudgetCapacity*2; i++ {
+		if !rb.retry() {
+			t.Fatal("Disabled budget refused a retry")
+		}
+	}
+}
+
+func TestHedgerDelay(t *testing.T) {
+	h := newHedger(retryConfig{hedgePercentile: 95})
+
+	for i := 1; i < hedgeMinSamples; i++ {
+		h.add(time.Duration(i) * time.Millisecond)
+	}
+
+	if h.delay() != 0 {
+		t.Fatal("Hedging before enough requests succeeded", h.delay())
+	}
+
+	for i := hedgeMinSamples; i <= hedgeWindow; i++ {
+		h.add(time.Duration(i) * time.Millisecond)
+	}
+
+	if h.delay() != 95*time.Millisecond {
+		t.Fatal("Unexpected hedge delay", h.delay())
+	}
+
+	h.percentile = 0
+
+	if h.delay() != 0 {
+		t.Fatal("Hedging while disabled", h.delay())
+	}
+}
+
+func TestSendHedges(t *testing.T) {
+	sc := GetService("foo", "1.0.0", "", "")
+	stubForSend(sc, func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+		return
+	})
+
+	abandoned := make(chan bool, 1)
+	pool.(*test.Pool).AcquireFunc = func(s skynet.ServiceInfo) (conn.Connection, error) {
+		return &test.Connection{
+			SendContextFunc: func(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+				if ri.RetryCount > 0 {
+					return
+				}
+
+				// the first attempt is slow
+				<-ctx.Done()
+				abandoned <- true
+
+				return ctx.Err()
+			},
+		}, nil
+	}
+
+	c := sc.(*ServiceClient)
+	for i := 0; i < hedgeMinSamples; i++ {
+		c.hedger.add(time.Millisecond)
+	}
+
+	c.idempotent["bar"] = true
+	sc.SetDefaultTimeout(time.Minute, 0)
+
+	var response string
+	if err := sc.Send(nil, "bar", "", &response); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-abandoned:
+	case <-time.After(time.Second):
+		t.Fatal("Slow attempt was not abandoned")
+	}
+}
+
+func TestSendRetryBudgetExhausted(t *testing.T) {
+	sc := GetService("foo", "1.0.0", "", "")
+
+	sendErr := errors.New("failed")
+	sent := 0
+	stubForSend(sc, func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+		sent++
+		return sendErr
+	})
+
+	c := sc.(*ServiceClient)
+	c.budget.config.minPerSecond = 0
+	drain(c.budget)
+
+	c.idempotent["bar"] = true
+
+	sc.SetDefaultTimeout(time.Minute, time.Minute)
+
+	var response string
+	if err := sc.Send(nil, "bar", "", &response); err != sendErr {
+		t.Fatal("Expected the error of the only attempt", err)
+	}
+
+	if sent != 1 {
+		t.Fatal("Request retried without budget", sent)
+	}
+}
@@ -1,9 +1,11 @@
 package client
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/client/conn"
 	"github.com/skynetservices/skynet/client/loadbalancer"
 	"github.com/skynetservices/skynet/config"
 	"github.com/skynetservices/skynet/log"
@@ -18,6 +20,7 @@ import (
 var (
 	ServiceClientClosed = errors.New("Service client shutdown")
 	RequestTimeout      = errors.New("Request timed out")
+	CircuitOpen         = errors.New("Circuit open")
 )
 
 /*
@@ -32,6 +35,8 @@ type ServiceClientProvider interface {
 
 	Send(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error)
 	SendOnce(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error)
+	SendContext(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error)
+	SendOnceContext(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error)
 
 	Notify(n skynet.InstanceNotification)
 	Matches(n skynet.ServiceInfo) bool
@@ -41,53 +46,113 @@ type ServiceClient struct {
 	loadBalancer loadbalancer.LoadBalancer
 	criteria     *skynet.Criteria
 	shutdown     bool
-	closed       bool
 
 	retryTimeout  time.Duration
 	giveupTimeout time.Duration
 
+	// instances matching the criteria, and those given to the load balancer. Where the criteria
+	// matches a range of versions only the highest version available is given to the load balancer.
+	instances map[string]skynet.ServiceInfo
+	balanced  map[string]skynet.ServiceInfo
+
+	// instances that fail too many requests are ejected from the load balancer for a while
+	outliers     *outlierDetector
+	restoreTimer <-chan time.Time
+
+	// replaced in tests
+	after func(time.Duration) <-chan time.Time
+
+	// requests fail immediately while the service, or an instance, is failing
+	breaker          *circuitBreaker
+	breakersMutex    sync.Mutex
+	instanceBreakers map[string]*circuitBreaker
+
+	// retries are limited to a share of requests, and sent early for requests slower than most
+	budget *retryBudget
+	hedger *hedger
+
+	// methods every balanced instance declares idempotent, only these are retried once sent
+	idempotentMutex sync.Mutex
+	idempotent      map[string]bool
+
 	waiter sync.WaitGroup
 
 	// mux channels
 	muxChan               chan interface{}
 	instanceNotifications chan skynet.InstanceNotification
+	requestResults        chan requestResult
 	timeoutChan           chan timeoutLengths
 	shutdownChan          chan bool
+
+	// closed once mux() has stopped after Close(), requests to it are refused from then on
+	stoppedChan chan bool
 }
 
 /*
 client.NewServiceClient Initializes a new ClientService
 */
 func NewServiceClient(c *skynet.Criteria) ServiceClientProvider {
+	rc := getRetryConfig(c.Services[0].Name, c.Services[0].Version)
+
 	sc := &ServiceClient{
 		criteria:              c,
 		instanceNotifications: make(chan skynet.InstanceNotification, 100),
+		requestResults:        make(chan requestResult, 100),
 		timeoutChan:           make(chan timeoutLengths),
 		shutdownChan:          make(chan bool),
+		stoppedChan:           make(chan bool),
 		muxChan:               make(chan interface{}),
 		loadBalancer:          LoadBalancerFactory([]skynet.ServiceInfo{}),
+		instances:             make(map[string]skynet.ServiceInfo),
+		balanced:              make(map[string]skynet.ServiceInfo),
+		outliers:              newOutlierDetector(getOutlierConfig(c.Services[0].Name, c.Services[0].Version)),
+		breaker:               newCircuitBreaker(getCircuitConfig(c.Services[0].Name, c.Services[0].Version), c.Services[0].String(), ""),
+		instanceBreakers:      make(map[string]*circuitBreaker),
+		budget:                newRetryBudget(rc),
+		idempotent:            make(map[string]bool),
+		hedger:                newHedger(rc),
+		after:                 time.After,
 
 		retryTimeout:  getRetryTimeout(c.Services[0].Name, c.Services[0].Version),
 		giveupTimeout: getGiveupTimeout(c.Services[0].Name, c.Services[0].Version),
 	}
 
+	if lb, ok := sc.loadBalancer.(loadbalancer.CriteriaAware); ok {
+		lb.SetCriteria(c)
+	}
+
 	go sc.mux()
 
 	return sc
 }
 
 /*
-ServiceClient.Send() will send a request to one of the available instances. In intervals of retry time,
-it will send additional requests to other known instances. If no response is heard after
-the giveup time has passed, it will return an error.
+ServiceClient.Send() will send a request to one of the available instances. If every instance declares
+the method idempotent, in intervals of retry time it will send additional requests to other known
+instances, sooner if the request is slower than most recent requests, for as long as the retry budget
+allows. Other methods are only retried if the request couldn't be sent. Once a response is heard,
+requests still in flight are abandoned. If no response is heard after
+the giveup time has passed, it will return an error. Setting ri.RoutingKey sends requests with the
+same key to the same instance when using a load balancer such as consistenthash. The time it will
+give up is sent to the service in ri.Deadline, and a ri that already has a Deadline, such as that of a
+request being served, gives up no later than that.
 */
 func (c *ServiceClient) Send(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
-	if c.closed {
-		return ServiceClientClosed
+	return c.SendContext(context.Background(), ri, fn, in, out)
+}
+
+/*
+ServiceClient.SendContext() acts like ServiceClient.Send(), but stops retrying and abandons requests in
+flight once ctx is done, returning ctx.Err(). The deadline of ctx is sent to the service in
+RequestInfo.Deadline, so that it may give up on the request too.
+*/
+func (c *ServiceClient) SendContext(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+	tls, err := c.timeouts()
+	if err != nil {
+		return
 	}
 
-	retry, giveup := c.GetDefaultTimeout()
-	return c.send(retry, giveup, ri, fn, in, out)
+	return c.send(ctx, tls.retry, tls.giveup, ri, fn, in, out)
 }
 
 /*
@@ -95,11 +160,20 @@ ServiceClient.SendOnce() will send a request to one of the available instances.
 the giveup time has passed, it will return an error.
 */
 func (c *ServiceClient) SendOnce(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
-	if c.closed {
-		return ServiceClientClosed
+	return c.SendOnceContext(context.Background(), ri, fn, in, out)
+}
+
+/*
+ServiceClient.SendOnceContext() acts like ServiceClient.SendOnce(), but abandons the request once ctx
+is done, returning ctx.Err()
+*/
+func (c *ServiceClient) SendOnceContext(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+	tls, err := c.timeouts()
+	if err != nil {
+		return
 	}
-	_, giveup := c.GetDefaultTimeout()
-	return c.send(0, giveup, ri, fn, in, out)
+
+	return c.send(ctx, 0, tls.giveup, ri, fn, in, out)
 }
 
 /*
@@ -108,28 +182,44 @@ the time before ServiceClient.Send() and ServiceClient.SendOnce() give up. Setti
 or giveup to 0 indicates no retry or time out.
 */
 func (c *ServiceClient) SetDefaultTimeout(retry, giveup time.Duration) {
-	c.muxChan <- timeoutLengths{
-		retry:  retry,
-		giveup: giveup,
+	select {
+	case c.muxChan <- timeoutLengths{retry: retry, giveup: giveup}:
+	case <-c.stoppedChan:
 	}
 }
 
 /*
-ServiceClient.GetTimeout() returns current timeout values
+ServiceClient.GetTimeout() returns current timeout values, which are 0 once the ServiceClient is closed
 */
 func (c *ServiceClient) GetDefaultTimeout() (retry, giveup time.Duration) {
-	tls := <-c.timeoutChan
-	retry, giveup = tls.retry, tls.giveup
+	tls, _ := c.timeouts()
+	return tls.retry, tls.giveup
+}
+
+// timeouts returns the current timeout values, or ServiceClientClosed once mux() has stopped
+func (c *ServiceClient) timeouts() (tls timeoutLengths, err error) {
+	select {
+	case tls = <-c.timeoutChan:
+	case <-c.stoppedChan:
+		err = ServiceClientClosed
+	}
 
 	return
 }
 
 /*
-ServiceClient.Close() refuses any new requests, and waits for active requests to finish
+ServiceClient.Close() refuses any new requests, waits for active requests to finish, and stops
+watching for instances that match its criteria. Closing a ServiceClient more than once has no effect.
 */
 func (c *ServiceClient) Close() {
-	c.shutdownChan <- true
+	select {
+	case c.shutdownChan <- true:
+	case <-c.stoppedChan:
+	}
+
 	c.waiter.Wait()
+
+	removeServiceClient(c)
 }
 
 /*
@@ -155,58 +245,152 @@ func (c *ServiceClient) Matches(s skynet.ServiceInfo) bool {
 ServiceClient.Notify() Update available instances based off provided InstanceNotification
 */
 func (c *ServiceClient) Notify(n skynet.InstanceNotification) {
-	c.instanceNotifications <- n
+	select {
+	case c.instanceNotifications <- n:
+	case <-c.stoppedChan:
+	}
 }
 
-func (c *ServiceClient) send(retry, giveup time.Duration, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+func (c *ServiceClient) send(ctx context.Context, retry, giveup time.Duration, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
 	if ri == nil {
 		ri = c.NewRequestInfo()
+	} else {
+		// the caller may use the RequestInfo for other requests, such as a service passing on the
+		// RequestInfo of the request it's serving
+		r := *ri
+		ri = &r
+	}
+
+	// retries of this call share its CallID, a request made while serving one has its own
+	ri.CallID = config.NewUUID()
+
+	ctx, cancelDeadline := requestContext(ctx, ri, giveup)
+	defer cancelDeadline()
+
+	if err = ctx.Err(); err != nil {
+		return
 	}
 
+	if err = c.breaker.allow(); err != nil {
+		return
+	}
+
+	defer func() {
+		c.breaker.record(outcome(err))
+	}()
+
+	// attempts in flight are abandoned once we return, and we wait for them to unwind so that none
+	// outlive the request
+	var inFlightAttempts sync.WaitGroup
+	defer inFlightAttempts.Wait()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	attempts := make(chan sendAttempt)
 
-	var retryTicker <-chan time.Time
+	// closed once we return, so that attempts still in flight don't wait forever to report
+	done := make(chan bool)
+	defer close(done)
+
+	c.budget.request()
+
+	// retrying a method that isn't idempotent could run it twice, unless the request was never sent
+	retryUnsent := false
+	if retry > 0 && !c.isIdempotent(fn) {
+		log.Println(log.TRACE, fmt.Sprintf("Only retrying %q if it isn't sent, it isn't declared idempotent", fn))
+		retry, retryUnsent = 0, true
+	}
+
+	var retryTicker, hedgeTimer <-chan time.Time
 	retryChan := make(chan bool, 1)
 	if retry > 0 {
-		retryTicker = time.Tick(retry)
+		ticker := time.NewTicker(retry)
+		defer ticker.Stop()
+
+		retryTicker = ticker.C
+
+		// don't wait for the retry time if the first attempt is slower than most requests
+		if delay := c.hedger.delay(); delay > 0 && delay < retry {
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+
+			hedgeTimer = timer.C
+		}
 	}
 
-	var timeoutTimer <-chan time.Time
-	if giveup > 0 {
-		timeoutTimer = time.NewTimer(giveup).C
+	attemptCount, inFlight := 0, 0
+	var lastErr error
+
+	startAttempt := func() {
+		// each attempt has its own RequestInfo, they're sent concurrently
+		r := *ri
+		r.RetryCount = attemptCount
+
+		attemptCount++
+		inFlight++
+
+		inFlightAttempts.Add(1)
+		go func() {
+			defer inFlightAttempts.Done()
+			c.attemptSend(ctx, retry, attempts, done, &r, fn, in, out)
+		}()
 	}
 
-	attemptCount := 1
-	go c.attemptSend(retry, attempts, ri, fn, in, out)
+	startAttempt()
 
 	for {
 		select {
 		case <-retryTicker:
-			retryChan <- true
+			retryNow(retryChan)
+
+		case <-hedgeTimer:
+			retryNow(retryChan)
 
 		case <-retryChan:
-			attemptCount++
-			ri.RetryCount++
-			log.Println(log.TRACE, fmt.Sprintf("Sending Attempt# %d with RequestInfo %+v", attemptCount, ri))
-			go c.attemptSend(retry, attempts, ri, fn, in, out)
-
-		case <-timeoutTimer:
-			err = RequestTimeout
-			log.Println(log.WARN, fmt.Sprintf("Timing out request after %d attempts within %s ", attemptCount, giveup.String()))
+			if !c.budget.retry() {
+				log.Println(log.WARN, fmt.Sprintf("Retry budget exhausted, not retrying request %s", ri.RequestID))
+
+				// there's nothing left to wait for
+				if inFlight == 0 {
+					return lastErr
+				}
+
+				continue
+			}
+
+			log.Println(log.TRACE, fmt.Sprintf("Sending Attempt# %d with RequestInfo %+v", attemptCount+1, ri))
+			startAttempt()
+
+		case <-ctx.Done():
+			if conn.IsTimeout(context.Cause(ctx)) {
+				err = RequestTimeout
+				log.Println(log.WARN, fmt.Sprintf("Timing out request after %d attempts within %s ", attemptCount, giveup.String()))
+				return
+			}
+
+			err = ctx.Err()
+			log.Println(log.WARN, fmt.Sprintf("Abandoning request after %d attempts: %s", attemptCount, err))
 			return
 
 		case attempt := <-attempts:
+			inFlight--
+
 			if attempt.err != nil {
 				log.Println(log.ERROR, "Attempt Error: ", attempt.err)
 
-				// If there is no retry timer we need to exit as retries were disabled
-				if retryTicker == nil {
-					return err
-				} else {
-					// Don't wait for next retry tick retry now
-					retryChan <- true
+				// If there is no retry timer we need to exit as retries were disabled, unless they're
+				// only disabled for requests that were sent. There's no use retrying when the circuit
+				// of every instance is open.
+				if (retryTicker == nil && (!retryUnsent || attempt.sent)) || attempt.err == CircuitOpen {
+					return attempt.err
 				}
 
+				lastErr = attempt.err
+
+				// Don't wait for next retry tick retry now
+				retryNow(retryChan)
+
 				continue
 			}
 
@@ -219,39 +403,229 @@ func (c *ServiceClient) send(retry, giveup time.Duration, ri *skynet.RequestInfo
 	}
 }
 
+/*
+requestContext returns a context that is done by the deadline ri already has, such as that of a
+request being served, or once giveup has passed, and sets ri.Deadline to the earliest of those and
+the deadline of ctx. Once giveup has passed, context.Cause() of the context is a conn.TimeoutError.
+*/
+func requestContext(ctx context.Context, ri *skynet.RequestInfo, giveup time.Duration) (context.Context, context.CancelFunc) {
+	cancelDeadline := context.CancelFunc(func() {})
+	cancelGiveup := context.CancelFunc(func() {})
+
+	if !ri.Deadline.IsZero() {
+		ctx, cancelDeadline = context.WithDeadline(ctx, ri.Deadline)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		ri.Deadline = deadline
+	}
+
+	if giveup > 0 {
+		ctx, cancelGiveup = context.WithTimeoutCause(ctx, giveup, conn.TimeoutError{Timeout: giveup})
+
+		if deadline, _ := ctx.Deadline(); ri.Deadline.IsZero() || deadline.Before(ri.Deadline) {
+			ri.Deadline = deadline
+		}
+	}
+
+	return ctx, func() {
+		cancelGiveup()
+		cancelDeadline()
+	}
+}
+
+// timedOut returns the conn.TimeoutError of a request abandoned because the giveup time of ctx
+// passed, which unlike the caller giving up is the instance's doing, or err otherwise
+func timedOut(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); loadbalancer.Abandoned(err) && conn.IsTimeout(cause) {
+		return cause
+	}
+
+	return err
+}
+
+// retryNow asks for another attempt, unless one has already been asked for
+func retryNow(retryChan chan bool) {
+	select {
+	case retryChan <- true:
+	default:
+	}
+}
+
 type sendAttempt struct {
 	err    error
 	result interface{}
+
+	// false if the attempt failed before the request was written to a connection
+	sent bool
 }
 
-func (c *ServiceClient) attemptSend(timeout time.Duration, attempts chan sendAttempt, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) {
-	s, err := c.loadBalancer.Choose()
+func (c *ServiceClient) attemptSend(ctx context.Context, timeout time.Duration, attempts chan sendAttempt, done chan bool, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) {
+	report := func(a sendAttempt) {
+		select {
+		case attempts <- a:
+		case <-done:
+		}
+	}
+
+	s, err := c.choose(ri)
 
 	if err != nil {
-		attempts <- sendAttempt{err: err}
+		report(sendAttempt{err: err})
 		return
 	}
 
+	start := time.Now()
+
 	conn, err := acquire(s)
-	defer release(conn)
 
 	if err != nil {
-		attempts <- sendAttempt{err: err}
+		c.completed(s, time.Now().Sub(start), err)
+		report(sendAttempt{err: err})
 		return
 	}
 
+	defer release(conn)
+
 	// Create a new instance of the type, we dont want race conditions where 2 connections are unmarshalling to the same object
 	res := sendAttempt{
 		result: reflect.New(reflect.Indirect(reflect.ValueOf(out)).Type()).Interface(),
 	}
 
-	err = conn.SendTimeout(ri, fn, in, res.result, timeout)
+	err = timedOut(ctx, sendContext(ctx, conn, timeout, ri, fn, in, res.result))
 
 	if err != nil {
 		res.err = err
 	}
 
-	attempts <- res
+	res.sent = !unsent(err)
+
+	c.completed(s, time.Now().Sub(start), err)
+
+	report(res)
+}
+
+// sendContext sends a request that gives up, with a conn.TimeoutError, once timeout has passed
+func sendContext(ctx context.Context, cn conn.Connection, timeout time.Duration, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+	if timeout <= 0 {
+		return cn.SendContext(ctx, ri, fn, in, out)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err = cn.SendContext(attemptCtx, ri, fn, in, out)
+
+	// only the attempt timed out, not the request
+	if err == context.DeadlineExceeded && ctx.Err() == nil {
+		err = conn.TimeoutError{Timeout: timeout}
+	}
+
+	return
+}
+
+// unsent returns true if err means the connection refused the request before writing it
+func unsent(err error) bool {
+	return err == conn.ConnectionClosed
+}
+
+// outcome returns requestFailed if err means something is wrong with the instance or service. Errors
+// returned by the service don't, and requests abandoned by the caller say nothing either way.
+func outcome(err error) requestOutcome {
+	switch {
+	case err == nil || conn.IsServiceError(err):
+		return requestSucceeded
+	case loadbalancer.Abandoned(err):
+		return requestAbandoned
+	}
+
+	return requestFailed
+}
+
+// the most instances choose() asks the load balancer for before giving up on finding one
+// whose circuit isn't open
+const maxChoices = 10
+
+// choose returns an instance from the load balancer whose circuit isn't open
+func (c *ServiceClient) choose(ri *skynet.RequestInfo) (s skynet.ServiceInfo, err error) {
+	for i := 0; i < maxChoices; i++ {
+		if s, err = c.loadBalancer.Choose(ri); err != nil {
+			return
+		}
+
+		if err = c.instanceBreaker(s.UUID).allow(); err == nil {
+			return
+		}
+
+		// the load balancer still counts the request as outstanding, but it says nothing about
+		// how the instance is doing
+		c.loadBalancer.Complete(s, 0, loadbalancer.NotSent)
+	}
+
+	return s, CircuitOpen
+}
+
+func (c *ServiceClient) instanceBreaker(uuid string) *circuitBreaker {
+	c.breakersMutex.Lock()
+	defer c.breakersMutex.Unlock()
+
+	cb, ok := c.instanceBreakers[uuid]
+	if !ok {
+		cb = newCircuitBreaker(c.breaker.config, c.breaker.service, uuid)
+		c.instanceBreakers[uuid] = cb
+	}
+
+	return cb
+}
+
+/*
+ServiceClient.CircuitStates() returns the state of the circuit breaker for the service, and those
+for each instance requests have been sent to
+*/
+func (c *ServiceClient) CircuitStates() (service BreakerState, instances map[string]BreakerState) {
+	c.breakersMutex.Lock()
+	defer c.breakersMutex.Unlock()
+
+	instances = make(map[string]BreakerState)
+	for uuid, cb := range c.instanceBreakers {
+		instances[uuid] = cb.currentState()
+	}
+
+	return c.breaker.currentState(), instances
+}
+
+type requestResult struct {
+	uuid   string
+	failed bool
+}
+
+// completed reports the result of a request to the load balancer, the instance's circuit breaker
+// and outlier detection
+func (c *ServiceClient) completed(s skynet.ServiceInfo, duration time.Duration, err error) {
+	c.loadBalancer.Complete(s, duration, err)
+	c.recordResult(s, duration, err)
+}
+
+// recordResult reports the result of a request to the instance's circuit breaker and outlier
+// detection, for requests sent to instances the load balancer didn't choose
+func (c *ServiceClient) recordResult(s skynet.ServiceInfo, duration time.Duration, err error) {
+	o := outcome(err)
+
+	if o == requestSucceeded {
+		c.hedger.add(duration)
+	}
+
+	c.instanceBreaker(s.UUID).record(o)
+
+	if o == requestAbandoned {
+		return
+	}
+
+	// results are only a sample, don't hold up the request if mux() is busy
+	select {
+	case c.requestResults <- requestResult{uuid: s.UUID, failed: o == requestFailed}:
+	default:
+	}
 }
 
 type timeoutLengths struct {
@@ -266,10 +640,18 @@ func (c *ServiceClient) mux() {
 			case timeoutLengths:
 				c.retryTimeout = m.retry
 				c.giveupTimeout = m.giveup
+			case balancedInstances:
+				m <- c.registeredInstances()
 			}
 		case n := <-c.instanceNotifications:
 			c.handleInstanceNotification(n)
 
+		case r := <-c.requestResults:
+			c.handleRequestResult(r)
+
+		case <-c.restoreTimer:
+			c.restoreInstances()
+
 		case c.timeoutChan <- timeoutLengths{
 			retry:  c.retryTimeout,
 			giveup: c.giveupTimeout,
@@ -278,7 +660,7 @@ func (c *ServiceClient) mux() {
 		case shutdown := <-c.shutdownChan:
 			// TODO: Close out all channels, and this goroutine after waiting for requests to finish
 			if shutdown {
-				c.closed = true
+				close(c.stoppedChan)
 				return
 			}
 		}
@@ -287,15 +669,192 @@ func (c *ServiceClient) mux() {
 
 // this should only be called by mux()
 func (c *ServiceClient) handleInstanceNotification(n skynet.InstanceNotification) {
-	// TODO: ensure LoadBalancer is thread safe and call these as goroutines
 	switch n.Type {
-	case skynet.InstanceAdded:
-		c.loadBalancer.AddInstance(n.Service)
-	case skynet.InstanceUpdated:
-		c.loadBalancer.UpdateInstance(n.Service)
+	case skynet.InstanceAdded, skynet.InstanceUpdated:
+		c.instances[n.Service.UUID] = n.Service
 	case skynet.InstanceRemoved:
-		c.loadBalancer.RemoveInstance(n.Service)
+		delete(c.instances, n.Service.UUID)
+		c.outliers.remove(n.Service.UUID)
+
+		c.breakersMutex.Lock()
+		delete(c.instanceBreakers, n.Service.UUID)
+		c.breakersMutex.Unlock()
+	}
+
+	c.rebalance(n.Service.UUID)
+}
+
+// this should only be called by mux()
+func (c *ServiceClient) handleRequestResult(r requestResult) {
+	s, ok := c.instances[r.uuid]
+	if !ok {
+		return
+	}
+
+	if c.outliers.record(r.uuid, r.failed, len(c.instances)) {
+		log.Printf(log.WARN, "%+v", InstanceEjected{s, c.outliers.ejectedFor(r.uuid)})
+
+		c.rebalance("")
+		c.restoreInstances()
+	}
+}
+
+// restoreInstances returns instances whose ejection has ended to the load balancer, and sets
+// restoreTimer for when the next ejection ends. this should only be called by mux()
+func (c *ServiceClient) restoreInstances() {
+	restored, next := c.outliers.restore()
+
+	for _, uuid := range restored {
+		if s, ok := c.instances[uuid]; ok {
+			log.Printf(log.INFO, "%+v", InstanceRestored{s})
+		}
+	}
+
+	if len(restored) > 0 {
+		c.rebalance("")
+	}
+
+	c.restoreTimer = nil
+	if !next.IsZero() {
+		c.restoreTimer = c.after(next.Sub(c.outliers.now()))
+	}
+}
+
+// rebalance gives the load balancer the preferred instances that aren't ejected, updated is the
+// UUID of an instance that has changed. this should only be called by mux()
+func (c *ServiceClient) rebalance(updated string) {
+	candidates := make(map[string]skynet.ServiceInfo)
+	for uuid, s := range c.instances {
+		if !c.outliers.isEjected(uuid) {
+			candidates[uuid] = s
+		}
+	}
+
+	preferred := preferredInstances(c.criteria, candidates)
+
+	// TODO: ensure LoadBalancer is thread safe and call these as goroutines
+	for uuid, s := range c.balanced {
+		if !preferred[uuid] {
+			c.loadBalancer.RemoveInstance(s)
+			delete(c.balanced, uuid)
+		}
+	}
+
+	for uuid := range preferred {
+		s := c.instances[uuid]
+
+		if _, ok := c.balanced[uuid]; !ok {
+			c.loadBalancer.AddInstance(s)
+		} else if uuid == updated {
+			c.loadBalancer.UpdateInstance(s)
+		}
+
+		c.balanced[uuid] = s
+	}
+
+	c.updateIdempotent()
+}
+
+// updateIdempotent must be called from mux()
+func (c *ServiceClient) updateIdempotent() {
+	idempotent := make(map[string]bool)
+
+	first := true
+	for _, s := range c.balanced {
+		if first {
+			for _, m := range s.IdempotentMethods {
+				idempotent[m] = true
+			}
+
+			first = false
+			continue
+		}
+
+		for m := range idempotent {
+			if !s.IsIdempotent(m) {
+				delete(idempotent, m)
+			}
+		}
+	}
+
+	c.idempotentMutex.Lock()
+	c.idempotent = idempotent
+	c.idempotentMutex.Unlock()
+}
+
+func (c *ServiceClient) isIdempotent(method string) bool {
+	c.idempotentMutex.Lock()
+	defer c.idempotentMutex.Unlock()
+
+	return c.idempotent[method]
+}
+
+/*
+client.preferredInstances returns the instances requests should be sent to. Where a ServiceCriteria
+matches a range of versions, only the instances with the highest version of each service are preferred,
+considering registered instances first.
+*/
+func preferredInstances(criteria *skynet.Criteria, instances map[string]skynet.ServiceInfo) map[string]bool {
+	preferred := make(map[string]bool)
+
+	// a ServiceCriteria name may be a pattern matching several services, each with their own versions
+	type versionRange struct {
+		criteria int
+		service  string
 	}
+	ranges := make(map[versionRange][]skynet.ServiceInfo)
+
+	for uuid, s := range instances {
+		if i := versionRangeMatching(criteria, s); i >= 0 {
+			r := versionRange{i, s.Name}
+			ranges[r] = append(ranges[r], s)
+		} else {
+			preferred[uuid] = true
+		}
+	}
+
+	for _, candidates := range ranges {
+		var registered, all []string
+
+		for _, s := range candidates {
+			all = append(all, s.Version)
+
+			if s.Registered {
+				registered = append(registered, s.Version)
+			}
+		}
+
+		highest := skynet.HighestVersion(registered)
+		if highest == "" {
+			highest = skynet.HighestVersion(all)
+		}
+
+		for _, s := range candidates {
+			if s.Version == highest {
+				preferred[s.UUID] = true
+			}
+		}
+	}
+
+	return preferred
+}
+
+// versionRangeMatching returns the index of the first ServiceCriteria matching s if it has a
+// version constraint matching a range of versions, or -1
+func versionRangeMatching(criteria *skynet.Criteria, s skynet.ServiceInfo) int {
+	for i := range criteria.Services {
+		sc := &criteria.Services[i]
+
+		if sc.Matches(s.Name, s.Version) {
+			if sc.Version != "" && sc.IsRange() {
+				return i
+			}
+
+			return -1
+		}
+	}
+
+	return -1
 }
 
 func getRetryTimeout(service, version string) time.Duration {
@@ -1,8 +1,12 @@
 package client
 
 import (
+	"context"
+	"errors"
 	"github.com/skynetservices/skynet"
 	"github.com/skynetservices/skynet/client/conn"
+	"github.com/skynetservices/skynet/client/loadbalancer"
+	"github.com/skynetservices/skynet/client/loadbalancer/roundrobin"
 	"github.com/skynetservices/skynet/test"
 	"labix.org/v2/mgo/bson"
 	"testing"
@@ -104,6 +108,210 @@ func TestInstanceNotificationsUpdateLoadBalancer(t *testing.T) {
 	}
 }
 
+func TestPreferHighestVersion(t *testing.T) {
+	criteria := &skynet.Criteria{Services: []skynet.ServiceCriteria{
+		skynet.ServiceCriteria{Name: "TestService", Version: "1.x"},
+	}}
+
+	sc := NewServiceClient(criteria).(*ServiceClient)
+
+	balanced := make(map[string]bool)
+	sc.loadBalancer = &test.LoadBalancer{
+		AddInstanceFunc: func(s skynet.ServiceInfo) {
+			balanced[s.UUID] = true
+		},
+		UpdateInstanceFunc: func(s skynet.ServiceInfo) {},
+		RemoveInstanceFunc: func(s skynet.ServiceInfo) {
+			delete(balanced, s.UUID)
+		},
+	}
+
+	instance := func(uuid, version string, registered bool) skynet.ServiceInfo {
+		return skynet.ServiceInfo{UUID: uuid, Name: "TestService", Version: version, Registered: registered}
+	}
+
+	sc.handleInstanceNotification(skynet.InstanceNotification{Type: skynet.InstanceAdded, Service: instance("1", "1.2.0", true)})
+	sc.handleInstanceNotification(skynet.InstanceNotification{Type: skynet.InstanceAdded, Service: instance("2", "1.10.0", false)})
+
+	// the highest version isn't registered yet
+	if len(balanced) != 1 || !balanced["1"] {
+		t.Fatal("Unregistered higher version preferred", balanced)
+	}
+
+	sc.handleInstanceNotification(skynet.InstanceNotification{Type: skynet.InstanceUpdated, Service: instance("2", "1.10.0", true)})
+	sc.handleInstanceNotification(skynet.InstanceNotification{Type: skynet.InstanceAdded, Service: instance("3", "1.10.0", true)})
+
+	if len(balanced) != 2 || !balanced["2"] || !balanced["3"] {
+		t.Fatal("Highest version not preferred", balanced)
+	}
+
+	sc.handleInstanceNotification(skynet.InstanceNotification{Type: skynet.InstanceRemoved, Service: instance("2", "1.10.0", true)})
+	sc.handleInstanceNotification(skynet.InstanceNotification{Type: skynet.InstanceRemoved, Service: instance("3", "1.10.0", true)})
+
+	if len(balanced) != 1 || !balanced["1"] {
+		t.Fatal("Did not fall back to lower version", balanced)
+	}
+}
+
+func TestIdempotentMethods(t *testing.T) {
+	criteria := &skynet.Criteria{Services: []skynet.ServiceCriteria{
+		skynet.ServiceCriteria{Name: "TestService"},
+	}}
+
+	sc := NewServiceClient(criteria).(*ServiceClient)
+	sc.loadBalancer = &test.LoadBalancer{}
+
+	instance := func(uuid string, idempotent ...string) skynet.ServiceInfo {
+		return skynet.ServiceInfo{UUID: uuid, Name: "TestService", Registered: true, IdempotentMethods: idempotent}
+	}
+
+	sc.handleInstanceNotification(skynet.InstanceNotification{Type: skynet.InstanceAdded, Service: instance("1", "Get", "Put")})
+
+	if !sc.isIdempotent("Get") || !sc.isIdempotent("Put") || sc.isIdempotent("Charge") {
+		t.Fatal("Unexpected idempotent methods", sc.idempotent)
+	}
+
+	// an older instance that doesn't declare Put
+	sc.handleInstanceNotification(skynet.InstanceNotification{Type: skynet.InstanceAdded, Service: instance("2", "Get")})
+
+	if !sc.isIdempotent("Get") || sc.isIdempotent("Put") {
+		t.Fatal("Method not declared idempotent by every instance treated as idempotent", sc.idempotent)
+	}
+
+	sc.handleInstanceNotification(skynet.InstanceNotification{Type: skynet.InstanceRemoved, Service: instance("2", "Get")})
+
+	if !sc.isIdempotent("Put") {
+		t.Fatal("Idempotent methods not updated when instance removed", sc.idempotent)
+	}
+}
+
+func TestSendDoesNotRetryNonIdempotent(t *testing.T) {
+	sc := GetService("foo", "1.0.0", "", "")
+
+	sendErr := errors.New("failed")
+	sent := 0
+	stubForSend(sc, func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+		sent++
+		return sendErr
+	})
+
+	sc.SetDefaultTimeout(time.Minute, time.Minute)
+
+	var response string
+	if err := sc.Send(nil, "Charge", "", &response); err != sendErr {
+		t.Fatal("Expected the error of the only attempt", err)
+	}
+
+	if sent != 1 {
+		t.Fatal("Method that isn't idempotent was retried", sent)
+	}
+}
+
+func TestSendCallID(t *testing.T) {
+	sc := GetService("foo", "1.0.0", "", "")
+
+	callIDs := make(chan string, 10)
+	stubForSend(sc, func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+		callIDs <- ri.CallID
+
+		if ri.RetryCount == 0 {
+			return errors.New("failed")
+		}
+
+		return
+	})
+
+	sc.(*ServiceClient).idempotent["Get"] = true
+	sc.SetDefaultTimeout(time.Minute, time.Minute)
+
+	// as given to a service serving a request, which makes two calls with it
+	served := &skynet.RequestInfo{RequestID: "id", CallID: "served"}
+
+	var response string
+	for i := 0; i < 2; i++ {
+		if err := sc.Send(served, "Get", "", &response); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first, retry, second := <-callIDs, <-callIDs, <-callIDs
+	if first == "" || first == "served" || retry != first {
+		t.Fatal("Retry not given the CallID of the call", first, retry)
+	}
+
+	if second == first || served.CallID != "served" {
+		t.Fatal("Calls sharing a RequestID given the same CallID", first, second)
+	}
+}
+
+func TestSendRetriesNonIdempotentNotSent(t *testing.T) {
+	sc := GetService("foo", "1.0.0", "", "")
+
+	sent := 0
+	stubForSend(sc, func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+		sent++
+		return
+	})
+
+	// the first connection can't be acquired and the second is closed, neither sends the request
+	acquire := pool.(*test.Pool).AcquireFunc
+	acquired := 0
+	pool.(*test.Pool).AcquireFunc = func(s skynet.ServiceInfo) (conn.Connection, error) {
+		acquired++
+
+		switch acquired {
+		case 1:
+			return nil, errors.New("connection refused")
+		case 2:
+			return &test.Connection{
+				SendContextFunc: func(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+					return conn.ConnectionClosed
+				},
+			}, nil
+		}
+
+		return acquire(s)
+	}
+
+	sc.SetDefaultTimeout(time.Minute, time.Minute)
+
+	var response string
+	if err := sc.Send(nil, "Charge", "", &response); err != nil {
+		t.Fatal("Request that was never sent not retried", err)
+	}
+
+	if acquired != 3 || sent != 1 {
+		t.Fatal("Unexpected attempts", acquired, sent)
+	}
+}
+
+type criteriaAwareLoadBalancer struct {
+	test.LoadBalancer
+	criteria *skynet.Criteria
+}
+
+func (lb *criteriaAwareLoadBalancer) SetCriteria(c *skynet.Criteria) {
+	lb.criteria = c
+}
+
+func TestLoadBalancerGivenCriteria(t *testing.T) {
+	lb := &criteriaAwareLoadBalancer{}
+
+	LoadBalancerFactory = func(instances []skynet.ServiceInfo) loadbalancer.LoadBalancer {
+		return lb
+	}
+	defer func() {
+		LoadBalancerFactory = roundrobin.New
+	}()
+
+	criteria := &skynet.Criteria{Services: []skynet.ServiceCriteria{skynet.ServiceCriteria{Name: "TestService"}}}
+	NewServiceClient(criteria)
+
+	if lb.criteria != criteria {
+		t.Fatal("LoadBalancer was not given the criteria of the ServiceClient")
+	}
+}
+
 func TestCloseRefusesNewRequests(t *testing.T) {
 	s := GetService("foo", "1.0.0", "", "")
 	s.Close()
@@ -121,6 +329,26 @@ func TestCloseRefusesNewRequests(t *testing.T) {
 	}
 }
 
+func TestCloseTwice(t *testing.T) {
+	s := GetService("foo", "1.0.0", "", "")
+	s.Close()
+
+	closed := make(chan bool)
+	go func() {
+		s.Close()
+		s.SetDefaultTimeout(time.Second, time.Second)
+		s.GetDefaultTimeout()
+
+		closed <- true
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Closed ServiceClient blocked")
+	}
+}
+
 func TestSend(t *testing.T) {
 	called := false
 
@@ -165,6 +393,254 @@ func TestSend(t *testing.T) {
 	}
 }
 
+func TestSendReportsCompletion(t *testing.T) {
+	sendErr := errors.New("failed")
+
+	sc := GetService("foo", "1.0.0", "", "")
+	stubForSend(sc, func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+		return sendErr
+	})
+
+	var completed error
+	sc.(*ServiceClient).loadBalancer.(*test.LoadBalancer).CompleteFunc = func(s skynet.ServiceInfo, duration time.Duration, err error) {
+		completed = err
+	}
+
+	var response string
+	sc.SendOnce(nil, "bar", "", &response)
+
+	if completed != sendErr {
+		t.Fatal("LoadBalancer was not told the request failed", completed)
+	}
+}
+
+func TestSendContextCancelled(t *testing.T) {
+	sc := GetService("foo", "1.0.0", "", "")
+
+	abandoned := make(chan bool, 1)
+	stubForSend(sc, func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+		return
+	})
+
+	pool.(*test.Pool).AcquireFunc = func(s skynet.ServiceInfo) (conn.Connection, error) {
+		return &test.Connection{
+			SendContextFunc: func(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+				<-ctx.Done()
+				abandoned <- true
+
+				return ctx.Err()
+			},
+		}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	var response string
+	if err := sc.SendContext(ctx, nil, "bar", "", &response); err != context.Canceled {
+		t.Fatal("Expected context.Canceled", err)
+	}
+
+	select {
+	case <-abandoned:
+	case <-time.After(time.Second):
+		t.Fatal("Attempt in flight was not abandoned")
+	}
+
+	if service, _ := sc.(*ServiceClient).CircuitStates(); service != BreakerClosed {
+		t.Fatal("Abandoned request counted as a failure")
+	}
+}
+
+func TestSendContextDeadline(t *testing.T) {
+	sc := GetService("foo", "1.0.0", "", "")
+
+	var deadline time.Time
+	stubForSend(sc, func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+		deadline = ri.Deadline
+		return
+	})
+
+	sc.SetDefaultTimeout(0, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	expected, _ := ctx.Deadline()
+
+	var response string
+	if err := sc.SendOnceContext(ctx, nil, "bar", "", &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if !deadline.Equal(expected) {
+		t.Fatal("Deadline not sent in RequestInfo", deadline)
+	}
+}
+
+func TestSendAttemptTimeout(t *testing.T) {
+	sc := GetService("foo", "1.0.0", "", "")
+	stubForSend(sc, func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+		return
+	})
+
+	pool.(*test.Pool).AcquireFunc = func(s skynet.ServiceInfo) (conn.Connection, error) {
+		return &test.Connection{
+			SendContextFunc: func(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		}, nil
+	}
+
+	completed := make(chan error, 10)
+	sc.(*ServiceClient).loadBalancer.(*test.LoadBalancer).CompleteFunc = func(s skynet.ServiceInfo, duration time.Duration, err error) {
+		completed <- err
+	}
+
+	sc.(*ServiceClient).idempotent["bar"] = true
+	sc.SetDefaultTimeout(10*time.Millisecond, 15*time.Millisecond)
+
+	var response string
+	if err := sc.Send(nil, "bar", "", &response); err != RequestTimeout {
+		t.Fatal("Expected RequestTimeout", err)
+	}
+
+	if err := <-completed; !conn.IsTimeout(err) {
+		t.Fatal("Attempt that took longer than the retry timeout not reported as timing out", err)
+	}
+}
+
+func TestSendGiveupTimesOutAttempt(t *testing.T) {
+	sc := GetService("foo", "1.0.0", "", "")
+	stubForSend(sc, func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+		return
+	})
+
+	pool.(*test.Pool).AcquireFunc = func(s skynet.ServiceInfo) (conn.Connection, error) {
+		return &test.Connection{
+			SendContextFunc: func(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		}, nil
+	}
+
+	completed := make(chan error, 10)
+	sc.(*ServiceClient).loadBalancer.(*test.LoadBalancer).CompleteFunc = func(s skynet.ServiceInfo, duration time.Duration, err error) {
+		completed <- err
+	}
+
+	c := sc.(*ServiceClient)
+	c.breaker.config.threshold = 1
+
+	// without retries the giveup time is the only timeout
+	sc.SetDefaultTimeout(0, 10*time.Millisecond)
+
+	var response string
+	if err := sc.SendOnce(nil, "bar", "", &response); err != RequestTimeout {
+		t.Fatal("Expected RequestTimeout", err)
+	}
+
+	if err := <-completed; !conn.IsTimeout(err) {
+		t.Fatal("Attempt in flight at the giveup time not reported as timing out", err)
+	}
+
+	if service, instances := c.CircuitStates(); service != BreakerOpen || instances[""] != BreakerOpen {
+		t.Fatal("Request that timed out not recorded as failing", service, instances[""])
+	}
+}
+
+func TestSendCancelledNotFailure(t *testing.T) {
+	sc := GetService("foo", "1.0.0", "", "")
+	stubForSend(sc, func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+		return
+	})
+
+	pool.(*test.Pool).AcquireFunc = func(s skynet.ServiceInfo) (conn.Connection, error) {
+		return &test.Connection{
+			SendContextFunc: func(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		}, nil
+	}
+
+	c := sc.(*ServiceClient)
+	c.breaker.config.threshold = 1
+	sc.SetDefaultTimeout(0, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var response string
+	if err := sc.SendOnceContext(ctx, nil, "bar", "", &response); err != context.DeadlineExceeded {
+		t.Fatal("Expected context.DeadlineExceeded", err)
+	}
+
+	if service, instances := c.CircuitStates(); service != BreakerClosed || instances[""] != BreakerClosed {
+		t.Fatal("Request abandoned by the caller recorded as failing", service, instances[""])
+	}
+}
+
+func TestSendGiveupDeadline(t *testing.T) {
+	sc := GetService("foo", "1.0.0", "", "")
+
+	var deadline time.Time
+	stubForSend(sc, func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+		deadline = ri.Deadline
+		return
+	})
+
+	sc.SetDefaultTimeout(0, time.Minute)
+
+	before := time.Now()
+
+	var response string
+	if err := sc.Send(nil, "bar", "", &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if deadline.Before(before.Add(time.Minute)) || deadline.After(time.Now().Add(time.Minute)) {
+		t.Fatal("Giveup time not sent in RequestInfo", deadline)
+	}
+}
+
+func TestSendInheritsDeadline(t *testing.T) {
+	sc := GetService("foo", "1.0.0", "", "")
+
+	stubForSend(sc, func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+		return
+	})
+
+	pool.(*test.Pool).AcquireFunc = func(s skynet.ServiceInfo) (conn.Connection, error) {
+		return &test.Connection{
+			SendContextFunc: func(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		}, nil
+	}
+
+	sc.SetDefaultTimeout(0, time.Minute)
+
+	// as given to a service serving a request
+	served := &skynet.RequestInfo{
+		RequestID: "id",
+		Deadline:  time.Now().Add(10 * time.Millisecond),
+	}
+	deadline := served.Deadline
+
+	var response string
+	if err := sc.Send(served, "bar", "", &response); err != context.DeadlineExceeded {
+		t.Fatal("Expected context.DeadlineExceeded", err)
+	}
+
+	if !served.Deadline.Equal(deadline) || served.RetryCount != 0 {
+		t.Fatal("RequestInfo of the request being served was modified")
+	}
+}
+
 // Helper for validating and testing send logic
 // stubs ServiceManager, Pool, Connection, LoadBalancer
 func stubForSend(sc ServiceClientProvider, f func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error)) {
@@ -174,7 +650,7 @@ func stubForSend(sc ServiceClientProvider, f func(ri *skynet.RequestInfo, fn str
 	pool = &test.Pool{
 		AcquireFunc: func(s skynet.ServiceInfo) (conn.Connection, error) {
 			c := &test.Connection{
-				SendTimeoutFunc: func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}, timeout time.Duration) (err error) {
+				SendContextFunc: func(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
 					return f(ri, fn, in, out)
 				},
 			}
@@ -185,7 +661,7 @@ func stubForSend(sc ServiceClientProvider, f func(ri *skynet.RequestInfo, fn str
 
 	sClient := sc.(*ServiceClient)
 	sClient.loadBalancer = &test.LoadBalancer{
-		ChooseFunc: func() (s skynet.ServiceInfo, err error) {
+		ChooseFunc: func(ri *skynet.RequestInfo) (s skynet.ServiceInfo, err error) {
 			return
 		},
 	}
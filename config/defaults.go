@@ -16,6 +16,43 @@ const (
 	DefaultIdleConnectionsToInstance = 2
 	// DefaultMaxConnectionsToInstance is the maximum number of concurrent connections to a particular instance.
 	DefaultMaxConnectionsToInstance = 20
+
+	// DefaultOutlierConsecutiveFailures is how many requests in a row may fail before an instance is ejected.
+	DefaultOutlierConsecutiveFailures = 5
+	// DefaultOutlierErrorPercent is the percentage of an instance's recent requests that may fail before it is ejected.
+	DefaultOutlierErrorPercent = 50
+	// DefaultOutlierMaxEjectedPercent is the most instances that may be ejected at once, as a percentage of those known.
+	DefaultOutlierMaxEjectedPercent = 50
+	// DefaultOutlierEjectionDuration is how long an instance is first ejected for, doubling each time it is ejected again.
+	DefaultOutlierEjectionDuration = 30 * time.Second
+	// DefaultOutlierMaxEjectionDuration is the longest an instance is ejected for.
+	DefaultOutlierMaxEjectionDuration = 5 * time.Minute
+
+	// DefaultCircuitThreshold is how many requests in a row may fail before a circuit breaker opens.
+	DefaultCircuitThreshold = 5
+	// DefaultCircuitTimeout is how long a circuit breaker stays open before letting requests through to test for recovery.
+	DefaultCircuitTimeout = 10 * time.Second
+	// DefaultCircuitHalfOpenRequests is how many requests a circuit breaker lets through at once to test for recovery.
+	DefaultCircuitHalfOpenRequests = 1
+
+	// DefaultHedgePercentile is the percentile of recent request latencies after which a client.ServiceClient sends a second attempt.
+	DefaultHedgePercentile = 95
+	// DefaultRetryBudgetPercent is the most retries a client.ServiceClient sends, as a percentage of its requests.
+	DefaultRetryBudgetPercent = 20
+	// DefaultRetryBudgetMinPerSecond is how many retries a client.ServiceClient may send each second regardless of its requests.
+	DefaultRetryBudgetMinPerSecond = 10
+)
+
+// skynet/service
+const (
+	// DefaultLeaseTTL is how long an instance remains known to the ServiceManager without renewing its lease.
+	DefaultLeaseTTL = 30 * time.Second
+	// DefaultStatsInterval is how often an instance publishes its statistics to the ServiceManager.
+	DefaultStatsInterval = 10 * time.Second
+	// DefaultDedupWindow is how long an instance remembers the results of requests that aren't idempotent, 0 disables.
+	DefaultDedupWindow = 0
+	// DefaultWeight is the share of requests an instance receives from weighted load balancers.
+	DefaultWeight = 1
 )
 
 // skynet
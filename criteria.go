@@ -1,20 +1,46 @@
 package skynet
 
+import (
+	"github.com/skynetservices/skynet/semver"
+	"path"
+	"strings"
+	"sync"
+)
+
+// version constraints are parsed once, rather than every time criteria are matched against an instance
+var (
+	constraints      = make(map[string]*semver.Constraint)
+	constraintsMutex sync.RWMutex
+)
+
 type CriteriaMatcher interface {
 	Matches(s ServiceInfo) bool
 }
 
+// Criteria is sent over the wire to daemons and registries, empty fields are omitted
 type Criteria struct {
-	Hosts      []string
-	Regions    []string
-	Instances  []string
-	Services   []ServiceCriteria
-	Registered *bool
+	Hosts      []string          `json:",omitempty" bson:",omitempty"`
+	Regions    []string          `json:",omitempty" bson:",omitempty"`
+	Instances  []string          `json:",omitempty" bson:",omitempty"`
+	Services   []ServiceCriteria `json:",omitempty" bson:",omitempty"`
+	Registered *bool             `json:",omitempty" bson:",omitempty"`
+
+	// Labels must all be satisfied by an instance's labels
+	Labels []LabelRequirement `json:",omitempty" bson:",omitempty"`
+
+	// Instances on any of these hosts, in any of these regions or with any of these UUIDs never match
+	ExcludeHosts     []string `json:",omitempty" bson:",omitempty"`
+	ExcludeRegions   []string `json:",omitempty" bson:",omitempty"`
+	ExcludeInstances []string `json:",omitempty" bson:",omitempty"`
 }
 
 type ServiceCriteria struct {
-	Name    string
-	Version string
+	// Name may be a glob pattern such as "billing-*", see path.Match for the syntax
+	Name string
+
+	// Version is either an exact version, or a semantic version constraint such as
+	// "^1.4.0", "2.x" or ">=1.4.0 <2" (see the semver package)
+	Version string `json:",omitempty" bson:",omitempty"`
 }
 
 func (sc *ServiceCriteria) String() string {
@@ -26,18 +52,77 @@ func (sc *ServiceCriteria) String() string {
 }
 
 func (sc *ServiceCriteria) Matches(name, version string) bool {
-	if sc.Name != "" && sc.Name != name {
+	if sc.Name != "" && !matchName(sc.Name, name) {
 		return false
 	}
 
-	if sc.Version != "" && sc.Version != version {
+	if sc.Version == "" || sc.Version == version {
+		return true
+	}
+
+	c := constraint(sc.Version)
+	if c == nil {
 		return false
 	}
 
-	return true
+	v, err := semver.Parse(version)
+	if err != nil {
+		return false
+	}
+
+	return c.Check(v)
+}
+
+/*
+ServiceCriteria.IsRange() returns true if the criteria matches more than one version of a service
+*/
+func (sc *ServiceCriteria) IsRange() bool {
+	if sc.Version == "" {
+		return true
+	}
+
+	c := constraint(sc.Version)
+
+	return c != nil && !c.Exact()
+}
+
+// constraint returns the parsed form of a version constraint, or nil if it isn't valid
+func constraint(s string) *semver.Constraint {
+	constraintsMutex.RLock()
+	c, ok := constraints[s]
+	constraintsMutex.RUnlock()
+
+	if ok {
+		return c
+	}
+
+	c, err := semver.ParseConstraint(s)
+	if err != nil {
+		c = nil
+	}
+
+	constraintsMutex.Lock()
+	constraints[s] = c
+	constraintsMutex.Unlock()
+
+	return c
+}
+
+func matchName(pattern, name string) bool {
+	if !strings.ContainsAny(pattern, "*?[\\") {
+		return pattern == name
+	}
+
+	matched, err := path.Match(pattern, name)
+
+	return err == nil && matched
 }
 
 func (c *Criteria) Matches(s ServiceInfo) bool {
+	if exists(c.ExcludeInstances, s.UUID) || exists(c.ExcludeHosts, s.ServiceAddr.IPAddress) || exists(c.ExcludeRegions, s.Region) {
+		return false
+	}
+
 	if c.Instances != nil && len(c.Instances) > 0 && !exists(c.Instances, s.UUID) {
 		return false
 	}
@@ -57,6 +142,12 @@ func (c *Criteria) Matches(s ServiceInfo) bool {
 		return false
 	}
 
+	for _, r := range c.Labels {
+		if !r.Matches(s.Labels) {
+			return false
+		}
+	}
+
 	// Check for service match
 
 	if c.Services != nil && len(c.Services) > 0 {
@@ -104,17 +195,103 @@ func (c *Criteria) AddService(service ServiceCriteria) {
 	c.Services = append(c.Services, service)
 }
 
+func (c *Criteria) AddLabelRequirement(r LabelRequirement) {
+	c.Labels = append(c.Labels, r)
+}
+
+func (c *Criteria) ExcludeInstance(uuid string) {
+	if !exists(c.ExcludeInstances, uuid) {
+		c.ExcludeInstances = append(c.ExcludeInstances, uuid)
+	}
+}
+
+func (c *Criteria) ExcludeHost(host string) {
+	if !exists(c.ExcludeHosts, host) {
+		c.ExcludeHosts = append(c.ExcludeHosts, host)
+	}
+}
+
+func (c *Criteria) ExcludeRegion(region string) {
+	if !exists(c.ExcludeRegions, region) {
+		c.ExcludeRegions = append(c.ExcludeRegions, region)
+	}
+}
+
 // Returns a copy of this criteria
 func (c *Criteria) Clone() *Criteria {
-	criteria := new(Criteria)
-	copy(c.Hosts, criteria.Hosts)
-	copy(c.Regions, criteria.Regions)
-	copy(c.Instances, criteria.Instances)
-	copy(c.Services, criteria.Services)
+	criteria := &Criteria{
+		Hosts:            cloneStrings(c.Hosts),
+		Regions:          cloneStrings(c.Regions),
+		Instances:        cloneStrings(c.Instances),
+		ExcludeHosts:     cloneStrings(c.ExcludeHosts),
+		ExcludeRegions:   cloneStrings(c.ExcludeRegions),
+		ExcludeInstances: cloneStrings(c.ExcludeInstances),
+	}
+
+	if c.Services != nil {
+		criteria.Services = make([]ServiceCriteria, len(c.Services))
+		copy(criteria.Services, c.Services)
+	}
+
+	if c.Registered != nil {
+		registered := *c.Registered
+		criteria.Registered = &registered
+	}
+
+	for _, r := range c.Labels {
+		r.Values = cloneStrings(r.Values)
+		criteria.Labels = append(criteria.Labels, r)
+	}
 
 	return criteria
 }
 
+func cloneStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+
+	c := make([]string, len(s))
+	copy(c, s)
+
+	return c
+}
+
+// And matches instances matched by all of its CriteriaMatchers
+type And []CriteriaMatcher
+
+func (a And) Matches(s ServiceInfo) bool {
+	for _, c := range a {
+		if !c.Matches(s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Or matches instances matched by any of its CriteriaMatchers
+type Or []CriteriaMatcher
+
+func (o Or) Matches(s ServiceInfo) bool {
+	for _, c := range o {
+		if c.Matches(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Not matches instances that are not matched by Criteria
+type Not struct {
+	Criteria CriteriaMatcher
+}
+
+func (n Not) Matches(s ServiceInfo) bool {
+	return !n.Criteria.Matches(s)
+}
+
 func exists(haystack []string, needle string) bool {
 	for _, v := range haystack {
 		if v == needle {
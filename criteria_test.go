@@ -1,6 +1,7 @@
 package skynet
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -31,6 +32,45 @@ var testCases []matchTestCase = []matchTestCase{
 			},
 		},
 	},
+	matchTestCase{
+		Criteria: Criteria{
+			Services: []ServiceCriteria{
+				ServiceCriteria{Name: "TestService", Version: ">=1.4.0 <2"},
+				ServiceCriteria{Name: "OtherService", Version: "unknown"},
+			},
+		},
+		MatchingInstances: []ServiceInfo{
+			ServiceInfo{Name: "TestService", Version: "1.4.0"},
+			ServiceInfo{Name: "TestService", Version: "1.10.2"},
+			ServiceInfo{Name: "OtherService", Version: "unknown"},
+		},
+		NonMatchingInstances: []ServiceInfo{
+			ServiceInfo{Name: "TestService", Version: "1.3.9"},
+			ServiceInfo{Name: "TestService", Version: "2.0.0"},
+			ServiceInfo{Name: "TestService", Version: "unknown"},
+			ServiceInfo{Name: "OtherService", Version: "1.0.0"},
+		},
+	},
+	matchTestCase{
+		Criteria: Criteria{
+			Services: []ServiceCriteria{
+				ServiceCriteria{Name: "billing-*"},
+			},
+			ExcludeHosts:     []string{"127.0.0.2"},
+			ExcludeRegions:   []string{"Dallas"},
+			ExcludeInstances: []string{"2"},
+		},
+		MatchingInstances: []ServiceInfo{
+			ServiceInfo{UUID: "1", Name: "billing-invoices", Region: "Tampa", ServiceAddr: BindAddr{IPAddress: "127.0.0.1"}},
+			ServiceInfo{UUID: "1", Name: "billing-", Region: "Tampa", ServiceAddr: BindAddr{IPAddress: "127.0.0.1"}},
+		},
+		NonMatchingInstances: []ServiceInfo{
+			ServiceInfo{UUID: "1", Name: "billing", Region: "Tampa", ServiceAddr: BindAddr{IPAddress: "127.0.0.1"}},
+			ServiceInfo{UUID: "1", Name: "billing-invoices", Region: "Tampa", ServiceAddr: BindAddr{IPAddress: "127.0.0.2"}},
+			ServiceInfo{UUID: "1", Name: "billing-invoices", Region: "Dallas", ServiceAddr: BindAddr{IPAddress: "127.0.0.1"}},
+			ServiceInfo{UUID: "2", Name: "billing-invoices", Region: "Tampa", ServiceAddr: BindAddr{IPAddress: "127.0.0.1"}},
+		},
+	},
 }
 
 func TestMatch(t *testing.T) {
@@ -48,3 +88,77 @@ func TestMatch(t *testing.T) {
 		}
 	}
 }
+
+func TestVersionConstraintParsedOnce(t *testing.T) {
+	sc := ServiceCriteria{Name: "TestService", Version: "^1.4.0"}
+
+	if !sc.Matches("TestService", "1.5.0") || sc.Matches("TestService", "2.0.0") {
+		t.Fatal("Version constraint not applied")
+	}
+
+	c := constraint(sc.Version)
+	if c == nil || constraint(sc.Version) != c {
+		t.Fatal("Version constraint parsed again")
+	}
+
+	if constraint("not a constraint") != nil {
+		t.Fatal("Invalid version constraint parsed")
+	}
+}
+
+func TestComposition(t *testing.T) {
+	tampa := &Criteria{Regions: []string{"Tampa"}}
+	billing := &Criteria{Services: []ServiceCriteria{ServiceCriteria{Name: "billing"}}}
+
+	c := Or{
+		And{tampa, billing},
+		And{Not{tampa}, Not{billing}},
+	}
+
+	for _, s := range []ServiceInfo{
+		ServiceInfo{Name: "billing", Region: "Tampa"},
+		ServiceInfo{Name: "auth", Region: "Chicago"},
+	} {
+		if !c.Matches(s) {
+			t.Fatal("Instance expected to match criteria and did not", s)
+		}
+	}
+
+	for _, s := range []ServiceInfo{
+		ServiceInfo{Name: "billing", Region: "Chicago"},
+		ServiceInfo{Name: "auth", Region: "Tampa"},
+	} {
+		if c.Matches(s) {
+			t.Fatal("Instance should not match criteria", s)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	registered := true
+	c := &Criteria{
+		Hosts:        []string{"127.0.0.1"},
+		Regions:      []string{"Tampa"},
+		Instances:    []string{"1"},
+		Services:     []ServiceCriteria{ServiceCriteria{Name: "TestService"}},
+		Registered:   &registered,
+		Labels:       []LabelRequirement{LabelRequirement{Key: "tier", Operator: LabelIn, Values: []string{"canary"}}},
+		ExcludeHosts: []string{"127.0.0.2"},
+	}
+
+	clone := c.Clone()
+
+	if !reflect.DeepEqual(c, clone) {
+		t.Fatal("Clone() did not copy criteria", clone)
+	}
+
+	clone.Hosts[0] = "127.0.0.3"
+	clone.Services[0].Name = "OtherService"
+	clone.Labels[0].Values[0] = "stable"
+	clone.ExcludeHosts[0] = "127.0.0.3"
+	*clone.Registered = false
+
+	if c.Hosts[0] != "127.0.0.1" || c.Services[0].Name != "TestService" || c.Labels[0].Values[0] != "canary" || c.ExcludeHosts[0] != "127.0.0.2" || !*c.Registered {
+		t.Fatal("Clone() did not deep copy criteria")
+	}
+}
@@ -0,0 +1,295 @@
+package skynet
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	InvalidCriteria = errors.New("Invalid criteria")
+)
+
+const labelPrefix = "label."
+
+/*
+skynet.ParseCriteria() parses criteria from the textual form returned by Criteria.String().
+Terms are separated by spaces, and every term must be satisfied:
+
+	service=Billing:2.x,Auth  services by name and optionally version, names may be globs
+	region=us-west,us-east    any of these regions
+	region!=us-east-1         none of these regions
+	host=10.0.0.4             host, and host!= to exclude
+	instance=<uuid>           instance, and instance!= to exclude
+	registered=true           only registered (or unregistered) instances
+	label.tier=canary,beta    label has any of these values, label.tier!= for none of them
+	label.tier                label exists
+	!label.tier               label does not exist
+
+Values containing spaces or commas, such as version constraints, may be double quoted:
+
+	service="Billing:>=1.4.0 <2"
+*/
+func ParseCriteria(s string) (c *Criteria, err error) {
+	c = &Criteria{}
+
+	terms, err := splitTerms(s)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, term := range terms {
+		if err = c.parseTerm(term); err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+func (c *Criteria) parseTerm(term string) (err error) {
+	key, op, value := term, "", ""
+
+	if i := strings.Index(term, "="); i > 0 {
+		key, op, value = term[:i], "=", term[i+1:]
+
+		if strings.HasSuffix(key, "!") {
+			key, op = key[:len(key)-1], "!="
+		}
+	}
+
+	// existence of labels
+	if op == "" {
+		switch {
+		case strings.HasPrefix(key, labelPrefix):
+			return c.addLabel(LabelExists, key, nil)
+		case strings.HasPrefix(key, "!"+labelPrefix):
+			return c.addLabel(LabelNotExists, key[1:], nil)
+		}
+
+		return InvalidCriteria
+	}
+
+	values, err := splitValues(value)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case key == "service" && op == "=":
+		for _, v := range values {
+			sc := ServiceCriteria{Name: v}
+
+			if i := strings.Index(v, ":"); i >= 0 {
+				sc.Name, sc.Version = v[:i], v[i+1:]
+			}
+
+			c.AddService(sc)
+		}
+
+	case key == "region":
+		c.addValues(op, values, c.AddRegion, c.ExcludeRegion)
+
+	case key == "host":
+		c.addValues(op, values, c.AddHost, c.ExcludeHost)
+
+	case key == "instance":
+		c.addValues(op, values, c.AddInstance, c.ExcludeInstance)
+
+	case key == "registered" && op == "=" && len(values) == 1:
+		switch values[0] {
+		case "true":
+			registered := true
+			c.Registered = &registered
+		case "false":
+			registered := false
+			c.Registered = &registered
+		default:
+			return InvalidCriteria
+		}
+
+	case strings.HasPrefix(key, labelPrefix):
+		operator := LabelEquals
+		switch {
+		case op == "=" && len(values) > 1:
+			operator = LabelIn
+		case op == "!=" && len(values) > 1:
+			operator = LabelNotIn
+		case op == "!=":
+			operator = LabelNotEquals
+		}
+
+		return c.addLabel(operator, key, values)
+
+	default:
+		return InvalidCriteria
+	}
+
+	return
+}
+
+func (c *Criteria) addValues(op string, values []string, add, exclude func(string)) {
+	for _, v := range values {
+		if op == "=" {
+			add(v)
+		} else {
+			exclude(v)
+		}
+	}
+}
+
+func (c *Criteria) addLabel(operator, key string, values []string) error {
+	r := LabelRequirement{Key: strings.TrimPrefix(key, labelPrefix), Operator: operator, Values: values}
+
+	if r.Key == "" || !validLabel(r.Key) {
+		return InvalidCriteria
+	}
+
+	for _, v := range values {
+		if !validLabel(v) {
+			return InvalidCriteria
+		}
+	}
+
+	c.AddLabelRequirement(r)
+
+	return nil
+}
+
+/*
+Criteria.String() returns the criteria in the form parsed by ParseCriteria()
+*/
+func (c *Criteria) String() string {
+	var terms []string
+
+	term := func(key, op string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+
+		quoted := make([]string, len(values))
+		for i, v := range values {
+			quoted[i] = quote(v)
+		}
+
+		terms = append(terms, key+op+strings.Join(quoted, ","))
+	}
+
+	services := make([]string, len(c.Services))
+	for i := range c.Services {
+		services[i] = c.Services[i].String()
+	}
+
+	term("service", "=", services)
+	term("region", "=", c.Regions)
+	term("region", "!=", c.ExcludeRegions)
+	term("host", "=", c.Hosts)
+	term("host", "!=", c.ExcludeHosts)
+	term("instance", "=", c.Instances)
+	term("instance", "!=", c.ExcludeInstances)
+
+	if c.Registered != nil {
+		if *c.Registered {
+			terms = append(terms, "registered=true")
+		} else {
+			terms = append(terms, "registered=false")
+		}
+	}
+
+	for _, r := range c.Labels {
+		key := labelPrefix + r.Key
+
+		switch r.Operator {
+		case LabelEquals, LabelIn:
+			term(key, "=", r.Values)
+		case LabelNotEquals, LabelNotIn:
+			term(key, "!=", r.Values)
+		case LabelExists:
+			terms = append(terms, key)
+		case LabelNotExists:
+			terms = append(terms, "!"+key)
+		}
+	}
+
+	return strings.Join(terms, " ")
+}
+
+func quote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n,\"\\") {
+		return s
+	}
+
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+
+	return `"` + s + `"`
+}
+
+// splitTerms splits s on whitespace outside of quotes
+func splitTerms(s string) (terms []string, err error) {
+	var term []rune
+	quoted, escaped := false, false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quoted:
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if len(term) > 0 {
+				terms = append(terms, string(term))
+				term = nil
+			}
+
+			continue
+		}
+
+		term = append(term, r)
+	}
+
+	if quoted || escaped {
+		return nil, InvalidCriteria
+	}
+
+	if len(term) > 0 {
+		terms = append(terms, string(term))
+	}
+
+	return
+}
+
+// splitValues splits s on commas outside of quotes, and unquotes each value
+func splitValues(s string) (values []string, err error) {
+	var value []rune
+	quoted, escaped, wasQuoted := false, false, false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			value = append(value, r)
+			escaped = false
+		case r == '\\' && quoted:
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+			wasQuoted = true
+		case r == ',' && !quoted:
+			if len(value) == 0 && !wasQuoted {
+				return nil, InvalidCriteria
+			}
+
+			values = append(values, string(value))
+			value, wasQuoted = nil, false
+		default:
+			value = append(value, r)
+		}
+	}
+
+	if len(value) == 0 && !wasQuoted {
+		return nil, InvalidCriteria
+	}
+
+	return append(values, string(value)), nil
+}
@@ -0,0 +1,113 @@
+package skynet
+
+import (
+	"encoding/json"
+	"labix.org/v2/mgo/bson"
+	"reflect"
+	"testing"
+)
+
+func TestParseCriteria(t *testing.T) {
+	c, err := ParseCriteria(`service=Billing:2.x,"Auth:>=1.4.0 <2" region=us-west,us-east registered=true host!=10.0.0.5 label.tier=canary,beta !label.deprecated`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registered := true
+	expected := &Criteria{
+		Services: []ServiceCriteria{
+			ServiceCriteria{Name: "Billing", Version: "2.x"},
+			ServiceCriteria{Name: "Auth", Version: ">=1.4.0 <2"},
+		},
+		Regions:      []string{"us-west", "us-east"},
+		Registered:   &registered,
+		ExcludeHosts: []string{"10.0.0.5"},
+		Labels: []LabelRequirement{
+			LabelRequirement{Key: "tier", Operator: LabelIn, Values: []string{"canary", "beta"}},
+			LabelRequirement{Key: "deprecated", Operator: LabelNotExists},
+		},
+	}
+
+	if !reflect.DeepEqual(c, expected) {
+		t.Fatal("ParseCriteria() returned unexpected criteria", c)
+	}
+
+	if !c.Matches(ServiceInfo{Name: "Auth", Version: "1.5.0", Region: "us-east", Registered: true, Labels: map[string]string{"tier": "beta"}}) {
+		t.Fatal("Parsed criteria should match instance")
+	}
+
+	if c.Matches(ServiceInfo{Name: "Billing", Version: "2.1.0", Region: "us-west", Registered: true, Labels: map[string]string{"tier": "beta", "deprecated": "true"}}) {
+		t.Fatal("Parsed criteria should not match deprecated instance")
+	}
+}
+
+func TestParseCriteriaErrors(t *testing.T) {
+	for _, s := range []string{
+		"service!=Billing",
+		"region",
+		"region=",
+		"region=us-west,,us-east",
+		"registered=yes",
+		"unknown=value",
+		`service="Billing`,
+		"label.=canary",
+		"label.tier=(canary)",
+	} {
+		if _, err := ParseCriteria(s); err != InvalidCriteria {
+			t.Error("ParseCriteria() should fail for", s)
+		}
+	}
+}
+
+func TestCriteriaString(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"service=Billing:2.x region=us-west,us-east registered=true",
+		`service="Billing:>=1.4.0 <2",Auth region!=us-east host=10.0.0.4 host!=10.0.0.5 instance!=1`,
+		`instance="quoted \"value\"" registered=false label.tier!=canary !label.deprecated label.zone`,
+	} {
+		c, err := ParseCriteria(s)
+		if err != nil {
+			t.Fatal(s, err)
+		}
+
+		if c.String() != s {
+			t.Fatalf("String() returned %q, expected %q", c.String(), s)
+		}
+	}
+}
+
+func TestCriteriaSerialization(t *testing.T) {
+	c, err := ParseCriteria("service=Billing:2.x,Auth region!=us-east registered=false label.tier=canary")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fromJSON Criteria
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = json.Unmarshal(b, &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(c, &fromJSON) {
+		t.Fatal("Criteria did not survive JSON", string(b))
+	}
+
+	var fromBSON Criteria
+	b, err = bson.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = bson.Unmarshal(b, &fromBSON); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(c, &fromBSON) {
+		t.Fatal("Criteria did not survive BSON", fromBSON)
+	}
+}
@@ -12,6 +12,9 @@ type ServiceHandshake struct {
 
 	// ClientID is a UUID that is used by the client to identify itself in RPC requests.
 	ClientID string
+
+	// IdempotentMethods are the RPC methods that are safe for the client to retry.
+	IdempotentMethods []string
 }
 
 // ClientHandshake is sent by the client to the service after receipt of the ServiceHandshake.
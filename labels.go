@@ -0,0 +1,208 @@
+package skynet
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Label selector operators
+const (
+	LabelEquals    = "="
+	LabelNotEquals = "!="
+	LabelIn        = "in"
+	LabelNotIn     = "notin"
+	LabelExists    = "exists"
+	LabelNotExists = "!exists"
+)
+
+var (
+	InvalidLabels        = errors.New("Invalid labels")
+	InvalidLabelSelector = errors.New("Invalid label selector")
+)
+
+/*
+skynet.ParseLabels() parses labels in the form "key=value,key=value", as used by the
+service.labels config option
+*/
+func ParseLabels(s string) (labels map[string]string, err error) {
+	labels = make(map[string]string)
+
+	for _, l := range strings.Split(s, ",") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+
+		i := strings.Index(l, "=")
+		if i <= 0 {
+			return nil, InvalidLabels
+		}
+
+		key, value := strings.TrimSpace(l[:i]), strings.TrimSpace(l[i+1:])
+		if !validLabel(key) || !validLabel(value) {
+			return nil, InvalidLabels
+		}
+
+		labels[key] = value
+	}
+
+	return
+}
+
+func validLabel(s string) bool {
+	for _, c := range s {
+		if strings.ContainsRune(" =!(),;", c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+skynet.LabelRequirement is a condition on a single label of an instance. Requirements with a
+negative operator (!=, notin, !exists) are satisfied by instances without the label.
+*/
+type LabelRequirement struct {
+	Key      string
+	Operator string
+	Values   []string `json:",omitempty" bson:",omitempty"`
+}
+
+func (r LabelRequirement) Matches(labels map[string]string) bool {
+	v, ok := labels[r.Key]
+
+	switch r.Operator {
+	case LabelEquals, LabelIn:
+		return ok && exists(r.Values, v)
+	case LabelNotEquals, LabelNotIn:
+		return !ok || !exists(r.Values, v)
+	case LabelExists:
+		return ok
+	case LabelNotExists:
+		return !ok
+	}
+
+	return false
+}
+
+func (r LabelRequirement) String() string {
+	switch r.Operator {
+	case LabelEquals, LabelNotEquals:
+		return r.Key + r.Operator + strings.Join(r.Values, "")
+	case LabelIn, LabelNotIn:
+		return r.Key + " " + r.Operator + " (" + strings.Join(r.Values, ",") + ")"
+	case LabelExists:
+		return r.Key
+	case LabelNotExists:
+		return "!" + r.Key
+	}
+
+	return ""
+}
+
+/*
+skynet.ParseLabelSelector() parses a comma separated list of label requirements, all of
+which must be satisfied:
+
+	tier=canary
+	zone!=us-east-1a
+	env in (production,staging)
+	env notin (development)
+	canary       (the label exists)
+	!deprecated  (the label does not exist)
+*/
+func ParseLabelSelector(s string) (requirements []LabelRequirement, err error) {
+	for _, part := range splitSelector(s) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		r, err := parseLabelRequirement(part)
+		if err != nil {
+			return nil, err
+		}
+
+		requirements = append(requirements, r)
+	}
+
+	return
+}
+
+/*
+skynet.LabelSelectorString() returns requirements in the form parsed by ParseLabelSelector()
+*/
+func LabelSelectorString(requirements []LabelRequirement) string {
+	parts := make([]string, len(requirements))
+
+	for i, r := range requirements {
+		parts[i] = r.String()
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// splitSelector splits on commas that aren't within parentheses
+func splitSelector(s string) (parts []string) {
+	depth, start := 0, 0
+
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+func parseLabelRequirement(s string) (r LabelRequirement, err error) {
+	if i := strings.Index(s, "!="); i >= 0 {
+		r = LabelRequirement{Key: strings.TrimSpace(s[:i]), Operator: LabelNotEquals, Values: []string{strings.TrimSpace(s[i+2:])}}
+	} else if i := strings.Index(s, "="); i >= 0 {
+		r = LabelRequirement{Key: strings.TrimSpace(s[:i]), Operator: LabelEquals, Values: []string{strings.TrimSpace(strings.TrimPrefix(s[i+1:], "="))}}
+	} else if fields := strings.Fields(s); len(fields) >= 2 && (fields[1] == LabelIn || fields[1] == LabelNotIn) {
+		set := strings.TrimSpace(strings.Join(fields[2:], " "))
+		if !strings.HasPrefix(set, "(") || !strings.HasSuffix(set, ")") {
+			return r, InvalidLabelSelector
+		}
+
+		r = LabelRequirement{Key: fields[0], Operator: fields[1]}
+
+		for _, v := range strings.Split(set[1:len(set)-1], ",") {
+			v = strings.TrimSpace(v)
+			if v == "" || !validLabel(v) {
+				return r, InvalidLabelSelector
+			}
+
+			r.Values = append(r.Values, v)
+		}
+
+		sort.Strings(r.Values)
+	} else if strings.HasPrefix(s, "!") {
+		r = LabelRequirement{Key: strings.TrimSpace(s[1:]), Operator: LabelNotExists}
+	} else {
+		r = LabelRequirement{Key: s, Operator: LabelExists}
+	}
+
+	if r.Key == "" || !validLabel(r.Key) {
+		return r, InvalidLabelSelector
+	}
+
+	for _, v := range r.Values {
+		if !validLabel(v) {
+			return r, InvalidLabelSelector
+		}
+	}
+
+	return
+}
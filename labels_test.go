@@ -0,0 +1,58 @@
+package skynet
+
+import (
+	"testing"
+)
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels("tier=canary, zone=us-east-1a,")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(labels) != 2 || labels["tier"] != "canary" || labels["zone"] != "us-east-1a" {
+		t.Fatal("ParseLabels() returned incorrect labels", labels)
+	}
+
+	for _, s := range []string{"tier", "=canary", "tier=can ary"} {
+		if _, err := ParseLabels(s); err == nil {
+			t.Errorf("ParseLabels(%q) should fail", s)
+		}
+	}
+}
+
+func TestLabelSelector(t *testing.T) {
+	requirements, err := ParseLabelSelector("tier=canary, zone!=us-east-1a,env in (staging, production),!deprecated,owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := LabelSelectorString(requirements); s != "tier=canary,zone!=us-east-1a,env in (production,staging),!deprecated,owner" {
+		t.Fatal("LabelSelectorString() returned incorrect selector", s)
+	}
+
+	c := &Criteria{Labels: requirements}
+
+	matching := map[string]string{"tier": "canary", "env": "staging", "owner": "billing"}
+	if !c.Matches(ServiceInfo{Labels: matching}) {
+		t.Fatal("Instance expected to match label selector and did not")
+	}
+
+	for _, labels := range []map[string]string{
+		{"tier": "canary", "env": "staging"},
+		{"tier": "canary", "env": "staging", "owner": "billing", "zone": "us-east-1a"},
+		{"tier": "canary", "env": "development", "owner": "billing"},
+		{"tier": "canary", "env": "staging", "owner": "billing", "deprecated": "true"},
+		nil,
+	} {
+		if c.Matches(ServiceInfo{Labels: labels}) {
+			t.Error("Instance should not match label selector", labels)
+		}
+	}
+
+	for _, s := range []string{"env in staging", "env in (staging,)", "=canary", "!", "tier=can(ary"} {
+		if _, err := ParseLabelSelector(s); err == nil {
+			t.Errorf("ParseLabelSelector(%q) should fail", s)
+		}
+	}
+}
@@ -1,5 +1,10 @@
 package skynet
 
+import (
+	"context"
+	"time"
+)
+
 // RequestInfo is information about a request, and is provided to every skynet RPC call.
 type RequestInfo struct {
 	// OriginAddress is the reported address of the originating client, typically from outside the service cluster.
@@ -8,6 +13,31 @@ type RequestInfo struct {
 	ConnectionAddress string
 	// RequestID is a unique ID for the current RPC request.
 	RequestID string
+	// CallID is unique to each call a client makes, and is shared by the retries of that call. Unlike
+	// the RequestID, it isn't passed on to requests made while serving this one.
+	CallID string `json:",omitempty" bson:",omitempty"`
 	// RetryCount indicates how many times this request has been tried before.
 	RetryCount int
+	// RoutingKey is used by load balancers such as consistenthash to send requests with the same
+	// key to the same instance.
+	RoutingKey string
+	// Deadline is when the client will give up on the request, if it has a deadline. Services
+	// reject requests whose deadline has passed, which assumes their clocks agree with the client's.
+	// Requests sent with the RequestInfo of a request being served share its deadline.
+	Deadline time.Time `json:",omitempty" bson:",omitempty"`
+}
+
+// Expired returns true if the deadline of the request has passed.
+func (ri *RequestInfo) Expired() bool {
+	return !ri.Deadline.IsZero() && !time.Now().Before(ri.Deadline)
+}
+
+// Context returns a context that is done once the deadline of the request has passed, for
+// abandoning work the client will no longer wait for.
+func (ri *RequestInfo) Context() (context.Context, context.CancelFunc) {
+	if ri.Deadline.IsZero() {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithDeadline(context.Background(), ri.Deadline)
 }
@@ -0,0 +1,44 @@
+package skynet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestInfoExpired(t *testing.T) {
+	ri := &RequestInfo{}
+
+	if ri.Expired() {
+		t.Fatal("RequestInfo without a deadline expired")
+	}
+
+	ri.Deadline = time.Now().Add(time.Minute)
+	if ri.Expired() {
+		t.Fatal("RequestInfo expired before its deadline")
+	}
+
+	ri.Deadline = time.Now().Add(-time.Second)
+	if !ri.Expired() {
+		t.Fatal("RequestInfo not expired after its deadline")
+	}
+}
+
+func TestRequestInfoContext(t *testing.T) {
+	ri := &RequestInfo{Deadline: time.Now().Add(time.Minute)}
+
+	ctx, cancel := ri.Context()
+	defer cancel()
+
+	if deadline, ok := ctx.Deadline(); !ok || !deadline.Equal(ri.Deadline) {
+		t.Fatal("Context does not have the deadline of the request", deadline)
+	}
+
+	ri.Deadline = time.Time{}
+
+	ctx, cancel = ri.Context()
+	defer cancel()
+
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("Context has a deadline for a request without one")
+	}
+}
@@ -0,0 +1,278 @@
+package semver
+
+import (
+	"strings"
+)
+
+type comparator struct {
+	op      string
+	version Version
+}
+
+func (c comparator) check(v Version) bool {
+	cmp := v.Compare(c.version)
+
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+
+	return false
+}
+
+/*
+semver.Constraint is a set of versions, see the package documentation for the syntax
+*/
+type Constraint struct {
+	source string
+
+	// any one set of comparators must be satisfied
+	sets [][]comparator
+}
+
+/*
+semver.ParseConstraint() parses a constraint
+*/
+func ParseConstraint(s string) (c *Constraint, err error) {
+	c = &Constraint{source: s}
+
+	for _, alt := range strings.Split(s, "||") {
+		set, err := parseSet(alt)
+		if err != nil {
+			return nil, err
+		}
+
+		c.sets = append(c.sets, set)
+	}
+
+	return
+}
+
+func (c *Constraint) String() string {
+	return c.source
+}
+
+/*
+Constraint.Check() returns true if v satisfies the constraint
+*/
+func (c *Constraint) Check(v Version) bool {
+	for _, set := range c.sets {
+		if checkSet(set, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+Constraint.Exact() returns true if the constraint is satisfied by a single version
+*/
+func (c *Constraint) Exact() bool {
+	return len(c.sets) == 1 && len(c.sets[0]) == 1 && c.sets[0][0].op == "="
+}
+
+func checkSet(set []comparator, v Version) bool {
+	for _, c := range set {
+		if !c.check(v) {
+			return false
+		}
+	}
+
+	if len(v.Prerelease) == 0 {
+		return true
+	}
+
+	// pre-releases are only considered when asked for explicitly
+	for _, c := range set {
+		if len(c.version.Prerelease) > 0 && c.version.samePatch(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseSet(s string) (set []comparator, err error) {
+	tokens := strings.Fields(strings.Replace(s, ",", " ", -1))
+
+	if len(tokens) == 0 {
+		return nil, InvalidConstraint
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+
+		// hyphen range
+		if i+2 < len(tokens) && tokens[i+1] == "-" {
+			var c []comparator
+			if c, err = parseHyphen(t, tokens[i+2]); err != nil {
+				return
+			}
+
+			set = append(set, c...)
+			i += 2
+
+			continue
+		}
+
+		// operators may be separated from their version
+		if isOperator(t) {
+			if i+1 == len(tokens) {
+				return nil, InvalidConstraint
+			}
+
+			t += tokens[i+1]
+			i++
+		}
+
+		var c []comparator
+		if c, err = parseComparator(t); err != nil {
+			return
+		}
+
+		set = append(set, c...)
+	}
+
+	return
+}
+
+func isOperator(s string) bool {
+	switch s {
+	case "=", "!=", ">", ">=", "<", "<=", "^", "~":
+		return true
+	}
+
+	return false
+}
+
+func parseHyphen(from, to string) (set []comparator, err error) {
+	low, err := parsePartial(from)
+	if err != nil {
+		return nil, InvalidConstraint
+	}
+
+	high, err := parsePartial(to)
+	if err != nil {
+		return nil, InvalidConstraint
+	}
+
+	set = append(set, comparator{">=", low.Version})
+
+	if high.parts == 3 {
+		set = append(set, comparator{"<=", high.Version})
+	} else if high.parts > 0 {
+		set = append(set, comparator{"<", high.next(high.parts - 1)})
+	}
+
+	return
+}
+
+func parseComparator(s string) (set []comparator, err error) {
+	op := ""
+	for _, o := range []string{">=", "<=", "!=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(s, o) {
+			op, s = o, s[len(o):]
+			break
+		}
+	}
+
+	p, err := parsePartial(s)
+	if err != nil {
+		return nil, InvalidConstraint
+	}
+
+	anyVersion := comparator{">=", Version{}}
+
+	switch op {
+	case "", "=":
+		switch p.parts {
+		case 0:
+			return []comparator{anyVersion}, nil
+		case 3:
+			return []comparator{{"=", p.Version}}, nil
+		}
+
+		return []comparator{{">=", p.Version}, {"<", p.next(p.parts - 1)}}, nil
+
+	case "!=":
+		if p.parts != 3 {
+			return nil, InvalidConstraint
+		}
+
+		return []comparator{{"!=", p.Version}}, nil
+
+	case ">", "<=":
+		// >1.2 is above every 1.2 version, and <=1.2 includes them all
+		if p.parts == 0 {
+			if op == ">" {
+				return nil, InvalidConstraint
+			}
+
+			return []comparator{anyVersion}, nil
+		}
+
+		if p.parts == 3 {
+			return []comparator{{op, p.Version}}, nil
+		}
+
+		if op == ">" {
+			return []comparator{{">=", p.next(p.parts - 1)}}, nil
+		}
+
+		return []comparator{{"<", p.next(p.parts - 1)}}, nil
+
+	case ">=", "<":
+		if p.parts == 0 {
+			if op == "<" {
+				return nil, InvalidConstraint
+			}
+
+			return []comparator{anyVersion}, nil
+		}
+
+		return []comparator{{op, p.Version}}, nil
+
+	case "^":
+		if p.parts == 0 {
+			return []comparator{anyVersion}, nil
+		}
+
+		// the first non-zero part may not change
+		part := 0
+		switch {
+		case p.Major == 0 && p.parts == 1:
+			part = 0
+		case p.Major == 0 && p.Minor == 0 && p.parts == 3:
+			part = 2
+		case p.Major == 0:
+			part = 1
+		}
+
+		return []comparator{{">=", p.Version}, {"<", p.next(part)}}, nil
+
+	case "~":
+		if p.parts == 0 {
+			return []comparator{anyVersion}, nil
+		}
+
+		part := 1
+		if p.parts == 1 {
+			part = 0
+		}
+
+		return []comparator{{">=", p.Version}, {"<", p.next(part)}}, nil
+	}
+
+	return nil, InvalidConstraint
+}
@@ -0,0 +1,256 @@
+/*
+Package semver parses semantic versions (http://semver.org) and the constraints used
+to select a range of them.
+
+Constraints follow the conventions of npm:
+
+	1.2.3, =1.2.3      exactly 1.2.3
+	>1.2.3, >=1.2.3    comparisons, also <, <= and !=
+	1.2.x, 1.2.*, 1.2  any 1.2 version
+	*, x               any version
+	^1.2.3             compatible with 1.2.3, >=1.2.3 <2.0.0 (or <0.3.0 for ^0.2.3)
+	~1.2.3             patch level changes, >=1.2.3 <1.3.0
+	1.2.3 - 2.3        inclusive range, >=1.2.3 <2.4.0
+
+Comparisons separated by spaces (or commas) must all be satisfied, and sets of
+comparisons separated by || are alternatives. Pre-release versions only satisfy
+a constraint that mentions a pre-release of the same major, minor and patch.
+*/
+package semver
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	InvalidVersion    = errors.New("Invalid semantic version")
+	InvalidConstraint = errors.New("Invalid version constraint")
+)
+
+// Version is a semantic version, MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD]
+type Version struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	Prerelease []string
+
+	// Build metadata is ignored when comparing versions
+	Build string
+}
+
+/*
+semver.Parse() parses a full semantic version, a leading v is allowed
+*/
+func Parse(s string) (v Version, err error) {
+	p, err := parsePartial(s)
+	if err != nil {
+		return
+	}
+
+	if p.parts != 3 {
+		return v, InvalidVersion
+	}
+
+	return p.Version, nil
+}
+
+func (v Version) String() string {
+	s := strconv.FormatUint(v.Major, 10) + "." + strconv.FormatUint(v.Minor, 10) + "." + strconv.FormatUint(v.Patch, 10)
+
+	if len(v.Prerelease) > 0 {
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+
+	return s
+}
+
+/*
+Version.Compare() returns -1, 0 or 1 if v has lower, equal or higher precedence than o
+*/
+func (v Version) Compare(o Version) int {
+	if c := compareUint(v.Major, o.Major); c != 0 {
+		return c
+	}
+
+	if c := compareUint(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+
+	if c := compareUint(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+
+	// a pre-release has lower precedence than the release
+	switch {
+	case len(v.Prerelease) == 0 && len(o.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(o.Prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.Prerelease) && i < len(o.Prerelease); i++ {
+		if c := compareIdentifier(v.Prerelease[i], o.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+
+	return compareUint(uint64(len(v.Prerelease)), uint64(len(o.Prerelease)))
+}
+
+/*
+Version.Less() returns true if v has lower precedence than o
+*/
+func (v Version) Less(o Version) bool {
+	return v.Compare(o) < 0
+}
+
+func (v Version) samePatch(o Version) bool {
+	return v.Major == o.Major && v.Minor == o.Minor && v.Patch == o.Patch
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+// numeric identifiers are compared numerically and have lower precedence than alphanumeric ones
+func compareIdentifier(a, b string) int {
+	an, aerr := strconv.ParseUint(a, 10, 64)
+	bn, berr := strconv.ParseUint(b, 10, 64)
+
+	switch {
+	case aerr == nil && berr == nil:
+		return compareUint(an, bn)
+	case aerr == nil:
+		return -1
+	case berr == nil:
+		return 1
+	}
+
+	return strings.Compare(a, b)
+}
+
+// partial is a version that may be missing its minor and patch, or have them wildcarded
+type partial struct {
+	Version
+
+	// the number of leading parts given, 0 is a wildcard for everything
+	parts int
+}
+
+func parsePartial(s string) (p partial, err error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "v"), "=")
+
+	if s == "" {
+		return p, InvalidVersion
+	}
+
+	if i := strings.Index(s, "+"); i >= 0 {
+		s, p.Build = s[:i], s[i+1:]
+
+		if !validIdentifiers(p.Build) {
+			return p, InvalidVersion
+		}
+	}
+
+	if i := strings.Index(s, "-"); i >= 0 {
+		var pre string
+		s, pre = s[:i], s[i+1:]
+
+		if !validIdentifiers(pre) {
+			return p, InvalidVersion
+		}
+
+		p.Prerelease = strings.Split(pre, ".")
+	}
+
+	fields := strings.Split(s, ".")
+	if len(fields) > 3 {
+		return p, InvalidVersion
+	}
+
+	numbers := []*uint64{&p.Major, &p.Minor, &p.Patch}
+
+	for i, f := range fields {
+		if f == "x" || f == "X" || f == "*" {
+			break
+		}
+
+		// leading zeros aren't allowed
+		if f == "" || (len(f) > 1 && f[0] == '0') {
+			return p, InvalidVersion
+		}
+
+		n, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return p, InvalidVersion
+		}
+
+		*numbers[i] = n
+		p.parts++
+	}
+
+	// wildcards may only be followed by wildcards, and pre-releases need a full version
+	if p.parts < len(fields) {
+		for _, f := range fields[p.parts:] {
+			if f != "x" && f != "X" && f != "*" {
+				return p, InvalidVersion
+			}
+		}
+	}
+
+	if len(p.Prerelease) > 0 && p.parts != 3 {
+		return p, InvalidVersion
+	}
+
+	return
+}
+
+func validIdentifiers(s string) bool {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+
+		for _, c := range id {
+			if (c < '0' || c > '9') && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && c != '-' {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// next returns the lowest version above every version p covers, dropping the part at index
+func (p partial) next(part int) Version {
+	v := Version{Major: p.Major, Minor: p.Minor, Patch: p.Patch}
+
+	switch part {
+	case 0:
+		v = Version{Major: v.Major + 1}
+	case 1:
+		v = Version{Major: v.Major, Minor: v.Minor + 1}
+	default:
+		v.Patch++
+	}
+
+	// the lowest possible pre-release, so that pre-releases of v are excluded as well
+	v.Prerelease = []string{"0"}
+
+	return v
+}
@@ -0,0 +1,126 @@
+package semver
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	v, err := Parse("v1.2.3-beta.1+build.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Major != 1 || v.Minor != 2 || v.Patch != 3 || len(v.Prerelease) != 2 || v.Build != "build.5" {
+		t.Fatal("Version not parsed", v)
+	}
+
+	if v.String() != "1.2.3-beta.1+build.5" {
+		t.Fatal("String() returned incorrect version", v.String())
+	}
+
+	for _, s := range []string{"", "1", "1.2", "1.2.x", "01.2.3", "1.2.3.4", "1.2.3-", "1.2.3-beta..1", "unknown"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) should fail", s)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// in ascending order of precedence, from semver.org
+	ordered := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2",
+		"1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.2.0", "1.10.0", "2.0.0",
+	}
+
+	versions := make([]Version, len(ordered))
+	for i, s := range ordered {
+		versions[len(ordered)-1-i], _ = Parse(s)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Less(versions[j])
+	})
+
+	for i, v := range versions {
+		if v.String() != ordered[i] {
+			t.Fatalf("Incorrect precedence, expected %s at %d got %s", ordered[i], i, v)
+		}
+	}
+
+	a, _ := Parse("1.0.0+a")
+	b, _ := Parse("1.0.0+b")
+	if a.Compare(b) != 0 {
+		t.Fatal("Build metadata should not affect precedence")
+	}
+}
+
+type constraintTestCase struct {
+	constraint  string
+	matching    []string
+	nonMatching []string
+}
+
+var constraintTestCases = []constraintTestCase{
+	{"1.2.3", []string{"1.2.3", "1.2.3+build"}, []string{"1.2.4", "1.2.3-beta"}},
+	{"=1.2.3", []string{"1.2.3"}, []string{"1.2.2"}},
+	{"!=1.2.3", []string{"1.2.2", "2.0.0"}, []string{"1.2.3"}},
+	{">=1.4.0 <2", []string{"1.4.0", "1.9.9"}, []string{"1.3.9", "2.0.0", "2.0.0-beta", "1.5.0-beta"}},
+	{">= 1.4.0, < 2", []string{"1.4.0"}, []string{"2.0.0"}},
+	{">1.2", []string{"1.3.0"}, []string{"1.2.9"}},
+	{"<=1.2", []string{"1.2.9", "0.1.0"}, []string{"1.3.0"}},
+	{"1.x", []string{"1.0.0", "1.9.0"}, []string{"2.0.0", "0.9.0"}},
+	{"1.2.*", []string{"1.2.0", "1.2.9"}, []string{"1.3.0"}},
+	{"1.2", []string{"1.2.0", "1.2.9"}, []string{"1.3.0"}},
+	{"*", []string{"0.0.1", "10.0.0"}, []string{"1.0.0-beta"}},
+	{"^1.2.3", []string{"1.2.3", "1.9.0"}, []string{"1.2.2", "2.0.0"}},
+	{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0"}},
+	{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+	{"^1.2.3-beta.2", []string{"1.2.3-beta.2", "1.2.3-beta.3", "1.2.3", "1.3.0"}, []string{"1.2.3-beta.1", "1.3.0-beta"}},
+	{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.3.0"}},
+	{"~1", []string{"1.0.0", "1.9.0"}, []string{"2.0.0"}},
+	{"1.2.3 - 2.3", []string{"1.2.3", "2.3.9"}, []string{"1.2.2", "2.4.0"}},
+	{"1.2.3 - 2.3.4", []string{"2.3.4"}, []string{"2.3.5"}},
+	{"1.x || >=3.1.0", []string{"1.5.0", "3.1.0"}, []string{"2.0.0", "3.0.0"}},
+}
+
+func TestConstraint(t *testing.T) {
+	for _, tc := range constraintTestCases {
+		c, err := ParseConstraint(tc.constraint)
+		if err != nil {
+			t.Errorf("ParseConstraint(%q) failed: %v", tc.constraint, err)
+			continue
+		}
+
+		for _, s := range tc.matching {
+			v, _ := Parse(s)
+			if !c.Check(v) {
+				t.Errorf("%s should satisfy %q", s, tc.constraint)
+			}
+		}
+
+		for _, s := range tc.nonMatching {
+			v, _ := Parse(s)
+			if c.Check(v) {
+				t.Errorf("%s should not satisfy %q", s, tc.constraint)
+			}
+		}
+	}
+}
+
+func TestInvalidConstraint(t *testing.T) {
+	for _, s := range []string{"", ">", "1.2.3 -", "!=1.x", "~>1.2", "unknown", "1.2 ||"} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Errorf("ParseConstraint(%q) should fail", s)
+		}
+	}
+}
+
+func TestExact(t *testing.T) {
+	for s, exact := range map[string]bool{"1.2.3": true, "=1.2.3": true, "1.2": false, "^1.2.3": false, ">=1.2.3": false} {
+		c, _ := ParseConstraint(s)
+		if c.Exact() != exact {
+			t.Errorf("Exact() incorrect for %q", s)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/config"
+	"github.com/skynetservices/skynet/log"
+	"sync"
+	"time"
+)
+
+// the result of a request, kept so that a repeat of it is given the same result
+type dedupEntry struct {
+	done chan bool
+	out  skynet.ServiceRPCOutWrite
+	err  error
+}
+
+type dedupExpiry struct {
+	key     string
+	expires time.Time
+}
+
+/*
+dedupCache remembers the results of requests for a window after they complete, keyed on their
+CallID and method, so that retries of a request that already succeeded aren't run again
+*/
+type dedupCache struct {
+	window time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*dedupEntry
+
+	// completed entries, in the order they expire
+	expiries []dedupExpiry
+
+	// replaced in tests
+	now func() time.Time
+}
+
+func newDedupCache(window time.Duration) *dedupCache {
+	return &dedupCache{
+		window:  window,
+		entries: make(map[string]*dedupEntry),
+		now:     time.Now,
+	}
+}
+
+func dedupKey(ri *skynet.RequestInfo, method string) string {
+	return ri.CallID + "/" + method
+}
+
+/*
+dedupCache.begin() returns the entry for a request, and true if the request hasn't been seen
+within the window. The first caller must call dedupCache.complete() with the result, while
+the others wait on the entry's done channel.
+*/
+func (dc *dedupCache) begin(key string) (e *dedupEntry, first bool) {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	dc.expire()
+
+	if e, ok := dc.entries[key]; ok {
+		return e, false
+	}
+
+	e = &dedupEntry{done: make(chan bool)}
+	dc.entries[key] = e
+
+	return e, true
+}
+
+/*
+dedupCache.complete() records the result of a request, and gives it to repeats of the request
+waiting for it
+*/
+func (dc *dedupCache) complete(key string, e *dedupEntry, out skynet.ServiceRPCOutWrite, err error) {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	e.out, e.err = out, err
+	close(e.done)
+
+	dc.expiries = append(dc.expiries, dedupExpiry{key, dc.now().Add(dc.window)})
+}
+
+// expire must be called with mutex held
+func (dc *dedupCache) expire() {
+	now := dc.now()
+
+	n := 0
+	for ; n < len(dc.expiries) && !now.Before(dc.expiries[n].expires); n++ {
+		delete(dc.entries, dc.expiries[n].key)
+	}
+
+	dc.expiries = dc.expiries[n:]
+}
+
+func getDedupWindow(service, version string) time.Duration {
+	if d, err := config.String(service, version, "service.dedup.window"); err == nil {
+		if window, err := time.ParseDuration(d); err == nil && window >= 0 {
+			return window
+		}
+
+		log.Println(log.ERROR, "Invalid service.dedup.window", d)
+	}
+
+	return config.DefaultDedupWindow
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"errors"
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/test"
+	"testing"
+	"time"
+)
+
+func testDedupCache() (*dedupCache, *test.Clock) {
+	clock := test.NewClock()
+
+	dc := newDedupCache(time.Minute)
+	dc.now = clock.Now
+
+	return dc, clock
+}
+
+func TestDedupRepeatGetsResult(t *testing.T) {
+	dc, _ := testDedupCache()
+
+	e, first := dc.begin("id/Charge")
+	if !first {
+		t.Fatal("First request treated as a repeat")
+	}
+
+	repeat := make(chan skynet.ServiceRPCOutWrite)
+	go func() {
+		r, first := dc.begin("id/Charge")
+		if first {
+			t.Error("Repeat of a request in progress treated as the first")
+		}
+
+		<-r.done
+		repeat <- r.out
+	}()
+
+	methodErr := errors.New("declined")
+	dc.complete("id/Charge", e, skynet.ServiceRPCOutWrite{ErrString: "declined"}, methodErr)
+
+	select {
+	case out := <-repeat:
+		if out.ErrString != "declined" {
+			t.Fatal("Repeat not given the result of the first request", out)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Repeat not given the result once the first request completed")
+	}
+
+	r, first := dc.begin("id/Charge")
+	if first || r.err != methodErr {
+		t.Fatal("Completed request not remembered")
+	}
+
+	if _, first := dc.begin("id/Refund"); !first {
+		t.Fatal("Requests with the same CallID to different methods treated as repeats")
+	}
+}
+
+func TestDedupExpires(t *testing.T) {
+	dc, clock := testDedupCache()
+
+	e, _ := dc.begin("id/Charge")
+	clock.Advance(2 * time.Minute)
+
+	// the window starts once the request completes
+	dc.complete("id/Charge", e, skynet.ServiceRPCOutWrite{}, nil)
+
+	clock.Advance(time.Minute - time.Second)
+	if _, first := dc.begin("id/Charge"); first {
+		t.Fatal("Request forgotten within the window")
+	}
+
+	clock.Advance(time.Second)
+	if _, first := dc.begin("id/Charge"); !first {
+		t.Fatal("Request remembered after the window")
+	}
+
+	if len(dc.expiries) != 0 {
+		t.Fatal("Expired entries kept", dc.expiries)
+	}
+}
@@ -44,6 +44,15 @@ func (me MethodError) String() string {
 	return fmt.Sprintf("Method %q failed with RequestInfo %v and error %s", me.MethodName, me.RequestInfo, me.Error.Error())
 }
 
+type DuplicateRequest struct {
+	RequestInfo *skynet.RequestInfo
+	MethodName  string
+}
+
+func (dr DuplicateRequest) String() string {
+	return fmt.Sprintf("Method %q repeated with RequestInfo %v, returning previous result", dr.MethodName, dr.RequestInfo)
+}
+
 type KillSignal struct {
 	Signal syscall.Signal
 }
@@ -76,3 +85,27 @@ type ServiceUnregistered struct {
 func (sr ServiceUnregistered) String() string {
 	return fmt.Sprintf("Service %q unregistered", sr.ServiceInfo.Name)
 }
+
+type LeaseLapsed struct {
+	ServiceInfo *skynet.ServiceInfo
+}
+
+func (ll LeaseLapsed) String() string {
+	return fmt.Sprintf("Lease for service %q lapsed, adding service again", ll.ServiceInfo.Name)
+}
+
+type LeasesNotSupported struct {
+	ServiceInfo *skynet.ServiceInfo
+}
+
+func (ln LeasesNotSupported) String() string {
+	return fmt.Sprintf("ServiceManager doesn't support leases, service %q will not send heartbeats", ln.ServiceInfo.Name)
+}
+
+type WeightChanged struct {
+	ServiceInfo *skynet.ServiceInfo
+}
+
+func (wc WeightChanged) String() string {
+	return fmt.Sprintf("Weight of service %q changed to %d", wc.ServiceInfo.Name, wc.ServiceInfo.Weight)
+}
@@ -15,6 +15,7 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 )
 
 // A Generic struct to represent any service in the SkyNet system.
@@ -25,6 +26,12 @@ type ServiceDelegate interface {
 	Unregistered(s *Service)
 }
 
+// IdempotentDelegate may be implemented by a ServiceDelegate to declare the RPC methods that are
+// safe to call more than once with the same input. Clients only retry idempotent methods.
+type IdempotentDelegate interface {
+	IdempotentMethods() []string
+}
+
 type ClientInfo struct {
 	Address net.Addr
 }
@@ -38,6 +45,7 @@ type Service struct {
 	activeRequests sync.WaitGroup
 	connectionChan chan *net.TCPConn
 	registeredChan chan bool
+	weightChan     chan int
 	shutdownChan   chan bool
 
 	clientMutex sync.Mutex
@@ -51,6 +59,12 @@ type Service struct {
 
 	shuttingDown bool
 	pipe         *daemon.Pipe
+
+	// how long the ServiceManager should keep us around without a heartbeat
+	leaseTTL time.Duration
+
+	stats         *statistics
+	statsInterval time.Duration
 }
 
 // Wraps your custom service in Skynet
@@ -61,9 +75,13 @@ func CreateService(sd ServiceDelegate, si *skynet.ServiceInfo) (s *Service) {
 		methods:        make(map[string]reflect.Value),
 		connectionChan: make(chan *net.TCPConn),
 		registeredChan: make(chan bool),
+		weightChan:     make(chan int),
 		shutdownChan:   make(chan bool),
 		ClientInfo:     make(map[string]ClientInfo),
 		shuttingDown:   false,
+		leaseTTL:       getLeaseTTL(si.Name, si.Version),
+		stats:          newStatistics(),
+		statsInterval:  getStatsInterval(si.Name, si.Version),
 	}
 
 	// Override LogLevel for Service
@@ -96,6 +114,10 @@ func CreateService(sd ServiceDelegate, si *skynet.ServiceInfo) (s *Service) {
 		log.SetOutput(logWriter)
 	*/
 
+	if id, ok := sd.(IdempotentDelegate); ok {
+		si.IdempotentMethods = id.IdempotentMethods()
+	}
+
 	// the main rpc server
 	s.RPCServ = rpc.NewServer()
 	rpcForwarder := NewServiceRPC(s)
@@ -152,6 +174,27 @@ func (s *Service) unregister() {
 	s.Delegate.Unregistered(s) // Call user defined callback
 }
 
+// Changes the share of requests your service receives from weighted load balancers, such as to ramp up traffic to a canary
+func (s *Service) SetWeight(weight int) {
+	s.weightChan <- weight
+}
+
+func (s *Service) setWeight(weight int) {
+	// this version must be run from the mux() goroutine
+	if s.Weight == weight || s.shuttingDown {
+		return
+	}
+
+	s.Weight = weight
+
+	err := skynet.GetServiceManager().Update(*s.ServiceInfo)
+	if err != nil {
+		log.Println(log.ERROR, "Failed to update service weight: "+err.Error())
+	}
+
+	log.Printf(log.INFO, "%+v\n", WeightChanged{s.ServiceInfo})
+}
+
 func (s *Service) Shutdown() {
 	if s.shuttingDown {
 		return
@@ -188,6 +231,36 @@ func (s *Service) shutdown() {
 	s.doneGroup.Done()
 }
 
+// Renews our lease with the ServiceManager, re-adding ourselves if the lease has already lapsed.
+// Returns false if the ServiceManager doesn't support leases, there's no use renewing again.
+func (s *Service) heartbeat() (renew bool) {
+	if s.shuttingDown {
+		return true
+	}
+
+	err := skynet.GetServiceManager().Heartbeat(s.UUID, s.leaseTTL)
+
+	if err == skynet.ReadOnly {
+		log.Printf(log.INFO, "%+v", LeasesNotSupported{s.ServiceInfo})
+		return false
+	}
+
+	if err == skynet.UnknownInstance {
+		// most likely we were unable to renew in time and have been expired
+		log.Printf(log.WARN, "%+v", LeaseLapsed{s.ServiceInfo})
+
+		if err = skynet.GetServiceManager().Add(*s.ServiceInfo); err == nil {
+			err = skynet.GetServiceManager().Heartbeat(s.UUID, s.leaseTTL)
+		}
+	}
+
+	if err != nil {
+		log.Println(log.ERROR, "Failed to renew lease: "+err.Error())
+	}
+
+	return true
+}
+
 // TODO: Currently unimplemented
 func (s *Service) IsTrusted(addr net.Addr) bool {
 	return false
@@ -209,24 +282,28 @@ func (s *Service) Start() (done *sync.WaitGroup) {
 	// We must block here, we don't want to register, until we've actually bound to an ip:port
 	bindWait.Wait()
 
-	s.doneGroup = &sync.WaitGroup{}
-	s.doneGroup.Add(1)
-
-	go func() {
-		s.mux()
-		s.doneGroup.Done()
-	}()
-	done = s.doneGroup
-
 	if r, err := config.Bool(s.Name, s.Version, "service.register"); err == nil {
 		s.Registered = r
 	}
 
+	s.stats.started()
+	s.ServiceInfo.Stats = s.stats.publish(0)
+
 	err := skynet.GetServiceManager().Add(*s.ServiceInfo)
 	if err != nil {
 		log.Println(log.ERROR, "Failed to add service: "+err.Error())
 	}
 
+	// mux() takes out our lease, now that we've been added
+	s.doneGroup = &sync.WaitGroup{}
+	s.doneGroup.Add(1)
+
+	go func() {
+		s.mux()
+		s.doneGroup.Done()
+	}()
+	done = s.doneGroup
+
 	if s.Registered {
 		s.Register()
 	}
@@ -285,6 +362,18 @@ func (s *Service) listen(addr skynet.BindAddr, bindWait *sync.WaitGroup) {
 // this function is the goroutine that owns this service - all thread-sensitive data needs to
 // be manipulated only through here.
 func (s *Service) mux() {
+	// renew well before the lease lapses so a single failure doesn't expire us
+	ticker := time.NewTicker(s.leaseTTL / 3)
+	defer ticker.Stop()
+
+	heartbeat := ticker.C
+	if !s.heartbeat() {
+		heartbeat = nil
+	}
+
+	publishStats := time.NewTicker(s.statsInterval)
+	defer publishStats.Stop()
+
 loop:
 	for {
 		select {
@@ -298,11 +387,18 @@ loop:
 				}
 				s.clientMutex.Unlock()
 
+				defer func() {
+					s.clientMutex.Lock()
+					delete(s.ClientInfo, clientID)
+					s.clientMutex.Unlock()
+				}()
+
 				// send the server handshake
 				sh := skynet.ServiceHandshake{
-					Registered: s.Registered,
-					ClientID:   clientID,
-					Name:       s.Name,
+					Registered:        s.Registered,
+					ClientID:          clientID,
+					Name:              s.Name,
+					IdempotentMethods: s.IdempotentMethods,
 				}
 
 				codec := bsonrpc.NewServerCodec(conn)
@@ -340,6 +436,14 @@ loop:
 			} else {
 				s.unregister()
 			}
+		case weight := <-s.weightChan:
+			s.setWeight(weight)
+		case <-heartbeat:
+			if !s.heartbeat() {
+				heartbeat = nil
+			}
+		case <-publishStats.C:
+			s.publishStats()
 		case <-s.shutdownChan:
 			s.shutdown()
 		case _ = <-s.doneChan:
@@ -412,3 +516,16 @@ func watchSignals(c chan os.Signal, s *Service) {
 		}
 	}
 }
+
+func getLeaseTTL(service, version string) time.Duration {
+	if d, err := config.String(service, version, "service.lease.ttl"); err == nil {
+		// the lease is renewed every third of the ttl
+		if ttl, err := time.ParseDuration(d); err == nil && ttl/3 > 0 {
+			return ttl
+		}
+
+		log.Println(log.ERROR, "Invalid service.lease.ttl", d)
+	}
+
+	return config.DefaultLeaseTTL
+}
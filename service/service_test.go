@@ -0,0 +1,43 @@
+package service
+
+import (
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/test"
+	"testing"
+	"time"
+)
+
+func TestHeartbeat(t *testing.T) {
+	service := CreateService(EchoRPC{}, &skynet.ServiceInfo{Name: "EchoRPC"})
+
+	added, heartbeats := 0, 0
+	sm := &test.ServiceManager{
+		AddFunc: func(s skynet.ServiceInfo) error {
+			added++
+			return nil
+		},
+		HeartbeatFunc: func(uuid string, ttl time.Duration) error {
+			heartbeats++
+
+			// our lease lapsed
+			if added == 0 {
+				return skynet.UnknownInstance
+			}
+
+			return nil
+		},
+	}
+	skynet.SetServiceManager(sm)
+
+	if !service.heartbeat() || added != 1 || heartbeats != 2 {
+		t.Fatal("Service not added again after its lease lapsed", added, heartbeats)
+	}
+
+	sm.HeartbeatFunc = func(uuid string, ttl time.Duration) error {
+		return skynet.ReadOnly
+	}
+
+	if service.heartbeat() {
+		t.Fatal("Heartbeats renewed when the ServiceManager doesn't support leases")
+	}
+}
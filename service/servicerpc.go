@@ -12,6 +12,8 @@ import (
 )
 
 var (
+	RequestExpired = errors.New("Request deadline has passed")
+
 	RequestInfoPtrType = reflect.TypeOf(&skynet.RequestInfo{})
 
 	anError   error
@@ -22,6 +24,9 @@ type ServiceRPC struct {
 	service     *Service
 	methods     map[string]reflect.Value
 	MethodNames []string
+
+	// results of methods that aren't idempotent, for repeats of the same request. nil if disabled
+	dedup *dedupCache
 }
 
 var reservedMethodNames = map[string]bool{}
@@ -34,6 +39,9 @@ func init() {
 		m := sdvalue.Method(i)
 		reservedMethodNames[m.Name] = true
 	}
+
+	// a declaration, not an RPC method
+	reservedMethodNames["IdempotentMethods"] = true
 }
 
 func NewServiceRPC(s *Service) (srpc *ServiceRPC) {
@@ -42,6 +50,10 @@ func NewServiceRPC(s *Service) (srpc *ServiceRPC) {
 		methods: make(map[string]reflect.Value),
 	}
 
+	if window := getDedupWindow(s.Name, s.Version); window > 0 {
+		srpc.dedup = newDedupCache(window)
+	}
+
 	// scan through methods looking for a method (RequestInfo,
 	// something, something) error
 	typ := reflect.TypeOf(srpc.service.Delegate)
@@ -110,6 +122,12 @@ func (srpc *ServiceRPC) Forward(in skynet.ServiceRPCInRead, out *skynet.ServiceR
 	srpc.service.activeRequests.Add(1)
 	defer srpc.service.activeRequests.Done()
 
+	requestStart := time.Now()
+	srpc.service.stats.requestStarted()
+	defer func() {
+		srpc.service.stats.requestCompleted(time.Now().Sub(requestStart), err != nil || out.ErrString != "")
+	}()
+
 	go stats.MethodCalled(in.Method)
 
 	clientInfo, ok := srpc.service.getClientInfo(in.ClientID)
@@ -138,6 +156,42 @@ func (srpc *ServiceRPC) Forward(in skynet.ServiceRPCInRead, out *skynet.ServiceR
 		return
 	}
 
+	// the client has already given up on the request
+	if in.RequestInfo.Expired() {
+		err = RequestExpired
+		log.Printf(log.WARN, "%+v", MethodError{in.RequestInfo, in.Method, err})
+		return
+	}
+
+	// a repeat of a request that isn't safe to run twice is given the result of the first
+	if srpc.dedup != nil && in.RequestInfo.CallID != "" && !srpc.service.IsIdempotent(in.Method) {
+		key := dedupKey(in.RequestInfo, in.Method)
+
+		e, first := srpc.dedup.begin(key)
+		if !first {
+			// don't outlive the client waiting on the first request
+			ctx, cancel := in.RequestInfo.Context()
+			defer cancel()
+
+			select {
+			case <-e.done:
+			case <-ctx.Done():
+				err = RequestExpired
+				log.Printf(log.WARN, "%+v", MethodError{in.RequestInfo, in.Method, err})
+				return
+			}
+
+			log.Printf(log.INFO, "%+v", DuplicateRequest{in.RequestInfo, in.Method})
+
+			*out = e.out
+			return e.err
+		}
+
+		defer func() {
+			srpc.dedup.complete(key, e, *out, err)
+		}()
+	}
+
 	inValuePtr := reflect.New(m.Type().In(2))
 
 	err = bson.Unmarshal(in.In, inValuePtr.Interface())
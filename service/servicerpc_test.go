@@ -6,6 +6,7 @@ import (
 	"labix.org/v2/mgo/bson"
 	"net"
 	"testing"
+	"time"
 )
 
 type M map[string]interface{}
@@ -29,8 +30,8 @@ func (e EchoRPC) Foo(rinfo *skynet.RequestInfo, in M, out *M) (err error) {
 func TestServiceRPCBasic(t *testing.T) {
 	var addr net.Addr
 
-	config := &skynet.ServiceConfig{Name: "EchoRPC"}
-	service := CreateService(EchoRPC{}, config)
+	si := &skynet.ServiceInfo{Name: "EchoRPC"}
+	service := CreateService(EchoRPC{}, si)
 	service.ClientInfo = make(map[string]ClientInfo, 1)
 
 	addr = &net.TCPAddr{
@@ -47,7 +48,7 @@ func TestServiceRPCBasic(t *testing.T) {
 	in := M{"Hi": "there"}
 	out := &M{}
 
-	sin := skynet.ServiceRPCIn{
+	sin := skynet.ServiceRPCInRead{
 		RequestInfo: &skynet.RequestInfo{
 			RequestID:         "id",
 			OriginAddress:     addr.String(),
@@ -59,16 +60,139 @@ func TestServiceRPCBasic(t *testing.T) {
 
 	sin.In, _ = bson.Marshal(in)
 
-	sout := skynet.ServiceRPCOut{}
+	sout := skynet.ServiceRPCOutWrite{}
 
 	err := srpc.Forward(sin, &sout)
 	if err != nil {
 		t.Error(err)
 	}
 
-	bson.Unmarshal(sout.Out, out)
+	bson.Unmarshal(sout.Out.Data, out)
 
 	if v, ok := (*out)["Hi"].(string); !ok || v != "there" {
 		t.Error(fmt.Sprintf("Expected %v, got %v", in, *out))
 	}
 }
+
+func TestServiceRPCExpired(t *testing.T) {
+	si := &skynet.ServiceInfo{Name: "EchoRPC"}
+	service := CreateService(EchoRPC{}, si)
+	service.ClientInfo = map[string]ClientInfo{
+		"123": ClientInfo{
+			Address: &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 123,
+			},
+		},
+	}
+
+	srpc := NewServiceRPC(service)
+
+	sin := skynet.ServiceRPCInRead{
+		RequestInfo: &skynet.RequestInfo{
+			RequestID: "id",
+			Deadline:  time.Now().Add(-time.Second),
+		},
+		Method:   "Foo",
+		ClientID: "123",
+	}
+
+	sin.In, _ = bson.Marshal(M{"Hi": "there"})
+
+	sout := skynet.ServiceRPCOutWrite{}
+
+	err := srpc.Forward(sin, &sout)
+	if err != RequestExpired {
+		t.Error("Expected RequestExpired, got", err)
+	}
+}
+
+func TestServiceRPCDuplicateExpired(t *testing.T) {
+	si := &skynet.ServiceInfo{Name: "EchoRPC"}
+	service := CreateService(EchoRPC{}, si)
+	service.ClientInfo = map[string]ClientInfo{
+		"123": ClientInfo{
+			Address: &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 123,
+			},
+		},
+	}
+
+	srpc := NewServiceRPC(service)
+	srpc.dedup = newDedupCache(time.Minute)
+
+	// the first request is still running
+	srpc.dedup.begin(dedupKey(&skynet.RequestInfo{CallID: "call"}, "Foo"))
+
+	sin := skynet.ServiceRPCInRead{
+		RequestInfo: &skynet.RequestInfo{
+			RequestID: "id",
+			CallID:    "call",
+			Deadline:  time.Now().Add(10 * time.Millisecond),
+		},
+		Method:   "Foo",
+		ClientID: "123",
+	}
+
+	sin.In, _ = bson.Marshal(M{"Hi": "there"})
+
+	sout := skynet.ServiceRPCOutWrite{}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srpc.Forward(sin, &sout)
+	}()
+
+	select {
+	case err := <-errs:
+		if err != RequestExpired {
+			t.Error("Expected RequestExpired, got", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Repeated request waited past its deadline")
+	}
+}
+
+func TestServiceRPCDistinctCallsSameRequestID(t *testing.T) {
+	si := &skynet.ServiceInfo{Name: "EchoRPC"}
+	service := CreateService(EchoRPC{}, si)
+	service.ClientInfo = map[string]ClientInfo{
+		"123": ClientInfo{
+			Address: &net.TCPAddr{
+				IP:   net.ParseIP("127.0.0.1"),
+				Port: 123,
+			},
+		},
+	}
+
+	srpc := NewServiceRPC(service)
+	srpc.dedup = newDedupCache(time.Minute)
+
+	// a service passing on the RequestInfo of the request it's serving makes two calls with it
+	for _, call := range []string{"first", "second"} {
+		sin := skynet.ServiceRPCInRead{
+			RequestInfo: &skynet.RequestInfo{
+				RequestID: "id",
+				CallID:    call,
+			},
+			Method:   "Foo",
+			ClientID: "123",
+		}
+
+		sin.In, _ = bson.Marshal(M{"Hi": call})
+
+		sout := skynet.ServiceRPCOutWrite{}
+
+		if err := srpc.Forward(sin, &sout); err != nil {
+			t.Fatal(err)
+		}
+
+		out := M{}
+		bson.Unmarshal(sout.Out.Data, &out)
+
+		if out["Hi"] != call {
+			t.Fatal("Call given the result of another call with the same RequestID", out)
+		}
+	}
+}
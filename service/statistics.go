@@ -0,0 +1,140 @@
+package service
+
+import (
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/config"
+	"github.com/skynetservices/skynet/log"
+	"github.com/skynetservices/skynet/stats"
+	"sync"
+	"time"
+)
+
+// the number of recent requests latency percentiles are estimated from
+const latencyWindowSize = 1000
+
+// statistics tracks the load on a service, which is published in its ServiceInfo
+type statistics struct {
+	mutex sync.Mutex
+
+	startTime   time.Time
+	lastRequest time.Time
+	inFlight    int32
+	requests    uint64
+
+	// requests and errors since the statistics were last published
+	intervalStart    time.Time
+	intervalRequests uint64
+	intervalErrors   uint64
+
+	latency *stats.Window
+}
+
+func newStatistics() *statistics {
+	now := time.Now()
+
+	return &statistics{
+		startTime:     now,
+		intervalStart: now,
+		latency:       stats.NewWindow(latencyWindowSize),
+	}
+}
+
+// started resets the start time to when the service began running
+func (st *statistics) started() {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	st.startTime = time.Now()
+	st.intervalStart = st.startTime
+}
+
+// requestStarted must be followed by a call to requestCompleted
+func (st *statistics) requestStarted() {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	st.inFlight++
+	st.lastRequest = time.Now()
+}
+
+func (st *statistics) requestCompleted(duration time.Duration, failed bool) {
+	st.latency.Add(duration)
+
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	st.inFlight--
+	st.requests++
+	st.intervalRequests++
+
+	if failed {
+		st.intervalErrors++
+	}
+}
+
+// publish returns the current statistics, and begins a new interval for request and error rates
+func (st *statistics) publish(clients int) (s skynet.ServiceStatistics) {
+	percentiles := st.latency.Percentiles(50, 90, 99)
+
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	now := time.Now()
+
+	s = skynet.ServiceStatistics{
+		Clients:    int32(clients),
+		StartTime:  st.startTime.Format(time.RFC3339),
+		InFlight:   st.inFlight,
+		Requests:   st.requests,
+		LatencyP50: percentiles[0],
+		LatencyP90: percentiles[1],
+		LatencyP99: percentiles[2],
+	}
+
+	if !st.lastRequest.IsZero() {
+		s.LastRequest = st.lastRequest.Format(time.RFC3339)
+	}
+
+	if elapsed := now.Sub(st.intervalStart).Seconds(); elapsed > 0 {
+		s.RequestRate = float64(st.intervalRequests) / elapsed
+	}
+
+	if st.intervalRequests > 0 {
+		s.ErrorRate = float64(st.intervalErrors) / float64(st.intervalRequests)
+	}
+
+	st.intervalStart = now
+	st.intervalRequests = 0
+	st.intervalErrors = 0
+
+	return
+}
+
+// publishStats updates our ServiceInfo with the current statistics, and pushes it to the ServiceManager
+func (s *Service) publishStats() {
+	if s.shuttingDown {
+		return
+	}
+
+	s.clientMutex.Lock()
+	clients := len(s.ClientInfo)
+	s.clientMutex.Unlock()
+
+	s.ServiceInfo.Stats = s.stats.publish(clients)
+
+	if err := skynet.GetServiceManager().Update(*s.ServiceInfo); err != nil {
+		log.Println(log.ERROR, "Failed to publish statistics: "+err.Error())
+	}
+}
+
+func getStatsInterval(service, version string) time.Duration {
+	if d, err := config.String(service, version, "service.stats.interval"); err == nil {
+		if interval, err := time.ParseDuration(d); err == nil && interval > 0 {
+			return interval
+		}
+
+		log.Println(log.ERROR, "Invalid service.stats.interval", d)
+	}
+
+	return config.DefaultStatsInterval
+}
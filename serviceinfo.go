@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 var portMutex sync.Mutex
@@ -21,6 +22,20 @@ type ServiceStatistics struct {
 	StartTime string
 	// LastRequest is the time when the last request was made.
 	LastRequest string
+
+	// InFlight is the number of requests currently being handled.
+	InFlight int32
+	// Requests is the number of requests handled since the service began running.
+	Requests uint64
+	// RequestRate is the number of requests per second since the statistics were last published.
+	RequestRate float64
+	// ErrorRate is the fraction of requests since the statistics were last published that failed.
+	ErrorRate float64
+
+	// Latency percentiles of recent requests.
+	LatencyP50 time.Duration
+	LatencyP90 time.Duration
+	LatencyP99 time.Duration
 }
 
 // ServiceInfo is the publicly reported information about a particular
@@ -35,12 +50,37 @@ type ServiceInfo struct {
 
 	// Registered indicates if the instance is currently accepting requests.
 	Registered bool
+
+	// Labels are free-form key/value pairs used to select instances, such as tier=canary.
+	Labels map[string]string
+
+	// Weight is the share of requests the instance should receive relative to other instances,
+	// for load balancers that support it. 0 is treated as config.DefaultWeight.
+	Weight int
+
+	// IdempotentMethods are the RPC methods that are safe to call more than once with the same
+	// input, which clients may retry.
+	IdempotentMethods []string `json:",omitempty" bson:",omitempty"`
+
+	// Stats are published periodically by the running instance.
+	Stats ServiceStatistics
 }
 
 func (si ServiceInfo) AddrString() string {
 	return si.ServiceAddr.String()
 }
 
+// IsIdempotent returns true if the instance declares method idempotent.
+func (si ServiceInfo) IsIdempotent(method string) bool {
+	for _, m := range si.IdempotentMethods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
 func NewServiceInfo(name, version string) (si *ServiceInfo) {
 	// TODO: we need to grab Host/Region/ServiceAddr from config
 	si = &ServiceInfo{
@@ -58,6 +98,20 @@ func NewServiceInfo(name, version string) (si *ServiceInfo) {
 		si.Region = config.DefaultRegion
 	}
 
+	if l, err := config.String(name, version, "service.labels"); err == nil {
+		if labels, err := ParseLabels(l); err == nil {
+			si.Labels = labels
+		} else {
+			log.Println(log.ERROR, "Failed to parse service.labels", err)
+		}
+	}
+
+	if w, err := config.Int(name, version, "service.weight"); err == nil {
+		si.Weight = w
+	} else {
+		si.Weight = config.DefaultWeight
+	}
+
 	if h, err := config.String(name, version, "host"); err == nil {
 		host = h
 	} else {
@@ -0,0 +1,17 @@
+package skynet
+
+import (
+	"testing"
+)
+
+func TestIsIdempotent(t *testing.T) {
+	si := ServiceInfo{IdempotentMethods: []string{"Get", "List"}}
+
+	if !si.IsIdempotent("Get") || !si.IsIdempotent("List") {
+		t.Fatal("Declared method not idempotent")
+	}
+
+	if si.IsIdempotent("Charge") {
+		t.Fatal("Undeclared method idempotent")
+	}
+}
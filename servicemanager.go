@@ -1,7 +1,9 @@
 package skynet
 
 import (
+	"errors"
 	"github.com/skynetservices/skynet/log"
+	"time"
 )
 
 const (
@@ -11,6 +13,11 @@ const (
 	InstanceUpdated
 )
 
+var (
+	UnknownInstance = errors.New("Unknown instance")
+	ReadOnly        = errors.New("Instances can't be modified through this ServiceManager")
+)
+
 type InstanceNotification struct {
 	Type    int
 	Service ServiceInfo
@@ -23,6 +30,14 @@ type ServiceManager interface {
 	Register(uuid string) error
 	Unregister(uuid string) error
 
+	// Heartbeat renews the lease on an instance for ttl. An instance whose lease lapses
+	// is removed and watchers are sent InstanceRemoved, instances that have never been
+	// sent a heartbeat do not expire. Returns UnknownInstance if the instance is not known,
+	// which includes instances that have already expired.
+	Heartbeat(uuid string, ttl time.Duration) error
+
+	// ServiceManagers that only discover instances return ReadOnly from the methods above.
+
 	Shutdown() error
 
 	// Discovery
@@ -31,7 +46,23 @@ type ServiceManager interface {
 	ListServices(c CriteriaMatcher) ([]string, error)
 	ListVersions(c CriteriaMatcher) ([]string, error)
 	ListInstances(c CriteriaMatcher) ([]ServiceInfo, error)
-	Watch(criteria CriteriaMatcher, c chan<- InstanceNotification) []ServiceInfo
+	// Watch returns all instances matching criteria and sends a notification to c for each
+	// subsequent change to a matching instance, until the returned Subscription is closed
+	Watch(criteria CriteriaMatcher, c chan<- InstanceNotification) ([]ServiceInfo, Subscription)
+}
+
+// Subscription represents an active Watch on a ServiceManager
+type Subscription interface {
+	// Close stops notifications being sent for the Watch. A notification that was already
+	// being delivered may still arrive, but Close will not wait on it being received.
+	Close() error
+}
+
+// SubscriptionFunc allows a function to be used as a Subscription
+type SubscriptionFunc func() error
+
+func (f SubscriptionFunc) Close() error {
+	return f()
 }
 
 var manager ServiceManager
@@ -0,0 +1,531 @@
+/*
+Package file provides a skynet.ServiceManager that stores instances in a directory
+shared by every process on a single host, avoiding the need for a coordination service.
+
+Each instance is stored as a JSON document named after its UUID. Documents are
+written to a temporary file and renamed into place, so readers never observe
+a partially written instance. Changes are made while holding a lock on the
+directory, so that processes changing the same instance don't undo each
+other's changes. Every ServiceManager polls the directory for changes made by
+other processes and notifies its watchers.
+*/
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/log"
+	"github.com/skynetservices/skynet/servicemanager/memory"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultPollInterval is how often the directory is checked for changes made by other processes.
+	DefaultPollInterval = 1 * time.Second
+
+	extension = ".json"
+	lockFile  = ".lock"
+)
+
+var (
+	MissingUUID = errors.New("Instance has no UUID")
+	InvalidUUID = errors.New("Instance UUID is not a valid file name")
+)
+
+// record is the document stored on disk for each instance
+type record struct {
+	Service skynet.ServiceInfo
+
+	// Host and Pid identify the process that added the instance, so that records
+	// left behind by processes that died without removing them can be detected.
+	Host string
+	Pid  int
+
+	Updated time.Time
+
+	// Expires is when the lease on the instance lapses, instances that have never
+	// been sent a heartbeat have a zero Expires and never expire
+	Expires time.Time
+}
+
+func (r record) expired(now time.Time) bool {
+	return !r.Expires.IsZero() && !r.Expires.After(now)
+}
+
+/*
+file.ServiceManager stores instances in a directory on disk
+*/
+type ServiceManager struct {
+	dir          string
+	pollInterval time.Duration
+	hostname     string
+
+	// view reflects the contents of dir as of the last sync, and is responsible for
+	// answering queries and notifying watchers
+	view      *memory.ServiceManager
+	syncMutex sync.Mutex
+
+	shutdownChan chan bool
+	shutdownOnce sync.Once
+
+	// closed once poll() has returned
+	stoppedChan chan bool
+}
+
+/*
+file.New() returns a ServiceManager backed by dir, creating it if needed. The directory
+is checked for changes made by other processes every pollInterval.
+*/
+func New(dir string, pollInterval time.Duration) (sm *ServiceManager, err error) {
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+
+	if pollInterval <= 0 {
+		pollInterval = DefaultPollInterval
+	}
+
+	hostname, _ := os.Hostname()
+
+	sm = &ServiceManager{
+		dir:          dir,
+		pollInterval: pollInterval,
+		hostname:     hostname,
+		view:         memory.New(),
+		shutdownChan: make(chan bool),
+		stoppedChan:  make(chan bool),
+	}
+
+	if err = sm.sync(); err != nil {
+		return nil, err
+	}
+
+	go sm.poll()
+
+	return
+}
+
+/*
+ServiceManager.Add() writes a new instance, if the instance is already known it will be replaced
+*/
+func (sm *ServiceManager) Add(s skynet.ServiceInfo) error {
+	r := record{
+		Service: s,
+		Host:    sm.hostname,
+		Pid:     os.Getpid(),
+	}
+
+	unlock, err := sm.lock()
+	if err != nil {
+		return err
+	}
+
+	err = sm.write(r)
+	unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return sm.sync()
+}
+
+/*
+ServiceManager.Update() replaces the information about a known instance
+*/
+func (sm *ServiceManager) Update(s skynet.ServiceInfo) error {
+	return sm.modify(s.UUID, func(si *skynet.ServiceInfo) {
+		*si = s
+	})
+}
+
+/*
+ServiceManager.Remove() deletes an instance
+*/
+func (sm *ServiceManager) Remove(s skynet.ServiceInfo) error {
+	unlock, err := sm.lock()
+	if err != nil {
+		return err
+	}
+
+	err = sm.remove(s.UUID)
+	unlock()
+
+	if os.IsNotExist(err) {
+		return skynet.UnknownInstance
+	} else if err != nil {
+		return err
+	}
+
+	return sm.sync()
+}
+
+/*
+ServiceManager.Register() marks an instance as accepting requests
+*/
+func (sm *ServiceManager) Register(uuid string) error {
+	return sm.modify(uuid, func(si *skynet.ServiceInfo) {
+		si.Registered = true
+	})
+}
+
+/*
+ServiceManager.Unregister() marks an instance as no longer accepting requests
+*/
+func (sm *ServiceManager) Unregister(uuid string) error {
+	return sm.modify(uuid, func(si *skynet.ServiceInfo) {
+		si.Registered = false
+	})
+}
+
+/*
+ServiceManager.Heartbeat() renews the lease on an instance, if the lease is not renewed
+within ttl the instance will be removed by the first process to notice
+*/
+func (sm *ServiceManager) Heartbeat(uuid string, ttl time.Duration) error {
+	unlock, err := sm.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	r, err := sm.readRecord(uuid)
+
+	if os.IsNotExist(err) || (err == nil && r.expired(time.Now())) {
+		return skynet.UnknownInstance
+	} else if err != nil {
+		return err
+	}
+
+	r.Expires = time.Now().Add(ttl)
+
+	return sm.write(r)
+}
+
+/*
+ServiceManager.Shutdown() stops polling for changes, instances are left on disk
+*/
+func (sm *ServiceManager) Shutdown() error {
+	sm.shutdownOnce.Do(func() {
+		close(sm.shutdownChan)
+	})
+
+	// a sync in progress may still be using the directory
+	<-sm.stoppedChan
+
+	return nil
+}
+
+func (sm *ServiceManager) ListHosts(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.view.ListHosts(c)
+}
+
+func (sm *ServiceManager) ListRegions(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.view.ListRegions(c)
+}
+
+func (sm *ServiceManager) ListServices(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.view.ListServices(c)
+}
+
+func (sm *ServiceManager) ListVersions(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.view.ListVersions(c)
+}
+
+func (sm *ServiceManager) ListInstances(c skynet.CriteriaMatcher) ([]skynet.ServiceInfo, error) {
+	return sm.view.ListInstances(c)
+}
+
+/*
+ServiceManager.Watch() returns all instances that currently match the criteria, and notifies
+c of changes to matching instances, including those made by other processes, until the
+Subscription is closed
+*/
+func (sm *ServiceManager) Watch(criteria skynet.CriteriaMatcher, c chan<- skynet.InstanceNotification) ([]skynet.ServiceInfo, skynet.Subscription) {
+	return sm.view.Watch(criteria, c)
+}
+
+/*
+ServiceManager.Stale() returns instances that were added by a process on this host that
+is no longer running
+*/
+func (sm *ServiceManager) Stale() (instances []skynet.ServiceInfo, err error) {
+	records, err := sm.read()
+	if err != nil {
+		return
+	}
+
+	instances = []skynet.ServiceInfo{}
+
+	for _, r := range records {
+		if sm.isStale(r) {
+			instances = append(instances, r.Service)
+		}
+	}
+
+	return
+}
+
+/*
+ServiceManager.RemoveStale() removes instances that were added by a process on this host
+that is no longer running
+*/
+func (sm *ServiceManager) RemoveStale() error {
+	instances, err := sm.Stale()
+	if err != nil {
+		return err
+	}
+
+	unlock, err := sm.lock()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range instances {
+		log.Printf(log.INFO, "%+v", StaleInstanceRemoved{s})
+
+		if err = sm.remove(s.UUID); err != nil && !os.IsNotExist(err) {
+			unlock()
+			return err
+		}
+	}
+
+	unlock()
+
+	return sm.sync()
+}
+
+func (sm *ServiceManager) isStale(r record) bool {
+	if r.Host != sm.hostname || r.Pid <= 0 {
+		return false
+	}
+
+	// signal 0 performs error checking only, ESRCH means the process doesn't exist
+	return syscall.Kill(r.Pid, syscall.Signal(0)) == syscall.ESRCH
+}
+
+func (sm *ServiceManager) poll() {
+	defer close(sm.stoppedChan)
+
+	ticker := time.NewTicker(sm.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := sm.sync(); err != nil {
+				log.Println(log.ERROR, "Failed to read service directory", err)
+			}
+		case <-sm.shutdownChan:
+			return
+		}
+	}
+}
+
+// sync brings the view in line with the contents of the directory
+func (sm *ServiceManager) sync() error {
+	sm.syncMutex.Lock()
+	defer sm.syncMutex.Unlock()
+
+	// hold the lock until expired instances are removed, so that one renewed since we read it
+	// isn't removed
+	unlock, err := sm.lock()
+	if err != nil {
+		return err
+	}
+
+	records, err := sm.read()
+	if err != nil {
+		unlock()
+		return err
+	}
+
+	now := time.Now()
+	for uuid, r := range records {
+		if r.expired(now) {
+			log.Printf(log.WARN, "%+v", LeaseExpired{r.Service})
+
+			if err := sm.remove(uuid); err != nil && !os.IsNotExist(err) {
+				log.Println(log.ERROR, "Failed to remove expired instance", uuid, err)
+			}
+
+			delete(records, uuid)
+		}
+	}
+
+	unlock()
+
+	instances := make([]skynet.ServiceInfo, 0, len(records))
+	for _, r := range records {
+		instances = append(instances, r.Service)
+	}
+
+	sm.view.Replace(instances)
+
+	return nil
+}
+
+func (sm *ServiceManager) modify(uuid string, f func(si *skynet.ServiceInfo)) error {
+	unlock, err := sm.lock()
+	if err != nil {
+		return err
+	}
+
+	r, err := sm.readRecord(uuid)
+
+	if os.IsNotExist(err) {
+		unlock()
+		return skynet.UnknownInstance
+	} else if err != nil {
+		unlock()
+		return err
+	}
+
+	f(&r.Service)
+	r.Service.UUID = uuid
+
+	err = sm.write(r)
+	unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return sm.sync()
+}
+
+/*
+lock takes an exclusive lock on the directory, shared with every process using it, so that an
+instance read and then written isn't changed in between. Changes to the directory must be made
+while holding the lock.
+*/
+func (sm *ServiceManager) lock() (unlock func(), err error) {
+	f, err := os.OpenFile(filepath.Join(sm.dir, lockFile), os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return
+	}
+
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return
+	}
+
+	// closing the file releases the lock
+	return func() {
+		f.Close()
+	}, nil
+}
+
+func (sm *ServiceManager) read() (records map[string]record, err error) {
+	entries, err := os.ReadDir(sm.dir)
+	if err != nil {
+		return
+	}
+
+	records = make(map[string]record)
+
+	for _, e := range entries {
+		name := e.Name()
+
+		// skip temporary files that are still being written
+		if e.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, extension) {
+			continue
+		}
+
+		uuid := strings.TrimSuffix(name, extension)
+
+		r, err := sm.readRecord(uuid)
+		if err != nil {
+			// the instance may have been removed since we read the directory
+			if !os.IsNotExist(err) {
+				log.Println(log.ERROR, "Failed to read instance", name, err)
+			}
+
+			continue
+		}
+
+		records[r.Service.UUID] = r
+	}
+
+	return records, nil
+}
+
+func (sm *ServiceManager) readRecord(uuid string) (r record, err error) {
+	path, err := sm.path(uuid)
+	if err != nil {
+		return
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(b, &r)
+
+	return
+}
+
+func (sm *ServiceManager) write(r record) (err error) {
+	path, err := sm.path(r.Service.UUID)
+	if err != nil {
+		return
+	}
+
+	r.Updated = time.Now()
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+
+	f, err := os.CreateTemp(sm.dir, "."+r.Service.UUID+"-")
+	if err != nil {
+		return
+	}
+
+	_, err = f.Write(b)
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+	}
+
+	return
+}
+
+func (sm *ServiceManager) remove(uuid string) error {
+	path, err := sm.path(uuid)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// path returns the file an instance is stored in, UUIDs that would name a file outside of dir,
+// or a temporary file, are rejected
+func (sm *ServiceManager) path(uuid string) (string, error) {
+	if uuid == "" {
+		return "", MissingUUID
+	}
+
+	if strings.ContainsRune(uuid, '/') || strings.ContainsRune(uuid, filepath.Separator) || strings.HasPrefix(uuid, ".") {
+		return "", InvalidUUID
+	}
+
+	return filepath.Join(sm.dir, uuid+extension), nil
+}
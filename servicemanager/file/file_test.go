@@ -0,0 +1,223 @@
+package file
+
+import (
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/test"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAddRemove(t *testing.T) {
+	sm := newServiceManager(t, t.TempDir())
+	defer sm.Shutdown()
+
+	s := serviceInfo("1")
+
+	if err := sm.Add(s); err != nil {
+		t.Fatal(err)
+	}
+
+	if path, _ := sm.path(s.UUID); !exists(path) {
+		t.Fatal("Add() did not write instance to disk", path)
+	}
+
+	instances, _ := sm.ListInstances(&skynet.Criteria{})
+	if len(instances) != 1 || instances[0].UUID != s.UUID {
+		t.Fatal("ListInstances() did not return added instance", instances)
+	}
+
+	if err := sm.Register(s.UUID); err != nil {
+		t.Fatal(err)
+	}
+
+	instances, _ = sm.ListInstances(&skynet.Criteria{})
+	if !instances[0].Registered {
+		t.Fatal("Register() did not update instance")
+	}
+
+	if err := sm.Remove(s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sm.Remove(s); err != skynet.UnknownInstance {
+		t.Fatal("Remove() should fail for unknown instances")
+	}
+
+	if err := sm.Register(s.UUID); err != skynet.UnknownInstance {
+		t.Fatal("Register() should fail for unknown instances")
+	}
+}
+
+func TestChangesVisibleToOtherManagers(t *testing.T) {
+	dir := t.TempDir()
+
+	sm1 := newServiceManager(t, dir)
+	defer sm1.Shutdown()
+
+	sm2 := newServiceManager(t, dir)
+	defer sm2.Shutdown()
+
+	c := make(chan skynet.InstanceNotification, 10)
+	sm2.Watch(&skynet.Criteria{}, c)
+
+	s := serviceInfo("1")
+
+	sm1.Add(s)
+	test.ExpectNotification(t, c, skynet.InstanceAdded, s.UUID)
+
+	sm1.Register(s.UUID)
+	test.ExpectNotification(t, c, skynet.InstanceUpdated, s.UUID)
+
+	sm1.Remove(s)
+	test.ExpectNotification(t, c, skynet.InstanceRemoved, s.UUID)
+}
+
+func TestStale(t *testing.T) {
+	sm := newServiceManager(t, t.TempDir())
+	defer sm.Shutdown()
+
+	// find the pid of a process that is no longer running
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip("unable to run process", err)
+	}
+
+	sm.Add(serviceInfo("1"))
+	sm.write(record{
+		Service: serviceInfo("2"),
+		Host:    sm.hostname,
+		Pid:     cmd.Process.Pid,
+	})
+
+	stale, err := sm.Stale()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stale) != 1 || stale[0].UUID != "2" {
+		t.Fatal("Stale() did not detect instance of dead process", stale)
+	}
+
+	if err = sm.RemoveStale(); err != nil {
+		t.Fatal(err)
+	}
+
+	instances, _ := sm.ListInstances(&skynet.Criteria{})
+	if len(instances) != 1 || instances[0].UUID != "1" {
+		t.Fatal("RemoveStale() did not remove only stale instances", instances)
+	}
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	dir := t.TempDir()
+
+	sm1 := newServiceManager(t, dir)
+	defer sm1.Shutdown()
+
+	sm2 := newServiceManager(t, dir)
+	defer sm2.Shutdown()
+
+	c := make(chan skynet.InstanceNotification, 10)
+	sm2.Watch(&skynet.Criteria{}, c)
+
+	s := serviceInfo("1")
+	sm1.Add(s)
+	test.ExpectNotification(t, c, skynet.InstanceAdded, s.UUID)
+
+	if err := sm1.Heartbeat(s.UUID, 30*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	test.ExpectNotification(t, c, skynet.InstanceRemoved, s.UUID)
+
+	if err := sm1.Heartbeat(s.UUID, 30*time.Millisecond); err != skynet.UnknownInstance {
+		t.Fatal("Heartbeat() should fail for expired instances")
+	}
+}
+
+func TestInvalidUUID(t *testing.T) {
+	dir := t.TempDir()
+
+	sm := newServiceManager(t, filepath.Join(dir, "instances"))
+	defer sm.Shutdown()
+
+	for _, uuid := range []string{"../1", "a/../../1", "..", ".1"} {
+		if err := sm.Add(serviceInfo(uuid)); err != InvalidUUID {
+			t.Fatalf("Add() should reject UUID %q, got %v", uuid, err)
+		}
+
+		if err := sm.Remove(serviceInfo(uuid)); err != InvalidUUID {
+			t.Fatalf("Remove() should reject UUID %q, got %v", uuid, err)
+		}
+	}
+
+	if exists(filepath.Join(dir, "1"+extension)) {
+		t.Fatal("Instance written outside of the directory")
+	}
+}
+
+func TestHeartbeatWaitsForLock(t *testing.T) {
+	dir := t.TempDir()
+
+	sm1 := newServiceManager(t, dir)
+	defer sm1.Shutdown()
+
+	sm2 := newServiceManager(t, dir)
+	defer sm2.Shutdown()
+
+	s := serviceInfo("1")
+	sm1.Add(s)
+
+	// another process is part way through changing the instance
+	unlock, err := sm2.lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sm1.Heartbeat(s.UUID, time.Minute)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Heartbeat() changed the instance while the directory was locked")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newServiceManager(t *testing.T, dir string) *ServiceManager {
+	sm, err := New(dir, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sm
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func serviceInfo(uuid string) skynet.ServiceInfo {
+	return skynet.ServiceInfo{
+		UUID:    uuid,
+		Name:    "TestService",
+		Version: "1.0.0",
+		Region:  "Tampa",
+		ServiceAddr: skynet.BindAddr{
+			IPAddress: "127.0.0.1",
+			Port:      9000,
+		},
+	}
+}
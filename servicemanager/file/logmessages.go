@@ -0,0 +1,22 @@
+package file
+
+import (
+	"fmt"
+	"github.com/skynetservices/skynet"
+)
+
+type StaleInstanceRemoved struct {
+	Service skynet.ServiceInfo
+}
+
+func (sr StaleInstanceRemoved) String() string {
+	return fmt.Sprintf("Removed stale instance %q of service %q at %s", sr.Service.UUID, sr.Service.Name, sr.Service.AddrString())
+}
+
+type LeaseExpired struct {
+	Service skynet.ServiceInfo
+}
+
+func (le LeaseExpired) String() string {
+	return fmt.Sprintf("Lease expired for instance %q of service %q at %s", le.Service.UUID, le.Service.Name, le.Service.AddrString())
+}
@@ -0,0 +1,1168 @@
+/*
+Package gossip provides a decentralized skynet.ServiceManager. Every process joins a
+group of members over UDP, and the instances each member adds are spread to the rest
+of the group by gossip, so no coordination service is required.
+
+Failures are detected in the style of SWIM: each member periodically probes another,
+asking others to probe it indirectly if it fails to respond. A member that can't be
+reached is suspected and, if it doesn't refute the suspicion in time, declared dead
+and its instances are removed. Changes are piggybacked on probes and periodically
+exchanged in full with a random member so that the group converges.
+
+Messages are UDP datagrams of at most 64KB of JSON. States that don't fit in one are
+spread over several, and the instances of a member too many for a single datagram are
+sent in parts, which are applied once every part has arrived.
+*/
+package gossip
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/config"
+	"github.com/skynetservices/skynet/log"
+	"github.com/skynetservices/skynet/servicemanager/memory"
+	"math"
+	"math/rand"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxPacketSize = 65507
+
+	// the maximum number of member updates piggybacked on a single message
+	maxPiggyback = 8
+)
+
+var (
+	RemoteInstance = errors.New("Instance belongs to another member")
+	NotRunning     = errors.New("ServiceManager is shut down")
+)
+
+// Config controls how a ServiceManager joins and participates in the group
+type Config struct {
+	// BindAddr is the UDP address to listen on, use port 0 to choose any available port.
+	BindAddr string
+	// Seeds are the addresses of existing members to join through.
+	Seeds []string
+
+	// ProbeInterval is how often a member is probed.
+	ProbeInterval time.Duration
+	// ProbeTimeout is how long to wait for a response before probing indirectly.
+	ProbeTimeout time.Duration
+	// IndirectChecks is how many members are asked to probe a member that didn't respond.
+	IndirectChecks int
+	// SuspicionTimeout is how long a suspected member has to refute before it is declared dead.
+	SuspicionTimeout time.Duration
+
+	// GossipInterval is how often changes are sent to GossipFanout random members.
+	GossipInterval time.Duration
+	GossipFanout   int
+	// SyncInterval is how often full state is exchanged with a random member.
+	SyncInterval time.Duration
+
+	// DeadRetention is how long dead members are remembered, preventing stale gossip from reviving them.
+	DeadRetention time.Duration
+}
+
+/*
+gossip.DefaultConfig() returns the default configuration, using the gossip.bind and
+gossip.seeds (comma separated) keys from the skynet config if they are provided
+*/
+func DefaultConfig() Config {
+	c := Config{
+		BindAddr:         "0.0.0.0:7946",
+		ProbeInterval:    1 * time.Second,
+		ProbeTimeout:     500 * time.Millisecond,
+		IndirectChecks:   3,
+		SuspicionTimeout: 5 * time.Second,
+		GossipInterval:   200 * time.Millisecond,
+		GossipFanout:     3,
+		SyncInterval:     10 * time.Second,
+		DeadRetention:    30 * time.Second,
+	}
+
+	if b, err := config.RawStringDefault("gossip.bind"); err == nil && b != "" {
+		c.BindAddr = b
+	}
+
+	if s, err := config.RawStringDefault("gossip.seeds"); err == nil && s != "" {
+		for _, seed := range strings.Split(s, ",") {
+			if seed = strings.TrimSpace(seed); seed != "" {
+				c.Seeds = append(c.Seeds, seed)
+			}
+		}
+	}
+
+	return c
+}
+
+const (
+	stateAlive = iota
+	stateSuspect
+	stateDead
+	stateLeft
+)
+
+// memberState is what is gossiped about each member
+type memberState struct {
+	ID          string
+	Addr        string
+	Incarnation uint64
+	State       int
+
+	// Version increases every time the member changes its instances
+	Version  uint64
+	Services []skynet.ServiceInfo
+
+	// Part of Parts when the instances are too many for one datagram, each part has a share
+	// of them
+	Part  int `json:",omitempty"`
+	Parts int `json:",omitempty"`
+}
+
+// the parts of a version of a member's instances received so far
+type partialState struct {
+	version uint64
+	parts   map[int][]skynet.ServiceInfo
+}
+
+type member struct {
+	memberState
+
+	// when the member entered its current state
+	stateChanged time.Time
+}
+
+func (m *member) active() bool {
+	return m.State == stateAlive || m.State == stateSuspect
+}
+
+const (
+	msgPing = iota
+	msgAck
+	msgPingReq
+	msgSync
+)
+
+type message struct {
+	Type int
+	Seq  uint64
+	From string
+
+	// Target is the address to probe for msgPingReq
+	Target string
+	// Reply indicates a msgSync is the response to a msgSync, and should not be answered
+	Reply bool
+
+	Members []memberState
+}
+
+type broadcast struct {
+	id        string
+	transmits int
+}
+
+/*
+gossip.ServiceManager is a member of a gossip group, and implements skynet.ServiceManager
+using the instances of every member it knows to be alive
+*/
+type ServiceManager struct {
+	config Config
+	conn   *net.UDPConn
+
+	mutex   sync.Mutex
+	self    *member
+	members map[string]*member
+	leases  map[string]time.Time
+
+	// members whose instances are still arriving in parts
+	partials map[string]*partialState
+
+	broadcasts []*broadcast
+	seq        uint64
+	acks       map[uint64]chan bool
+	probeOrder []string
+
+	// view reflects the instances of all active members, and is responsible for
+	// answering queries and notifying watchers
+	view      *memory.ServiceManager
+	viewMutex sync.Mutex
+
+	shutdownChan chan bool
+	shutdownOnce sync.Once
+}
+
+/*
+gossip.New() starts a new member and joins the group through the configured seeds
+*/
+func New(c Config) (sm *ServiceManager, err error) {
+	addr, err := net.ResolveUDPAddr("udp", c.BindAddr)
+	if err != nil {
+		return
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return
+	}
+
+	sm = &ServiceManager{
+		config:       c,
+		conn:         conn,
+		members:      make(map[string]*member),
+		leases:       make(map[string]time.Time),
+		partials:     make(map[string]*partialState),
+		acks:         make(map[uint64]chan bool),
+		view:         memory.New(),
+		shutdownChan: make(chan bool),
+	}
+
+	sm.self = &member{
+		memberState: memberState{
+			ID:    config.NewUUID(),
+			Addr:  advertiseAddr(conn.LocalAddr().(*net.UDPAddr)),
+			State: stateAlive,
+		},
+		stateChanged: time.Now(),
+	}
+
+	go sm.receive()
+	go sm.run()
+
+	sm.join()
+
+	return
+}
+
+/*
+ServiceManager.Addr() returns the address other members can reach this member on
+*/
+func (sm *ServiceManager) Addr() string {
+	return sm.self.Addr
+}
+
+/*
+ServiceManager.Members() returns the addresses of all members believed to be alive,
+including this one
+*/
+func (sm *ServiceManager) Members() (addrs []string) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	addrs = []string{sm.self.Addr}
+
+	for _, m := range sm.members {
+		if m.active() {
+			addrs = append(addrs, m.Addr)
+		}
+	}
+
+	return
+}
+
+/*
+ServiceManager.Add() adds an instance owned by this member and gossips it to the group
+*/
+func (sm *ServiceManager) Add(s skynet.ServiceInfo) error {
+	return sm.modifyLocal(func() error {
+		for i, existing := range sm.self.Services {
+			if existing.UUID == s.UUID {
+				sm.self.Services[i] = s
+				delete(sm.leases, s.UUID)
+				return nil
+			}
+		}
+
+		sm.self.Services = append(sm.self.Services, s)
+		return nil
+	})
+}
+
+/*
+ServiceManager.Update() replaces an instance owned by this member
+*/
+func (sm *ServiceManager) Update(s skynet.ServiceInfo) error {
+	return sm.modifyInstance(s.UUID, func(si *skynet.ServiceInfo) {
+		*si = s
+	})
+}
+
+/*
+ServiceManager.Remove() removes an instance owned by this member
+*/
+func (sm *ServiceManager) Remove(s skynet.ServiceInfo) error {
+	return sm.modifyLocal(func() error {
+		for i, existing := range sm.self.Services {
+			if existing.UUID == s.UUID {
+				sm.self.Services = append(sm.self.Services[:i], sm.self.Services[i+1:]...)
+				delete(sm.leases, s.UUID)
+				return nil
+			}
+		}
+
+		return sm.unknown(s.UUID)
+	})
+}
+
+/*
+ServiceManager.Register() marks an instance owned by this member as accepting requests
+*/
+func (sm *ServiceManager) Register(uuid string) error {
+	return sm.modifyInstance(uuid, func(si *skynet.ServiceInfo) {
+		si.Registered = true
+	})
+}
+
+/*
+ServiceManager.Unregister() marks an instance owned by this member as no longer accepting requests
+*/
+func (sm *ServiceManager) Unregister(uuid string) error {
+	return sm.modifyInstance(uuid, func(si *skynet.ServiceInfo) {
+		si.Registered = false
+	})
+}
+
+/*
+ServiceManager.Heartbeat() renews the lease on an instance owned by this member. Instances
+of members that stop responding are removed by failure detection, leases additionally
+remove instances whose process is alive but no longer renewing.
+*/
+func (sm *ServiceManager) Heartbeat(uuid string, ttl time.Duration) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	for _, s := range sm.self.Services {
+		if s.UUID == uuid {
+			sm.leases[uuid] = time.Now().Add(ttl)
+			return nil
+		}
+	}
+
+	return sm.unknown(uuid)
+}
+
+/*
+ServiceManager.Shutdown() tells the group this member is leaving, and stops participating
+*/
+func (sm *ServiceManager) Shutdown() error {
+	sm.shutdownOnce.Do(func() {
+		sm.mutex.Lock()
+		sm.self.Incarnation++
+		sm.self.State = stateLeft
+		sm.self.Services = nil
+		leave := message{Type: msgSync, Reply: true, From: sm.self.ID, Members: []memberState{sm.self.memberState}}
+		targets := sm.randomMembers(sm.config.GossipFanout, "")
+		sm.mutex.Unlock()
+
+		for _, m := range targets {
+			sm.send(m.Addr, leave)
+		}
+
+		sm.stop()
+	})
+
+	return nil
+}
+
+// stop leaves the group without telling anyone, as if the process had died
+func (sm *ServiceManager) stop() {
+	close(sm.shutdownChan)
+	sm.conn.Close()
+}
+
+func (sm *ServiceManager) ListHosts(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.view.ListHosts(c)
+}
+
+func (sm *ServiceManager) ListRegions(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.view.ListRegions(c)
+}
+
+func (sm *ServiceManager) ListServices(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.view.ListServices(c)
+}
+
+func (sm *ServiceManager) ListVersions(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.view.ListVersions(c)
+}
+
+func (sm *ServiceManager) ListInstances(c skynet.CriteriaMatcher) ([]skynet.ServiceInfo, error) {
+	return sm.view.ListInstances(c)
+}
+
+/*
+ServiceManager.Watch() returns all instances that currently match the criteria, and notifies
+c as members join, leave, fail or change their instances, until the Subscription is closed
+*/
+func (sm *ServiceManager) Watch(criteria skynet.CriteriaMatcher, c chan<- skynet.InstanceNotification) ([]skynet.ServiceInfo, skynet.Subscription) {
+	return sm.view.Watch(criteria, c)
+}
+
+func (sm *ServiceManager) modifyInstance(uuid string, f func(si *skynet.ServiceInfo)) error {
+	return sm.modifyLocal(func() error {
+		for i := range sm.self.Services {
+			if sm.self.Services[i].UUID == uuid {
+				f(&sm.self.Services[i])
+				sm.self.Services[i].UUID = uuid
+				return nil
+			}
+		}
+
+		return sm.unknown(uuid)
+	})
+}
+
+// modifyLocal applies a change to our own instances and spreads it to the group
+func (sm *ServiceManager) modifyLocal(f func() error) error {
+	select {
+	case <-sm.shutdownChan:
+		return NotRunning
+	default:
+	}
+
+	sm.mutex.Lock()
+
+	// states already handed out share the old slice, never change it in place
+	sm.self.Services = append([]skynet.ServiceInfo(nil), sm.self.Services...)
+
+	if err := f(); err != nil {
+		sm.mutex.Unlock()
+		return err
+	}
+
+	sm.self.Version++
+	sm.queueBroadcast(sm.self.ID)
+	sm.mutex.Unlock()
+
+	sm.syncView()
+
+	return nil
+}
+
+// unknown returns the error for an instance that isn't ours, must be called with mutex held
+func (sm *ServiceManager) unknown(uuid string) error {
+	for _, m := range sm.members {
+		for _, s := range m.Services {
+			if s.UUID == uuid {
+				return RemoteInstance
+			}
+		}
+	}
+
+	return skynet.UnknownInstance
+}
+
+func (sm *ServiceManager) join() {
+	sm.mutex.Lock()
+	msg := message{Type: msgSync, From: sm.self.ID, Members: sm.allStates()}
+	sm.mutex.Unlock()
+
+	for _, seed := range sm.config.Seeds {
+		if seed != sm.self.Addr {
+			sm.send(seed, msg)
+		}
+	}
+}
+
+func (sm *ServiceManager) run() {
+	probeTicker := time.NewTicker(sm.config.ProbeInterval)
+	defer probeTicker.Stop()
+
+	gossipTicker := time.NewTicker(sm.config.GossipInterval)
+	defer gossipTicker.Stop()
+
+	syncTicker := time.NewTicker(sm.config.SyncInterval)
+	defer syncTicker.Stop()
+
+	for {
+		select {
+		case <-probeTicker.C:
+			go sm.probe()
+
+			// keep trying to join until we know of someone
+			if sm.isolated() {
+				sm.join()
+			}
+		case <-gossipTicker.C:
+			sm.checkTimeouts()
+			sm.gossip()
+		case <-syncTicker.C:
+			sm.pushPull()
+		case <-sm.shutdownChan:
+			return
+		}
+	}
+}
+
+func (sm *ServiceManager) isolated() bool {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	for _, m := range sm.members {
+		if m.active() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// probe checks that the next member in the probe order is alive
+func (sm *ServiceManager) probe() {
+	sm.mutex.Lock()
+	target := sm.nextProbeTarget()
+	if target == nil {
+		sm.mutex.Unlock()
+		return
+	}
+
+	addr, id := target.Addr, target.ID
+	seq, ack := sm.newAck()
+	ping := sm.withPiggyback(message{Type: msgPing, Seq: seq, From: sm.self.ID})
+	sm.mutex.Unlock()
+
+	defer sm.clearAck(seq)
+
+	sm.send(addr, ping)
+
+	select {
+	case <-ack:
+		return
+	case <-time.After(sm.config.ProbeTimeout):
+	case <-sm.shutdownChan:
+		return
+	}
+
+	// ask others to probe it for us in case the problem is between us and them
+	sm.mutex.Lock()
+	helpers := sm.randomMembers(sm.config.IndirectChecks, id)
+	req := sm.withPiggyback(message{Type: msgPingReq, Seq: seq, From: sm.self.ID, Target: addr})
+	sm.mutex.Unlock()
+
+	for _, h := range helpers {
+		sm.send(h.Addr, req)
+	}
+
+	remaining := sm.config.ProbeInterval - sm.config.ProbeTimeout
+	if remaining <= 0 {
+		remaining = sm.config.ProbeTimeout
+	}
+
+	select {
+	case <-ack:
+		return
+	case <-time.After(remaining):
+	case <-sm.shutdownChan:
+		return
+	}
+
+	sm.mutex.Lock()
+	if m, ok := sm.members[id]; ok && m.State == stateAlive {
+		log.Printf(log.WARN, "%+v", MemberSuspected{m.ID, m.Addr})
+		sm.setState(m, stateSuspect)
+		sm.queueBroadcast(m.ID)
+	}
+	sm.mutex.Unlock()
+}
+
+// must be called with mutex held
+func (sm *ServiceManager) nextProbeTarget() *member {
+	for attempts := 0; attempts < 2; attempts++ {
+		for len(sm.probeOrder) > 0 {
+			id := sm.probeOrder[0]
+			sm.probeOrder = sm.probeOrder[1:]
+
+			if m, ok := sm.members[id]; ok && m.active() {
+				return m
+			}
+		}
+
+		// start a new round in a random order
+		for id, m := range sm.members {
+			if m.active() {
+				sm.probeOrder = append(sm.probeOrder, id)
+			}
+		}
+
+		for i := range sm.probeOrder {
+			j := rand.Intn(i + 1)
+			sm.probeOrder[i], sm.probeOrder[j] = sm.probeOrder[j], sm.probeOrder[i]
+		}
+	}
+
+	return nil
+}
+
+// checkTimeouts declares suspects that haven't refuted dead, forgets long dead members
+// and removes our own instances whose lease lapsed
+func (sm *ServiceManager) checkTimeouts() {
+	now := time.Now()
+	changed := false
+
+	sm.mutex.Lock()
+
+	for id, m := range sm.members {
+		switch {
+		case m.State == stateSuspect && now.Sub(m.stateChanged) > sm.config.SuspicionTimeout:
+			log.Printf(log.WARN, "%+v", MemberFailed{m.ID, m.Addr})
+			sm.setState(m, stateDead)
+			sm.queueBroadcast(id)
+			changed = true
+		case !m.active() && now.Sub(m.stateChanged) > sm.config.DeadRetention:
+			delete(sm.members, id)
+			delete(sm.partials, id)
+		}
+	}
+
+	expired := false
+	for uuid, expires := range sm.leases {
+		if expires.After(now) {
+			continue
+		}
+
+		services := []skynet.ServiceInfo{}
+		for _, s := range sm.self.Services {
+			if s.UUID == uuid {
+				log.Printf(log.WARN, "%+v", LeaseExpired{s})
+				continue
+			}
+
+			services = append(services, s)
+		}
+
+		sm.self.Services = services
+
+		delete(sm.leases, uuid)
+		expired = true
+	}
+
+	if expired {
+		sm.self.Version++
+		sm.queueBroadcast(sm.self.ID)
+		changed = true
+	}
+
+	sm.mutex.Unlock()
+
+	if changed {
+		sm.syncView()
+	}
+}
+
+// gossip sends pending changes to random members
+func (sm *ServiceManager) gossip() {
+	sm.mutex.Lock()
+	if len(sm.broadcasts) == 0 {
+		sm.mutex.Unlock()
+		return
+	}
+
+	targets := sm.randomMembers(sm.config.GossipFanout, "")
+	msgs := make([]message, len(targets))
+	for i := range targets {
+		msgs[i] = sm.withPiggyback(message{Type: msgSync, Reply: true, From: sm.self.ID})
+	}
+	sm.mutex.Unlock()
+
+	for i, m := range targets {
+		sm.send(m.Addr, msgs[i])
+	}
+}
+
+// pushPull exchanges full state with a random member, repairing anything gossip missed
+func (sm *ServiceManager) pushPull() {
+	sm.mutex.Lock()
+	targets := sm.randomMembers(1, "")
+	msg := message{Type: msgSync, From: sm.self.ID, Members: sm.allStates()}
+	sm.mutex.Unlock()
+
+	for _, m := range targets {
+		sm.send(m.Addr, msg)
+	}
+}
+
+func (sm *ServiceManager) receive() {
+	b := make([]byte, maxPacketSize)
+
+	for {
+		n, from, err := sm.conn.ReadFromUDP(b)
+		if err != nil {
+			select {
+			case <-sm.shutdownChan:
+				return
+			default:
+			}
+
+			log.Println(log.ERROR, "Failed to read gossip message", err)
+			continue
+		}
+
+		var msg message
+		if err = json.Unmarshal(b[:n], &msg); err != nil {
+			log.Println(log.ERROR, "Failed to decode gossip message from", from.String(), err)
+			continue
+		}
+
+		sm.handle(msg, from)
+	}
+}
+
+func (sm *ServiceManager) handle(msg message, from *net.UDPAddr) {
+	if sm.merge(msg.Members) {
+		sm.syncView()
+	}
+
+	switch msg.Type {
+	case msgPing:
+		sm.mutex.Lock()
+		ack := sm.withPiggyback(message{Type: msgAck, Seq: msg.Seq, From: sm.self.ID})
+		sm.mutex.Unlock()
+
+		sm.send(from.String(), ack)
+
+	case msgAck:
+		sm.mutex.Lock()
+		if c, ok := sm.acks[msg.Seq]; ok {
+			select {
+			case c <- true:
+			default:
+			}
+		}
+		sm.mutex.Unlock()
+
+	case msgPingReq:
+		go sm.probeFor(msg.Target, msg.Seq, from.String())
+
+	case msgSync:
+		if !msg.Reply {
+			sm.mutex.Lock()
+			reply := message{Type: msgSync, Reply: true, From: sm.self.ID, Members: sm.allStates()}
+			sm.mutex.Unlock()
+
+			sm.send(from.String(), reply)
+		}
+	}
+}
+
+// probeFor probes target on behalf of another member, and forwards the ack if it responds
+func (sm *ServiceManager) probeFor(target string, origSeq uint64, requester string) {
+	sm.mutex.Lock()
+	seq, ack := sm.newAck()
+	ping := sm.withPiggyback(message{Type: msgPing, Seq: seq, From: sm.self.ID})
+	sm.mutex.Unlock()
+
+	defer sm.clearAck(seq)
+
+	sm.send(target, ping)
+
+	select {
+	case <-ack:
+		sm.mutex.Lock()
+		fwd := sm.withPiggyback(message{Type: msgAck, Seq: origSeq, From: sm.self.ID})
+		sm.mutex.Unlock()
+
+		sm.send(requester, fwd)
+	case <-time.After(sm.config.ProbeTimeout):
+	case <-sm.shutdownChan:
+	}
+}
+
+// merge applies gossiped member states, returning true if any instances may have changed
+func (sm *ServiceManager) merge(states []memberState) (changed bool) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	for _, ms := range states {
+		if ms.ID == sm.self.ID {
+			sm.refute(ms)
+			continue
+		}
+
+		if ms.Parts > 1 {
+			ms = sm.assemble(ms)
+		}
+
+		m, ok := sm.members[ms.ID]
+		if !ok {
+			m = &member{memberState: ms, stateChanged: time.Now()}
+			sm.members[ms.ID] = m
+			sm.queueBroadcast(ms.ID)
+
+			if m.active() {
+				log.Printf(log.INFO, "%+v", MemberJoined{m.ID, m.Addr})
+				changed = true
+			}
+
+			continue
+		}
+
+		updated := false
+
+		if ms.Incarnation > m.Incarnation || (ms.Incarnation == m.Incarnation && ms.State > m.State) {
+			if ms.State != m.State {
+				sm.logTransition(m, ms.State)
+				sm.setState(m, ms.State)
+			}
+
+			m.Incarnation = ms.Incarnation
+			m.Addr = ms.Addr
+			updated = true
+		}
+
+		if ms.Version > m.Version {
+			m.Version = ms.Version
+			m.Services = ms.Services
+			updated = true
+		}
+
+		if updated {
+			sm.queueBroadcast(ms.ID)
+			changed = true
+		}
+	}
+
+	return
+}
+
+// assemble collects the parts of a member's instances, returning the state with every instance
+// once all parts of its version have arrived, and until then without its instances or version
+// so that only the rest of it is applied. Must be called with mutex held
+func (sm *ServiceManager) assemble(ms memberState) memberState {
+	part, parts, services := ms.Part, ms.Parts, ms.Services
+	ms.Part, ms.Parts, ms.Services = 0, 0, nil
+
+	incomplete := ms
+	incomplete.Version = 0
+
+	// we already have this version, or a newer one
+	if m, ok := sm.members[ms.ID]; ok && ms.Version <= m.Version {
+		return incomplete
+	}
+
+	p, ok := sm.partials[ms.ID]
+	if !ok || ms.Version > p.version {
+		p = &partialState{version: ms.Version, parts: make(map[int][]skynet.ServiceInfo)}
+		sm.partials[ms.ID] = p
+	} else if ms.Version < p.version {
+		return incomplete
+	}
+
+	if part < 0 || part >= parts {
+		return incomplete
+	}
+
+	p.parts[part] = services
+
+	if len(p.parts) < parts {
+		return incomplete
+	}
+
+	delete(sm.partials, ms.ID)
+
+	for i := 0; i < parts; i++ {
+		ms.Services = append(ms.Services, p.parts[i]...)
+	}
+
+	return ms
+}
+
+// refute disputes gossip that we are suspected or dead by announcing a newer incarnation,
+// must be called with mutex held
+func (sm *ServiceManager) refute(ms memberState) {
+	if ms.State == stateAlive || ms.Incarnation < sm.self.Incarnation || sm.self.State != stateAlive {
+		return
+	}
+
+	sm.self.Incarnation = ms.Incarnation + 1
+	sm.queueBroadcast(sm.self.ID)
+}
+
+// must be called with mutex held
+func (sm *ServiceManager) setState(m *member, state int) {
+	m.State = state
+	m.stateChanged = time.Now()
+}
+
+func (sm *ServiceManager) logTransition(m *member, state int) {
+	switch state {
+	case stateAlive:
+		log.Printf(log.INFO, "%+v", MemberJoined{m.ID, m.Addr})
+	case stateSuspect:
+		log.Printf(log.WARN, "%+v", MemberSuspected{m.ID, m.Addr})
+	case stateDead:
+		log.Printf(log.WARN, "%+v", MemberFailed{m.ID, m.Addr})
+	case stateLeft:
+		log.Printf(log.INFO, "%+v", MemberLeft{m.ID, m.Addr})
+	}
+}
+
+// syncView brings the view in line with the instances of all active members
+func (sm *ServiceManager) syncView() {
+	sm.viewMutex.Lock()
+	defer sm.viewMutex.Unlock()
+
+	sm.mutex.Lock()
+	instances := make(map[string]skynet.ServiceInfo)
+
+	for _, s := range sm.self.Services {
+		instances[s.UUID] = s
+	}
+
+	for _, m := range sm.members {
+		if m.active() {
+			for _, s := range m.Services {
+				instances[s.UUID] = s
+			}
+		}
+	}
+	sm.mutex.Unlock()
+
+	known, _ := sm.view.ListInstances(&skynet.Criteria{})
+
+	for _, s := range known {
+		current, ok := instances[s.UUID]
+
+		if !ok {
+			sm.view.Remove(s)
+		} else if !reflect.DeepEqual(current, s) {
+			sm.view.Update(current)
+		}
+
+		delete(instances, s.UUID)
+	}
+
+	for _, s := range instances {
+		sm.view.Add(s)
+	}
+}
+
+// must be called with mutex held
+func (sm *ServiceManager) queueBroadcast(id string) {
+	for _, b := range sm.broadcasts {
+		if b.id == id {
+			b.transmits = 0
+			return
+		}
+	}
+
+	sm.broadcasts = append(sm.broadcasts, &broadcast{id: id})
+}
+
+// withPiggyback attaches the least transmitted pending changes to msg,
+// must be called with mutex held
+func (sm *ServiceManager) withPiggyback(msg message) message {
+	sort.Sort(byTransmits(sm.broadcasts))
+
+	limit := sm.retransmitLimit()
+	remaining := sm.broadcasts[:0]
+
+	for i, b := range sm.broadcasts {
+		if i < maxPiggyback {
+			if ms, ok := sm.state(b.id); ok {
+				msg.Members = append(msg.Members, ms)
+			}
+
+			b.transmits++
+		}
+
+		if b.transmits < limit {
+			remaining = append(remaining, b)
+		}
+	}
+
+	sm.broadcasts = remaining
+
+	return msg
+}
+
+type byTransmits []*broadcast
+
+func (b byTransmits) Len() int           { return len(b) }
+func (b byTransmits) Less(i, j int) bool { return b[i].transmits < b[j].transmits }
+func (b byTransmits) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// retransmitLimit is how many times a change is sent, scaled by the size of the group
+func (sm *ServiceManager) retransmitLimit() int {
+	return 3 * int(math.Ceil(math.Log10(float64(len(sm.members)+2))+1))
+}
+
+// must be called with mutex held
+func (sm *ServiceManager) state(id string) (memberState, bool) {
+	if id == sm.self.ID {
+		return sm.self.memberState, true
+	}
+
+	if m, ok := sm.members[id]; ok {
+		return m.memberState, true
+	}
+
+	return memberState{}, false
+}
+
+// must be called with mutex held
+func (sm *ServiceManager) allStates() []memberState {
+	states := []memberState{sm.self.memberState}
+
+	for _, m := range sm.members {
+		states = append(states, m.memberState)
+	}
+
+	return states
+}
+
+// randomMembers returns up to n random active members, other than exclude,
+// must be called with mutex held
+func (sm *ServiceManager) randomMembers(n int, exclude string) (members []*member) {
+	for id, m := range sm.members {
+		if id != exclude && m.active() {
+			members = append(members, m)
+		}
+	}
+
+	for i := range members {
+		j := rand.Intn(i + 1)
+		members[i], members[j] = members[j], members[i]
+	}
+
+	if len(members) > n {
+		members = members[:n]
+	}
+
+	return
+}
+
+// must be called with mutex held
+func (sm *ServiceManager) newAck() (uint64, chan bool) {
+	sm.seq++
+	c := make(chan bool, 1)
+	sm.acks[sm.seq] = c
+
+	return sm.seq, c
+}
+
+func (sm *ServiceManager) clearAck(seq uint64) {
+	sm.mutex.Lock()
+	delete(sm.acks, seq)
+	sm.mutex.Unlock()
+}
+
+func (sm *ServiceManager) send(addr string, msg message) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		log.Println(log.ERROR, "Failed to resolve member address", addr, err)
+		return
+	}
+
+	for _, b := range encode(msg) {
+		if _, err = sm.conn.WriteToUDP(b, udpAddr); err != nil {
+			select {
+			case <-sm.shutdownChan:
+			default:
+				log.Println(log.ERROR, "Failed to send gossip message to", addr, err)
+			}
+
+			return
+		}
+	}
+}
+
+/*
+encode returns msg as datagrams of at most maxPacketSize. States that don't fit are moved to
+further datagrams, and the instances of a member too many for a datagram of their own are split
+into parts. Only the first datagram is msg, the others are sync replies so they aren't answered.
+*/
+func encode(msg message) [][]byte {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		log.Println(log.ERROR, "Failed to encode gossip message", err)
+		return nil
+	}
+
+	if len(b) <= maxPacketSize {
+		return [][]byte{b}
+	}
+
+	switch {
+	case len(msg.Members) > 1:
+		half := len(msg.Members) / 2
+		rest := message{Type: msgSync, Reply: true, From: msg.From, Members: msg.Members[half:]}
+		msg.Members = msg.Members[:half]
+
+		return append(encode(msg), encode(rest)...)
+
+	case len(msg.Members) == 1 && len(msg.Members[0].Services) > 1:
+		ms := msg.Members[0]
+		msg.Members = nil
+
+		var packets [][]byte
+		if msg.Type != msgSync || !msg.Reply {
+			packets = encode(msg)
+		}
+
+		for n := len(b)/maxPacketSize + 1; ; n *= 2 {
+			if parts, ok := encodeParts(msg.From, ms, n); ok {
+				return append(packets, parts...)
+			}
+		}
+	}
+
+	log.Println(log.ERROR, "Gossip message exceeds maximum packet size", len(b))
+	return nil
+}
+
+// encodeParts splits the instances of ms into n parts, returning false if a part doesn't fit in
+// a datagram and could be split further
+func encodeParts(from string, ms memberState, n int) (packets [][]byte, ok bool) {
+	if n > len(ms.Services) {
+		n = len(ms.Services)
+	}
+
+	services := ms.Services
+
+	for i := 0; i < n; i++ {
+		part := ms
+		part.Part, part.Parts = i, n
+		part.Services = services[i*len(services)/n : (i+1)*len(services)/n]
+
+		b, err := json.Marshal(message{Type: msgSync, Reply: true, From: from, Members: []memberState{part}})
+		if err != nil {
+			log.Println(log.ERROR, "Failed to encode gossip message", err)
+			return nil, true
+		}
+
+		if len(b) > maxPacketSize {
+			if n < len(services) {
+				return nil, false
+			}
+
+			log.Println(log.ERROR, "Gossip message exceeds maximum packet size", len(b))
+			return nil, true
+		}
+
+		packets = append(packets, b)
+	}
+
+	return packets, true
+}
+
+// advertiseAddr determines the address other members should use to reach us
+func advertiseAddr(addr *net.UDPAddr) string {
+	if addr.IP == nil || addr.IP.IsUnspecified() {
+		host := config.DefaultHost
+
+		if h, err := config.RawStringDefault("host"); err == nil && h != "" {
+			host = h
+		}
+
+		return net.JoinHostPort(host, strconv.Itoa(addr.Port))
+	}
+
+	return addr.String()
+}
@@ -0,0 +1,260 @@
+package gossip
+
+import (
+	"encoding/json"
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/test"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestInstancesSpreadToGroup(t *testing.T) {
+	group := newGroup(t, 3)
+	defer shutdownGroup(group)
+
+	c := make(chan skynet.InstanceNotification, 10)
+	group[2].Watch(&skynet.Criteria{}, c)
+
+	s := serviceInfo("1")
+
+	if err := group[0].Add(s); err != nil {
+		t.Fatal(err)
+	}
+	test.ExpectNotification(t, c, skynet.InstanceAdded, s.UUID)
+
+	if err := group[0].Register(s.UUID); err != nil {
+		t.Fatal(err)
+	}
+	n := test.ExpectNotification(t, c, skynet.InstanceUpdated, s.UUID)
+	if !n.Service.Registered {
+		t.Fatal("Update was not gossiped")
+	}
+
+	if err := group[0].Remove(s); err != nil {
+		t.Fatal(err)
+	}
+	test.ExpectNotification(t, c, skynet.InstanceRemoved, s.UUID)
+}
+
+func TestRemoteInstancesCannotBeModified(t *testing.T) {
+	group := newGroup(t, 2)
+	defer shutdownGroup(group)
+
+	c := make(chan skynet.InstanceNotification, 10)
+	group[1].Watch(&skynet.Criteria{}, c)
+
+	s := serviceInfo("1")
+	group[0].Add(s)
+	test.ExpectNotification(t, c, skynet.InstanceAdded, s.UUID)
+
+	if err := group[1].Register(s.UUID); err != RemoteInstance {
+		t.Fatal("Register() should fail for instances owned by other members", err)
+	}
+
+	if err := group[1].Register("unknown"); err != skynet.UnknownInstance {
+		t.Fatal("Register() should fail for unknown instances", err)
+	}
+}
+
+func TestFailedMemberInstancesRemoved(t *testing.T) {
+	group := newGroup(t, 3)
+	defer shutdownGroup(group[:2])
+
+	c := make(chan skynet.InstanceNotification, 10)
+	group[0].Watch(&skynet.Criteria{}, c)
+
+	s := serviceInfo("1")
+	group[2].Add(s)
+	test.ExpectNotification(t, c, skynet.InstanceAdded, s.UUID)
+
+	// die without telling anyone
+	group[2].stop()
+
+	test.ExpectNotification(t, c, skynet.InstanceRemoved, s.UUID)
+
+	if len(group[0].Members()) != 2 {
+		t.Fatal("Failed member still considered alive", group[0].Members())
+	}
+}
+
+func TestLeavingMemberInstancesRemoved(t *testing.T) {
+	group := newGroup(t, 2)
+	defer shutdownGroup(group[:1])
+
+	c := make(chan skynet.InstanceNotification, 10)
+	group[0].Watch(&skynet.Criteria{}, c)
+
+	s := serviceInfo("1")
+	group[1].Add(s)
+	test.ExpectNotification(t, c, skynet.InstanceAdded, s.UUID)
+
+	group[1].Shutdown()
+	test.ExpectNotification(t, c, skynet.InstanceRemoved, s.UUID)
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	group := newGroup(t, 2)
+	defer shutdownGroup(group)
+
+	c := make(chan skynet.InstanceNotification, 10)
+	group[1].Watch(&skynet.Criteria{}, c)
+
+	s := serviceInfo("1")
+	group[0].Add(s)
+	test.ExpectNotification(t, c, skynet.InstanceAdded, s.UUID)
+
+	if err := group[0].Heartbeat(s.UUID, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	test.ExpectNotification(t, c, skynet.InstanceRemoved, s.UUID)
+}
+
+func TestStateLargerThanDatagram(t *testing.T) {
+	group := newGroup(t, 2)
+	defer shutdownGroup(group)
+
+	const instances = 500
+
+	for i := 0; i < instances; i++ {
+		if err := group[0].Add(serviceInfo(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	group[0].mutex.Lock()
+	b, _ := json.Marshal(group[0].self.memberState)
+	group[0].mutex.Unlock()
+
+	if len(b) <= maxPacketSize {
+		t.Fatal("State fits in a single datagram", len(b))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		known, _ := group[1].ListInstances(&skynet.Criteria{})
+		if len(known) == instances {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("Instances too many for a datagram were not gossiped", len(known))
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEncodeSplitsState(t *testing.T) {
+	ms := memberState{ID: "1", Version: 1}
+	for i := 0; i < 500; i++ {
+		ms.Services = append(ms.Services, serviceInfo(strconv.Itoa(i)))
+	}
+
+	packets := encode(message{Type: msgPing, Seq: 1, From: "1", Members: []memberState{ms}})
+	if len(packets) < 3 {
+		t.Fatal("State not split across datagrams", len(packets))
+	}
+
+	sm := &ServiceManager{members: make(map[string]*member), partials: make(map[string]*partialState)}
+
+	var assembled memberState
+	for i, b := range packets {
+		if len(b) > maxPacketSize {
+			t.Fatal("Datagram exceeds maximum packet size", len(b))
+		}
+
+		var msg message
+		if err := json.Unmarshal(b, &msg); err != nil {
+			t.Fatal(err)
+		}
+
+		if i == 0 {
+			if msg.Type != msgPing || len(msg.Members) != 0 {
+				t.Fatal("First datagram is not the message without its state", msg.Type, len(msg.Members))
+			}
+
+			continue
+		}
+
+		if msg.Type != msgSync || !msg.Reply {
+			t.Fatal("Parts of the state would be answered", msg.Type, msg.Reply)
+		}
+
+		assembled = sm.assemble(msg.Members[0])
+
+		if i < len(packets)-1 && (assembled.Version != 0 || assembled.Services != nil) {
+			t.Fatal("Instances applied before every part arrived")
+		}
+	}
+
+	if assembled.Version != 1 || len(assembled.Services) != len(ms.Services) {
+		t.Fatal("State not assembled from its parts", assembled.Version, len(assembled.Services))
+	}
+
+	for i, s := range assembled.Services {
+		if s.UUID != ms.Services[i].UUID {
+			t.Fatal("Instances assembled out of order", i, s.UUID)
+		}
+	}
+}
+
+func newGroup(t *testing.T, size int) (group []*ServiceManager) {
+	var seeds []string
+
+	for i := 0; i < size; i++ {
+		sm, err := New(Config{
+			BindAddr:         "127.0.0.1:0",
+			Seeds:            seeds,
+			ProbeInterval:    50 * time.Millisecond,
+			ProbeTimeout:     20 * time.Millisecond,
+			IndirectChecks:   2,
+			SuspicionTimeout: 100 * time.Millisecond,
+			GossipInterval:   10 * time.Millisecond,
+			GossipFanout:     3,
+			SyncInterval:     100 * time.Millisecond,
+			DeadRetention:    time.Second,
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		group = append(group, sm)
+		seeds = []string{group[0].Addr()}
+	}
+
+	// wait for everyone to know about everyone
+	deadline := time.Now().Add(5 * time.Second)
+	for _, sm := range group {
+		for len(sm.Members()) != size {
+			if time.Now().After(deadline) {
+				t.Fatal("Group failed to converge", sm.Members())
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	return
+}
+
+func shutdownGroup(group []*ServiceManager) {
+	for _, sm := range group {
+		sm.Shutdown()
+	}
+}
+
+func serviceInfo(uuid string) skynet.ServiceInfo {
+	return skynet.ServiceInfo{
+		UUID:    uuid,
+		Name:    "TestService",
+		Version: "1.0.0",
+		Region:  "Tampa",
+		ServiceAddr: skynet.BindAddr{
+			IPAddress: "127.0.0.1",
+			Port:      9000,
+		},
+	}
+}
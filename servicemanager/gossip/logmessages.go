@@ -0,0 +1,50 @@
+package gossip
+
+import (
+	"fmt"
+	"github.com/skynetservices/skynet"
+)
+
+type MemberJoined struct {
+	ID   string
+	Addr string
+}
+
+func (mj MemberJoined) String() string {
+	return fmt.Sprintf("Member %q at %s joined", mj.ID, mj.Addr)
+}
+
+type MemberSuspected struct {
+	ID   string
+	Addr string
+}
+
+func (ms MemberSuspected) String() string {
+	return fmt.Sprintf("Member %q at %s is suspected of failing", ms.ID, ms.Addr)
+}
+
+type MemberFailed struct {
+	ID   string
+	Addr string
+}
+
+func (mf MemberFailed) String() string {
+	return fmt.Sprintf("Member %q at %s failed", mf.ID, mf.Addr)
+}
+
+type MemberLeft struct {
+	ID   string
+	Addr string
+}
+
+func (ml MemberLeft) String() string {
+	return fmt.Sprintf("Member %q at %s left", ml.ID, ml.Addr)
+}
+
+type LeaseExpired struct {
+	Service skynet.ServiceInfo
+}
+
+func (le LeaseExpired) String() string {
+	return fmt.Sprintf("Lease expired for instance %q of service %q at %s", le.Service.UUID, le.Service.Name, le.Service.AddrString())
+}
@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"fmt"
+	"github.com/skynetservices/skynet"
+)
+
+type LeaseExpired struct {
+	Service skynet.ServiceInfo
+}
+
+func (le LeaseExpired) String() string {
+	return fmt.Sprintf("Lease expired for instance %q of service %q at %s", le.Service.UUID, le.Service.Name, le.Service.AddrString())
+}
@@ -0,0 +1,468 @@
+package memory
+
+import (
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/log"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ReapInterval is how often leases are checked for expiry
+var ReapInterval = 500 * time.Millisecond
+
+/*
+memory.ServiceManager is an in process implementation of skynet.ServiceManager.
+It is safe for use from multiple goroutines, and is intended for single binary
+deployments and tests where every service and client share the same process.
+
+Notifications are delivered to watchers synchronously and in the order changes
+are made, so watchers must keep their channels drained.
+*/
+type ServiceManager struct {
+	instances     map[string]skynet.ServiceInfo
+	leases        map[string]time.Time
+	watchers      []*watcher
+	instanceMutex sync.Mutex
+
+	// indicates the reap() goroutine is running, it exits once there are no leases
+	reaping bool
+
+	// held for the duration of a change, including notifying watchers,
+	// so that notifications are never delivered out of order
+	notifyMutex sync.Mutex
+}
+
+type watcher struct {
+	criteria skynet.CriteriaMatcher
+	c        chan<- skynet.InstanceNotification
+
+	// closed when the subscription is closed
+	done      chan bool
+	closeOnce sync.Once
+}
+
+type notification struct {
+	w *watcher
+	n skynet.InstanceNotification
+}
+
+/*
+memory.New() returns a new empty ServiceManager
+*/
+func New() *ServiceManager {
+	return &ServiceManager{
+		instances: make(map[string]skynet.ServiceInfo),
+		leases:    make(map[string]time.Time),
+	}
+}
+
+/*
+ServiceManager.Add() adds a new instance, if the instance is already known it will be updated
+and any lease on it is cleared
+*/
+func (sm *ServiceManager) Add(s skynet.ServiceInfo) error {
+	sm.notifyMutex.Lock()
+	defer sm.notifyMutex.Unlock()
+
+	sm.instanceMutex.Lock()
+	old, ok := sm.instances[s.UUID]
+	sm.instances[s.UUID] = s
+	delete(sm.leases, s.UUID)
+
+	var n []notification
+	if ok {
+		n = sm.changed(&old, &s)
+	} else {
+		n = sm.changed(nil, &s)
+	}
+	sm.instanceMutex.Unlock()
+
+	deliver(n)
+
+	return nil
+}
+
+/*
+ServiceManager.Update() replaces the information about a known instance
+*/
+func (sm *ServiceManager) Update(s skynet.ServiceInfo) error {
+	return sm.modify(s.UUID, func(si *skynet.ServiceInfo) {
+		*si = s
+	})
+}
+
+/*
+ServiceManager.Remove() removes an instance
+*/
+func (sm *ServiceManager) Remove(s skynet.ServiceInfo) error {
+	sm.notifyMutex.Lock()
+	defer sm.notifyMutex.Unlock()
+
+	sm.instanceMutex.Lock()
+	old, ok := sm.instances[s.UUID]
+	if !ok {
+		sm.instanceMutex.Unlock()
+		return skynet.UnknownInstance
+	}
+
+	delete(sm.instances, s.UUID)
+	delete(sm.leases, s.UUID)
+	n := sm.changed(&old, nil)
+	sm.instanceMutex.Unlock()
+
+	deliver(n)
+
+	return nil
+}
+
+/*
+ServiceManager.Register() marks an instance as accepting requests
+*/
+func (sm *ServiceManager) Register(uuid string) error {
+	return sm.modify(uuid, func(si *skynet.ServiceInfo) {
+		si.Registered = true
+	})
+}
+
+/*
+ServiceManager.Unregister() marks an instance as no longer accepting requests
+*/
+func (sm *ServiceManager) Unregister(uuid string) error {
+	return sm.modify(uuid, func(si *skynet.ServiceInfo) {
+		si.Registered = false
+	})
+}
+
+/*
+ServiceManager.Heartbeat() renews the lease on an instance, if the lease is not renewed
+within ttl the instance will be removed
+*/
+func (sm *ServiceManager) Heartbeat(uuid string, ttl time.Duration) error {
+	sm.instanceMutex.Lock()
+
+	if _, ok := sm.instances[uuid]; !ok {
+		sm.instanceMutex.Unlock()
+		return skynet.UnknownInstance
+	}
+
+	if expires, ok := sm.leases[uuid]; ok && !expires.After(time.Now()) {
+		// lapsed but not yet reaped
+		sm.instanceMutex.Unlock()
+		sm.reap()
+
+		return skynet.UnknownInstance
+	}
+
+	sm.leases[uuid] = time.Now().Add(ttl)
+
+	if !sm.reaping {
+		sm.reaping = true
+		go sm.reapLeases()
+	}
+
+	sm.instanceMutex.Unlock()
+
+	return nil
+}
+
+/*
+ServiceManager.Shutdown() is a no-op, the registry lives as long as the process
+and may be shared by several services
+*/
+func (sm *ServiceManager) Shutdown() error {
+	return nil
+}
+
+/*
+ServiceManager.ListHosts() returns the unique hosts of all instances that match the criteria
+*/
+func (sm *ServiceManager) ListHosts(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.list(c, func(s skynet.ServiceInfo) string {
+		return s.ServiceAddr.IPAddress
+	}), nil
+}
+
+/*
+ServiceManager.ListRegions() returns the unique regions of all instances that match the criteria
+*/
+func (sm *ServiceManager) ListRegions(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.list(c, func(s skynet.ServiceInfo) string {
+		return s.Region
+	}), nil
+}
+
+/*
+ServiceManager.ListServices() returns the unique service names of all instances that match the criteria
+*/
+func (sm *ServiceManager) ListServices(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.list(c, func(s skynet.ServiceInfo) string {
+		return s.Name
+	}), nil
+}
+
+/*
+ServiceManager.ListVersions() returns the unique versions of all instances that match the criteria,
+in ascending order of semantic version
+*/
+func (sm *ServiceManager) ListVersions(c skynet.CriteriaMatcher) ([]string, error) {
+	versions := sm.list(c, func(s skynet.ServiceInfo) string {
+		return s.Version
+	})
+
+	skynet.SortVersions(versions)
+
+	return versions, nil
+}
+
+/*
+ServiceManager.ListInstances() returns all instances that match the criteria
+*/
+func (sm *ServiceManager) ListInstances(c skynet.CriteriaMatcher) ([]skynet.ServiceInfo, error) {
+	sm.instanceMutex.Lock()
+	defer sm.instanceMutex.Unlock()
+
+	return sm.matching(c), nil
+}
+
+/*
+ServiceManager.Watch() returns all instances that currently match the criteria, and
+sends an InstanceNotification to c for every future change to a matching instance
+until the Subscription is closed. An instance that is updated so that it starts or
+stops matching the criteria is reported as added or removed respectively.
+*/
+func (sm *ServiceManager) Watch(criteria skynet.CriteriaMatcher, c chan<- skynet.InstanceNotification) ([]skynet.ServiceInfo, skynet.Subscription) {
+	// prevent changes between taking the snapshot and adding the watcher
+	sm.notifyMutex.Lock()
+	defer sm.notifyMutex.Unlock()
+
+	sm.instanceMutex.Lock()
+	defer sm.instanceMutex.Unlock()
+
+	w := &watcher{
+		criteria: criteria,
+		c:        c,
+		done:     make(chan bool),
+	}
+
+	sm.watchers = append(sm.watchers, w)
+
+	return sm.matching(criteria), skynet.SubscriptionFunc(func() error {
+		sm.removeWatcher(w)
+		return nil
+	})
+}
+
+// removeWatcher does not take notifyMutex, so that a subscription can be closed
+// while a notification to it is blocked
+func (sm *ServiceManager) removeWatcher(w *watcher) {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+
+	sm.instanceMutex.Lock()
+	defer sm.instanceMutex.Unlock()
+
+	for i, existing := range sm.watchers {
+		if existing == w {
+			sm.watchers = append(sm.watchers[:i], sm.watchers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (sm *ServiceManager) reapLeases() {
+	ticker := time.NewTicker(ReapInterval)
+	defer ticker.Stop()
+
+	for _ = range ticker.C {
+		if !sm.reap() {
+			return
+		}
+	}
+}
+
+// reap removes instances whose lease has lapsed, returns false once no leases remain
+func (sm *ServiceManager) reap() bool {
+	sm.notifyMutex.Lock()
+	defer sm.notifyMutex.Unlock()
+
+	sm.instanceMutex.Lock()
+
+	var n []notification
+	var expired []skynet.ServiceInfo
+	now := time.Now()
+
+	for uuid, expires := range sm.leases {
+		if expires.After(now) {
+			continue
+		}
+
+		old := sm.instances[uuid]
+		delete(sm.instances, uuid)
+		delete(sm.leases, uuid)
+
+		expired = append(expired, old)
+		n = append(n, sm.changed(&old, nil)...)
+	}
+
+	remaining := len(sm.leases) > 0
+	if !remaining {
+		sm.reaping = false
+	}
+
+	sm.instanceMutex.Unlock()
+
+	for _, s := range expired {
+		log.Printf(log.WARN, "%+v", LeaseExpired{s})
+	}
+
+	deliver(n)
+
+	return remaining
+}
+
+/*
+ServiceManager.Replace() replaces every instance with instances, notifying watchers of those that
+were added, changed or removed. It keeps a view of instances stored elsewhere in line with them.
+*/
+func (sm *ServiceManager) Replace(instances []skynet.ServiceInfo) {
+	sm.notifyMutex.Lock()
+	defer sm.notifyMutex.Unlock()
+
+	replacements := make(map[string]skynet.ServiceInfo, len(instances))
+	for _, s := range instances {
+		replacements[s.UUID] = s
+	}
+
+	sm.instanceMutex.Lock()
+
+	var n []notification
+	for uuid, old := range sm.instances {
+		old := old
+		s, ok := replacements[uuid]
+
+		if !ok {
+			delete(sm.instances, uuid)
+			delete(sm.leases, uuid)
+			n = append(n, sm.changed(&old, nil)...)
+		} else if !reflect.DeepEqual(s, old) {
+			sm.instances[uuid] = s
+			n = append(n, sm.changed(&old, &s)...)
+		}
+
+		delete(replacements, uuid)
+	}
+
+	// anything remaining is new to us
+	for uuid, s := range replacements {
+		s := s
+		sm.instances[uuid] = s
+		n = append(n, sm.changed(nil, &s)...)
+	}
+
+	sm.instanceMutex.Unlock()
+
+	deliver(n)
+}
+
+func (sm *ServiceManager) modify(uuid string, f func(si *skynet.ServiceInfo)) error {
+	sm.notifyMutex.Lock()
+	defer sm.notifyMutex.Unlock()
+
+	sm.instanceMutex.Lock()
+	old, ok := sm.instances[uuid]
+	if !ok {
+		sm.instanceMutex.Unlock()
+		return skynet.UnknownInstance
+	}
+
+	s := old
+	f(&s)
+	s.UUID = uuid
+	sm.instances[uuid] = s
+
+	n := sm.changed(&old, &s)
+	sm.instanceMutex.Unlock()
+
+	deliver(n)
+
+	return nil
+}
+
+// must be called with instanceMutex held
+func (sm *ServiceManager) matching(c skynet.CriteriaMatcher) (instances []skynet.ServiceInfo) {
+	instances = []skynet.ServiceInfo{}
+
+	for _, s := range sm.instances {
+		if c.Matches(s) {
+			instances = append(instances, s)
+		}
+	}
+
+	return
+}
+
+func (sm *ServiceManager) list(c skynet.CriteriaMatcher, field func(s skynet.ServiceInfo) string) []string {
+	sm.instanceMutex.Lock()
+	defer sm.instanceMutex.Unlock()
+
+	unique := make(map[string]bool)
+	values := []string{}
+
+	for _, s := range sm.matching(c) {
+		v := field(s)
+
+		if !unique[v] {
+			unique[v] = true
+			values = append(values, v)
+		}
+	}
+
+	sort.Strings(values)
+
+	return values
+}
+
+// changed determines which watchers need to be notified of a change from old to new,
+// a nil old indicates an addition and a nil new a removal.
+// must be called with instanceMutex held
+func (sm *ServiceManager) changed(old, new *skynet.ServiceInfo) (notifications []notification) {
+	for _, w := range sm.watchers {
+		oldMatch := old != nil && w.criteria.Matches(*old)
+		newMatch := new != nil && w.criteria.Matches(*new)
+
+		switch {
+		case oldMatch && newMatch:
+			notifications = append(notifications, notification{w, skynet.InstanceNotification{Type: skynet.InstanceUpdated, Service: *new}})
+		case newMatch:
+			notifications = append(notifications, notification{w, skynet.InstanceNotification{Type: skynet.InstanceAdded, Service: *new}})
+		case oldMatch:
+			// report the latest information we have about the instance
+			s := old
+			if new != nil {
+				s = new
+			}
+
+			notifications = append(notifications, notification{w, skynet.InstanceNotification{Type: skynet.InstanceRemoved, Service: *s}})
+		}
+	}
+
+	return
+}
+
+func deliver(notifications []notification) {
+	for _, n := range notifications {
+		select {
+		case <-n.w.done:
+			continue
+		default:
+		}
+
+		select {
+		case n.w.c <- n.n:
+		case <-n.w.done:
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package memory
+
+import (
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/test"
+	"testing"
+	"time"
+)
+
+func TestAddAndList(t *testing.T) {
+	sm := New()
+
+	sm.Add(serviceInfo("1", "TestService", "1.0.0", "Tampa", "127.0.0.1"))
+	sm.Add(serviceInfo("2", "TestService", "2.0.0", "Chicago", "127.0.0.2"))
+	sm.Add(serviceInfo("3", "OtherService", "1.0.0", "Tampa", "127.0.0.1"))
+
+	all := &skynet.Criteria{}
+
+	instances, _ := sm.ListInstances(all)
+	if len(instances) != 3 {
+		t.Fatal("ListInstances() returned incorrect number of instances", len(instances))
+	}
+
+	hosts, _ := sm.ListHosts(all)
+	if !equal(hosts, []string{"127.0.0.1", "127.0.0.2"}) {
+		t.Fatal("ListHosts() returned incorrect hosts", hosts)
+	}
+
+	regions, _ := sm.ListRegions(all)
+	if !equal(regions, []string{"Chicago", "Tampa"}) {
+		t.Fatal("ListRegions() returned incorrect regions", regions)
+	}
+
+	services, _ := sm.ListServices(all)
+	if !equal(services, []string{"OtherService", "TestService"}) {
+		t.Fatal("ListServices() returned incorrect services", services)
+	}
+
+	c := &skynet.Criteria{
+		Services: []skynet.ServiceCriteria{
+			skynet.ServiceCriteria{Name: "TestService"},
+		},
+	}
+
+	versions, _ := sm.ListVersions(c)
+	if !equal(versions, []string{"1.0.0", "2.0.0"}) {
+		t.Fatal("ListVersions() returned incorrect versions", versions)
+	}
+
+	c.AddRegion("Tampa")
+	instances, _ = sm.ListInstances(c)
+	if len(instances) != 1 || instances[0].UUID != "1" {
+		t.Fatal("ListInstances() did not filter by criteria", instances)
+	}
+}
+
+func TestUnknownInstance(t *testing.T) {
+	sm := New()
+
+	if err := sm.Update(serviceInfo("1", "TestService", "1.0.0", "Tampa", "127.0.0.1")); err != skynet.UnknownInstance {
+		t.Fatal("Update() should fail for unknown instances")
+	}
+
+	if err := sm.Register("1"); err != skynet.UnknownInstance {
+		t.Fatal("Register() should fail for unknown instances")
+	}
+
+	if err := sm.Unregister("1"); err != skynet.UnknownInstance {
+		t.Fatal("Unregister() should fail for unknown instances")
+	}
+
+	if err := sm.Remove(serviceInfo("1", "TestService", "1.0.0", "Tampa", "127.0.0.1")); err != skynet.UnknownInstance {
+		t.Fatal("Remove() should fail for unknown instances")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	sm := New()
+	sm.Add(serviceInfo("1", "TestService", "1.0.0", "Tampa", "127.0.0.1"))
+	sm.Add(serviceInfo("2", "TestService", "1.0.0", "Chicago", "127.0.0.1"))
+
+	c := make(chan skynet.InstanceNotification, 10)
+	instances, _ := sm.Watch(&skynet.Criteria{Regions: []string{"Tampa"}}, c)
+
+	if len(instances) != 1 || instances[0].UUID != "1" {
+		t.Fatal("Watch() did not return matching instances", instances)
+	}
+
+	// Changes to instances that don't match should not be reported
+	sm.Unregister("2")
+	sm.Add(serviceInfo("3", "TestService", "1.0.0", "Dallas", "127.0.0.1"))
+
+	sm.Add(serviceInfo("4", "TestService", "1.0.0", "Tampa", "127.0.0.1"))
+	test.ExpectNotification(t, c, skynet.InstanceAdded, "4")
+
+	sm.Register("1")
+	n := test.ExpectNotification(t, c, skynet.InstanceUpdated, "1")
+	if !n.Service.Registered {
+		t.Fatal("InstanceUpdated notification did not contain updated instance")
+	}
+
+	// Moving into or out of the criteria is reported as an add or remove
+	s := serviceInfo("4", "TestService", "1.0.0", "Dallas", "127.0.0.1")
+	sm.Update(s)
+	test.ExpectNotification(t, c, skynet.InstanceRemoved, "4")
+
+	s.Region = "Tampa"
+	sm.Update(s)
+	test.ExpectNotification(t, c, skynet.InstanceAdded, "4")
+
+	sm.Remove(s)
+	test.ExpectNotification(t, c, skynet.InstanceRemoved, "4")
+
+	select {
+	case n := <-c:
+		t.Fatal("Unexpected notification", n)
+	default:
+	}
+}
+
+func TestReplace(t *testing.T) {
+	sm := New()
+	sm.Add(serviceInfo("1", "TestService", "1.0.0", "Tampa", "127.0.0.1"))
+	sm.Add(serviceInfo("2", "TestService", "1.0.0", "Tampa", "127.0.0.1"))
+	sm.Add(serviceInfo("3", "TestService", "1.0.0", "Tampa", "127.0.0.1"))
+
+	c := make(chan skynet.InstanceNotification, 10)
+	sm.Watch(&skynet.Criteria{}, c)
+
+	updated := serviceInfo("2", "TestService", "1.0.0", "Tampa", "127.0.0.1")
+	updated.Registered = true
+
+	sm.Replace([]skynet.ServiceInfo{
+		serviceInfo("1", "TestService", "1.0.0", "Tampa", "127.0.0.1"),
+		updated,
+		serviceInfo("4", "TestService", "1.0.0", "Tampa", "127.0.0.1"),
+	})
+
+	// unchanged instances aren't reported
+	notified := make(map[string]int)
+	for i := 0; i < 3; i++ {
+		select {
+		case n := <-c:
+			notified[n.Service.UUID] = n.Type
+		case <-time.After(time.Second):
+			t.Fatal("Expected notification", notified)
+		}
+	}
+
+	if len(notified) != 3 || notified["2"] != skynet.InstanceUpdated || notified["3"] != skynet.InstanceRemoved || notified["4"] != skynet.InstanceAdded {
+		t.Fatal("Unexpected notifications", notified)
+	}
+
+	instances, _ := sm.ListInstances(&skynet.Criteria{})
+	if len(instances) != 3 {
+		t.Fatal("Replace() did not replace instances", instances)
+	}
+}
+
+func TestWatchNotifiesAllWatchers(t *testing.T) {
+	sm := New()
+
+	c1 := make(chan skynet.InstanceNotification, 10)
+	c2 := make(chan skynet.InstanceNotification, 10)
+
+	sm.Watch(&skynet.Criteria{}, c1)
+	sm.Watch(&skynet.Criteria{Regions: []string{"Tampa"}}, c2)
+
+	sm.Add(serviceInfo("1", "TestService", "1.0.0", "Tampa", "127.0.0.1"))
+
+	test.ExpectNotification(t, c1, skynet.InstanceAdded, "1")
+	test.ExpectNotification(t, c2, skynet.InstanceAdded, "1")
+}
+
+func TestSubscriptionClose(t *testing.T) {
+	sm := New()
+
+	c := make(chan skynet.InstanceNotification, 10)
+	_, sub := sm.Watch(&skynet.Criteria{}, c)
+
+	sm.Add(serviceInfo("1", "TestService", "1.0.0", "Tampa", "127.0.0.1"))
+	test.ExpectNotification(t, c, skynet.InstanceAdded, "1")
+
+	sub.Close()
+
+	sm.Add(serviceInfo("2", "TestService", "1.0.0", "Tampa", "127.0.0.1"))
+
+	select {
+	case n := <-c:
+		t.Fatal("Notification sent after subscription was closed", n)
+	default:
+	}
+}
+
+func TestSubscriptionCloseWhileBlocked(t *testing.T) {
+	sm := New()
+
+	// unbuffered and never read, delivery will block until the subscription is closed
+	c := make(chan skynet.InstanceNotification)
+	_, sub := sm.Watch(&skynet.Criteria{}, c)
+
+	added := make(chan bool)
+	go func() {
+		sm.Add(serviceInfo("1", "TestService", "1.0.0", "Tampa", "127.0.0.1"))
+		added <- true
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	sub.Close()
+
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Fatal("Closing subscription did not unblock delivery")
+	}
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	ReapInterval = 5 * time.Millisecond
+
+	sm := New()
+	sm.Add(serviceInfo("1", "TestService", "1.0.0", "Tampa", "127.0.0.1"))
+	sm.Add(serviceInfo("2", "TestService", "1.0.0", "Tampa", "127.0.0.1"))
+
+	c := make(chan skynet.InstanceNotification, 10)
+	sm.Watch(&skynet.Criteria{}, c)
+
+	if err := sm.Heartbeat("1", 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	test.ExpectNotification(t, c, skynet.InstanceRemoved, "1")
+
+	if err := sm.Heartbeat("1", 20*time.Millisecond); err != skynet.UnknownInstance {
+		t.Fatal("Heartbeat() should fail for expired instances")
+	}
+
+	// instances without a lease never expire
+	instances, _ := sm.ListInstances(&skynet.Criteria{})
+	if len(instances) != 1 || instances[0].UUID != "2" {
+		t.Fatal("Only instances with lapsed leases should expire", instances)
+	}
+}
+
+func TestHeartbeatRenewsLease(t *testing.T) {
+	ReapInterval = 5 * time.Millisecond
+
+	sm := New()
+	sm.Add(serviceInfo("1", "TestService", "1.0.0", "Tampa", "127.0.0.1"))
+
+	for i := 0; i < 5; i++ {
+		if err := sm.Heartbeat("1", 50*time.Millisecond); err != nil {
+			t.Fatal("Lease expired while being renewed")
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func serviceInfo(uuid, name, version, region, host string) skynet.ServiceInfo {
+	return skynet.ServiceInfo{
+		UUID:    uuid,
+		Name:    name,
+		Version: version,
+		Region:  region,
+		ServiceAddr: skynet.BindAddr{
+			IPAddress: host,
+			Port:      9000,
+		},
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
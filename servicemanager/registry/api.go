@@ -0,0 +1,115 @@
+/*
+Package registry provides a standalone HTTP/JSON registry of instances, and a
+skynet.ServiceManager that uses it, so that processes that can't link Go code are
+still able to discover and register skynet services.
+
+The API is described in documentation/registry.md. Every change made to the registry
+is assigned an increasing index, which clients use to long-poll for changes since the
+last index they saw.
+*/
+package registry
+
+import (
+	"errors"
+	"github.com/skynetservices/skynet"
+	"net/url"
+	"strings"
+)
+
+var (
+	MissingUUID      = errors.New("Instance has no UUID")
+	InvalidTTL       = errors.New("Invalid ttl")
+	InvalidIndex     = errors.New("Invalid index")
+	InvalidWait      = errors.New("Invalid wait")
+	NotFound         = errors.New("Not found")
+	MethodNotAllowed = errors.New("Method not allowed")
+)
+
+// Event is a change to an instance, Type is one of skynet.InstanceAdded, skynet.InstanceUpdated or skynet.InstanceRemoved
+type Event struct {
+	Index   uint64
+	Type    int
+	Service skynet.ServiceInfo
+}
+
+// InstancesResponse is returned when listing instances
+type InstancesResponse struct {
+	Index     uint64
+	Instances []skynet.ServiceInfo
+}
+
+// WatchResponse is returned by a watch, with the events after the requested index
+type WatchResponse struct {
+	Index uint64
+
+	// Reset indicates that events since the requested index are no longer available,
+	// Instances holds every matching instance as of Index and replaces anything known
+	Reset     bool
+	Instances []skynet.ServiceInfo `json:",omitempty"`
+
+	Events []Event `json:",omitempty"`
+}
+
+// WriteResponse is returned by requests that change an instance, changes are visible to
+// watches from Index onwards
+type WriteResponse struct {
+	Index uint64
+}
+
+// ErrorResponse is returned with any unsuccessful status
+type ErrorResponse struct {
+	Error string
+}
+
+/*
+registry.CriteriaFromQuery() builds criteria from the query parameter criteria (see
+skynet.ParseCriteria), combined with the parameters service (name or name:version), region,
+host, instance and labels (a label selector), which may each be repeated, and registered
+*/
+func CriteriaFromQuery(q url.Values) (c *skynet.Criteria, err error) {
+	c = &skynet.Criteria{}
+
+	if s := q.Get("criteria"); s != "" {
+		if c, err = skynet.ParseCriteria(s); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, h := range q["host"] {
+		c.AddHost(h)
+	}
+
+	for _, r := range q["region"] {
+		c.AddRegion(r)
+	}
+
+	for _, i := range q["instance"] {
+		c.AddInstance(i)
+	}
+
+	for _, s := range q["service"] {
+		sc := skynet.ServiceCriteria{Name: s}
+
+		if i := strings.Index(s, ":"); i >= 0 {
+			sc.Name, sc.Version = s[:i], s[i+1:]
+		}
+
+		c.AddService(sc)
+	}
+
+	for _, l := range q["labels"] {
+		requirements, err := skynet.ParseLabelSelector(l)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Labels = append(c.Labels, requirements...)
+	}
+
+	if r := q.Get("registered"); r != "" {
+		registered := r == "true"
+		c.Registered = &registered
+	}
+
+	return
+}
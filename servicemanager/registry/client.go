@@ -0,0 +1,313 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/log"
+	"github.com/skynetservices/skynet/servicemanager/memory"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// the wait requested of the registry for each long-poll
+	watchWait = 30 * time.Second
+
+	// how long to wait before watching again after a failure
+	retryInterval = 1 * time.Second
+
+	// how long a write waits to be seen by the watch before returning
+	writeVisibleTimeout = 5 * time.Second
+)
+
+/*
+registry.ServiceManager is a skynet.ServiceManager that stores instances in a registry
+server. Queries and watches are answered from a local copy, which is kept up to date by
+long-polling the registry.
+*/
+type ServiceManager struct {
+	url    string
+	client *http.Client
+
+	// the instances in the registry as of index
+	view  *memory.ServiceManager
+	mutex sync.Mutex
+	index uint64
+
+	// closed and replaced whenever index changes
+	indexChanged chan bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+/*
+registry.New() returns a ServiceManager using the registry at addr, which may be a
+host:port or a URL
+*/
+func New(addr string) (sm *ServiceManager, err error) {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sm = &ServiceManager{
+		url:          strings.TrimSuffix(addr, "/"),
+		client:       &http.Client{},
+		view:         memory.New(),
+		indexChanged: make(chan bool),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+
+	var resp InstancesResponse
+	if err = sm.do("GET", "/instances", nil, nil, &resp); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	sm.reset(resp.Index, resp.Instances)
+
+	go sm.watch()
+
+	return
+}
+
+/*
+ServiceManager.Add() adds an instance to the registry, if the instance is already known it will be replaced
+*/
+func (sm *ServiceManager) Add(s skynet.ServiceInfo) error {
+	return sm.write("POST", "/instances", nil, s)
+}
+
+/*
+ServiceManager.Update() replaces the information about a known instance
+*/
+func (sm *ServiceManager) Update(s skynet.ServiceInfo) error {
+	return sm.write("PUT", "/instances/"+url.PathEscape(s.UUID), nil, s)
+}
+
+/*
+ServiceManager.Remove() removes an instance from the registry
+*/
+func (sm *ServiceManager) Remove(s skynet.ServiceInfo) error {
+	return sm.write("DELETE", "/instances/"+url.PathEscape(s.UUID), nil, nil)
+}
+
+/*
+ServiceManager.Register() marks an instance as accepting requests
+*/
+func (sm *ServiceManager) Register(uuid string) error {
+	return sm.write("POST", "/instances/"+url.PathEscape(uuid)+"/register", nil, nil)
+}
+
+/*
+ServiceManager.Unregister() marks an instance as no longer accepting requests
+*/
+func (sm *ServiceManager) Unregister(uuid string) error {
+	return sm.write("POST", "/instances/"+url.PathEscape(uuid)+"/unregister", nil, nil)
+}
+
+/*
+ServiceManager.Heartbeat() renews the lease on an instance, if the lease is not renewed
+within ttl the registry will remove the instance
+*/
+func (sm *ServiceManager) Heartbeat(uuid string, ttl time.Duration) error {
+	q := url.Values{"ttl": []string{ttl.String()}}
+	return sm.write("POST", "/instances/"+url.PathEscape(uuid)+"/heartbeat", q, nil)
+}
+
+/*
+ServiceManager.Shutdown() stops watching the registry, instances are left registered
+*/
+func (sm *ServiceManager) Shutdown() error {
+	sm.cancel()
+	return nil
+}
+
+func (sm *ServiceManager) ListHosts(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.view.ListHosts(c)
+}
+
+func (sm *ServiceManager) ListRegions(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.view.ListRegions(c)
+}
+
+func (sm *ServiceManager) ListServices(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.view.ListServices(c)
+}
+
+func (sm *ServiceManager) ListVersions(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.view.ListVersions(c)
+}
+
+func (sm *ServiceManager) ListInstances(c skynet.CriteriaMatcher) ([]skynet.ServiceInfo, error) {
+	return sm.view.ListInstances(c)
+}
+
+/*
+ServiceManager.Watch() returns all instances that currently match the criteria, and notifies
+c of changes to matching instances made through the registry, until the Subscription is closed
+*/
+func (sm *ServiceManager) Watch(criteria skynet.CriteriaMatcher, c chan<- skynet.InstanceNotification) ([]skynet.ServiceInfo, skynet.Subscription) {
+	return sm.view.Watch(criteria, c)
+}
+
+func (sm *ServiceManager) watch() {
+	for {
+		sm.mutex.Lock()
+		q := url.Values{
+			"index": []string{strconv.FormatUint(sm.index, 10)},
+			"wait":  []string{watchWait.String()},
+		}
+		sm.mutex.Unlock()
+
+		var resp WatchResponse
+		err := sm.do("GET", "/watch", q, nil, &resp)
+
+		if sm.ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			log.Println(log.ERROR, "Failed to watch registry", err)
+
+			select {
+			case <-time.After(retryInterval):
+			case <-sm.ctx.Done():
+				return
+			}
+
+			continue
+		}
+
+		if resp.Reset {
+			sm.reset(resp.Index, resp.Instances)
+		} else {
+			sm.apply(resp.Index, resp.Events)
+		}
+	}
+}
+
+// reset replaces the view with instances
+func (sm *ServiceManager) reset(index uint64, instances []skynet.ServiceInfo) {
+	sm.view.Replace(instances)
+	sm.setIndex(index)
+}
+
+func (sm *ServiceManager) apply(index uint64, events []Event) {
+	for _, e := range events {
+		switch e.Type {
+		case skynet.InstanceAdded, skynet.InstanceUpdated:
+			sm.view.Add(e.Service)
+		case skynet.InstanceRemoved:
+			sm.view.Remove(e.Service)
+		}
+	}
+
+	sm.setIndex(index)
+}
+
+func (sm *ServiceManager) setIndex(index uint64) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sm.index = index
+
+	close(sm.indexChanged)
+	sm.indexChanged = make(chan bool)
+}
+
+// waitIndex waits for the view to reflect the registry as of index, so that
+// writes are visible to queries once they return
+func (sm *ServiceManager) waitIndex(index uint64) {
+	timeout := time.NewTimer(writeVisibleTimeout)
+	defer timeout.Stop()
+
+	for {
+		sm.mutex.Lock()
+		current, changed := sm.index, sm.indexChanged
+		sm.mutex.Unlock()
+
+		if current >= index {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-timeout.C:
+			return
+		case <-sm.ctx.Done():
+			return
+		}
+	}
+}
+
+func (sm *ServiceManager) write(method, path string, q url.Values, body interface{}) error {
+	var resp WriteResponse
+
+	if err := sm.do(method, path, q, body, &resp); err != nil {
+		return err
+	}
+
+	sm.waitIndex(resp.Index)
+
+	return nil
+}
+
+func (sm *ServiceManager) do(method, path string, q url.Values, body, out interface{}) error {
+	var r io.Reader
+
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		r = bytes.NewReader(b)
+	}
+
+	u := sm.url + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(sm.ctx, method, u, r)
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := sm.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e ErrorResponse
+		if err = json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+			return errors.New(resp.Status)
+		}
+
+		if e.Error == skynet.UnknownInstance.Error() {
+			return skynet.UnknownInstance
+		}
+
+		return errors.New(e.Error)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,258 @@
+package registry
+
+import (
+	"encoding/json"
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/servicemanager/memory"
+	"github.com/skynetservices/skynet/test"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCriteriaFromQuery(t *testing.T) {
+	q, _ := url.ParseQuery("service=TestService:1.0.0&service=OtherService&region=Tampa&host=127.0.0.1&registered=true&labels=tier%3Dcanary,zone!%3Dus-east-1a")
+	c, err := CriteriaFromQuery(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.Services) != 2 || c.Services[0].Name != "TestService" || c.Services[0].Version != "1.0.0" || c.Services[1].Version != "" {
+		t.Fatal("Services not parsed", c.Services)
+	}
+
+	if len(c.Regions) != 1 || len(c.Hosts) != 1 || c.Registered == nil || !*c.Registered {
+		t.Fatal("Criteria not parsed", c)
+	}
+
+	if len(c.Labels) != 2 || c.Labels[1].Operator != skynet.LabelNotEquals {
+		t.Fatal("Labels not parsed", c.Labels)
+	}
+
+	q, _ = url.ParseQuery("labels=tier%20in%20canary")
+	if _, err = CriteriaFromQuery(q); err == nil {
+		t.Fatal("CriteriaFromQuery() should fail for invalid label selectors")
+	}
+
+	q = url.Values{"criteria": {"service=TestService region!=Chicago"}, "region": {"Tampa"}}
+	if c, err = CriteriaFromQuery(q); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.Services) != 1 || len(c.ExcludeRegions) != 1 || len(c.Regions) != 1 || c.Regions[0] != "Tampa" {
+		t.Fatal("Criteria not parsed", c)
+	}
+
+	q = url.Values{"criteria": {"service!=TestService"}}
+	if _, err = CriteriaFromQuery(q); err != skynet.InvalidCriteria {
+		t.Fatal("CriteriaFromQuery() should fail for invalid criteria")
+	}
+}
+
+func TestWritesVisible(t *testing.T) {
+	server, sm := newRegistry(t)
+	defer server.Close()
+	defer sm.Shutdown()
+
+	s := serviceInfo("1", "Tampa")
+
+	if err := sm.Add(s); err != nil {
+		t.Fatal(err)
+	}
+
+	instances, _ := sm.ListInstances(&skynet.Criteria{})
+	if len(instances) != 1 || instances[0].UUID != s.UUID {
+		t.Fatal("Add() not visible once returned", instances)
+	}
+
+	if err := sm.Register(s.UUID); err != nil {
+		t.Fatal(err)
+	}
+
+	instances, _ = sm.ListInstances(&skynet.Criteria{})
+	if !instances[0].Registered {
+		t.Fatal("Register() not visible once returned")
+	}
+
+	if err := sm.Remove(s); err != nil {
+		t.Fatal(err)
+	}
+
+	instances, _ = sm.ListInstances(&skynet.Criteria{})
+	if len(instances) != 0 {
+		t.Fatal("Remove() not visible once returned", instances)
+	}
+}
+
+func TestUnknownInstance(t *testing.T) {
+	server, sm := newRegistry(t)
+	defer server.Close()
+	defer sm.Shutdown()
+
+	if err := sm.Register("1"); err != skynet.UnknownInstance {
+		t.Fatal("Register() should fail for unknown instances", err)
+	}
+
+	if err := sm.Remove(serviceInfo("1", "Tampa")); err != skynet.UnknownInstance {
+		t.Fatal("Remove() should fail for unknown instances", err)
+	}
+
+	if err := sm.Heartbeat("1", time.Second); err != skynet.UnknownInstance {
+		t.Fatal("Heartbeat() should fail for unknown instances", err)
+	}
+}
+
+func TestChangesVisibleToOtherClients(t *testing.T) {
+	server, sm1 := newRegistry(t)
+	defer server.Close()
+	defer sm1.Shutdown()
+
+	sm2, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm2.Shutdown()
+
+	c := make(chan skynet.InstanceNotification, 10)
+	sm2.Watch(&skynet.Criteria{}, c)
+
+	s := serviceInfo("1", "Tampa")
+
+	sm1.Add(s)
+	test.ExpectNotification(t, c, skynet.InstanceAdded, s.UUID)
+
+	sm1.Register(s.UUID)
+	test.ExpectNotification(t, c, skynet.InstanceUpdated, s.UUID)
+
+	sm1.Remove(s)
+	test.ExpectNotification(t, c, skynet.InstanceRemoved, s.UUID)
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	memory.ReapInterval = 5 * time.Millisecond
+
+	server, sm := newRegistry(t)
+	defer server.Close()
+	defer sm.Shutdown()
+
+	c := make(chan skynet.InstanceNotification, 10)
+	sm.Watch(&skynet.Criteria{}, c)
+
+	s := serviceInfo("1", "Tampa")
+	sm.Add(s)
+	test.ExpectNotification(t, c, skynet.InstanceAdded, s.UUID)
+
+	if err := sm.Heartbeat(s.UUID, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	test.ExpectNotification(t, c, skynet.InstanceRemoved, s.UUID)
+}
+
+func TestWatchCriteria(t *testing.T) {
+	server, sm := newRegistry(t)
+	defer server.Close()
+	defer sm.Shutdown()
+
+	s := serviceInfo("1", "Tampa")
+	sm.Add(s)
+	sm.Add(serviceInfo("2", "Chicago"))
+
+	var list InstancesResponse
+	get(t, server.URL+"/instances?region=Tampa", &list)
+
+	if len(list.Instances) != 1 || list.Instances[0].UUID != s.UUID {
+		t.Fatal("Instances not filtered by criteria", list.Instances)
+	}
+
+	// moving out of the criteria is seen as a removal
+	s.Region = "Dallas"
+	sm.Update(s)
+
+	var watch WatchResponse
+	get(t, server.URL+"/watch?region=Tampa&wait=1s&index="+index(list.Index), &watch)
+
+	if len(watch.Events) != 1 || watch.Events[0].Type != skynet.InstanceRemoved || watch.Events[0].Service.UUID != s.UUID {
+		t.Fatal("Watch did not translate event for criteria", watch.Events)
+	}
+
+	// changes that don't match are skipped, and the watch waits for the next change
+	done := make(chan WatchResponse)
+	go func(i uint64) {
+		var watch WatchResponse
+		get(t, server.URL+"/watch?region=Tampa&wait=5s&index="+index(i), &watch)
+		done <- watch
+	}(watch.Index)
+
+	sm.Register("2")
+	sm.Add(serviceInfo("3", "Tampa"))
+
+	select {
+	case watch = <-done:
+		if len(watch.Events) != 1 || watch.Events[0].Service.UUID != "3" {
+			t.Fatal("Watch returned incorrect events", watch.Events)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Watch did not return on change")
+	}
+}
+
+func TestWatchReset(t *testing.T) {
+	server, sm := newRegistry(t)
+	defer server.Close()
+	defer sm.Shutdown()
+
+	sm.Add(serviceInfo("1", "Tampa"))
+
+	// an index from the future, as a client would have if the registry restarted
+	var watch WatchResponse
+	get(t, server.URL+"/watch?index=1000", &watch)
+
+	if !watch.Reset || len(watch.Instances) != 1 || watch.Index != 1 {
+		t.Fatal("Watch did not reset", watch)
+	}
+}
+
+func newRegistry(t *testing.T) (*httptest.Server, *ServiceManager) {
+	server := httptest.NewServer(NewServer(memory.New()))
+
+	sm, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return server, sm
+}
+
+func get(t *testing.T, url string, v interface{}) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Error(err)
+	}
+}
+
+func index(i uint64) string {
+	return strconv.FormatUint(i, 10)
+}
+
+func serviceInfo(uuid, region string) skynet.ServiceInfo {
+	return skynet.ServiceInfo{
+		UUID:    uuid,
+		Name:    "TestService",
+		Version: "1.0.0",
+		Region:  region,
+		ServiceAddr: skynet.BindAddr{
+			IPAddress: "127.0.0.1",
+			Port:      9000,
+		},
+	}
+}
@@ -0,0 +1,449 @@
+package registry
+
+import (
+	"encoding/json"
+	"github.com/skynetservices/skynet"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWait is how long a watch blocks waiting for changes when no wait is given.
+	DefaultWait = 30 * time.Second
+	// MaxWait is the longest a watch may block.
+	MaxWait = 5 * time.Minute
+
+	// the number of events kept for watches to catch up on
+	maxEvents = 1000
+)
+
+// event is an entry in the log of changes, old is nil for instances that weren't previously known
+type event struct {
+	index uint64
+	old   *skynet.ServiceInfo
+	new   skynet.ServiceInfo
+	typ   int
+}
+
+// translate returns the event as seen by a watch of criteria, which may differ from the change
+// to the instance when it moves into or out of the criteria
+func (e event) translate(criteria skynet.CriteriaMatcher) (ev Event, ok bool) {
+	oldMatch := e.old != nil && criteria.Matches(*e.old)
+	newMatch := e.typ != skynet.InstanceRemoved && criteria.Matches(e.new)
+
+	ev = Event{Index: e.index, Service: e.new}
+
+	switch {
+	case !oldMatch && newMatch:
+		ev.Type = skynet.InstanceAdded
+	case oldMatch && newMatch:
+		ev.Type = skynet.InstanceUpdated
+	case oldMatch && !newMatch:
+		ev.Type = skynet.InstanceRemoved
+	default:
+		return ev, false
+	}
+
+	return ev, true
+}
+
+/*
+registry.Server serves the registry API over HTTP, storing instances in a
+skynet.ServiceManager. Changes made to the ServiceManager by other means, such as
+lapsed leases, are seen by watches as well.
+*/
+type Server struct {
+	sm  skynet.ServiceManager
+	mux *http.ServeMux
+
+	mutex  sync.Mutex
+	index  uint64
+	events []event
+	known  map[string]skynet.ServiceInfo
+
+	// closed and replaced whenever an event is recorded
+	changed chan bool
+
+	notifications chan skynet.InstanceNotification
+	barrier       chan chan uint64
+	subscription  skynet.Subscription
+
+	shutdownChan chan bool
+	shutdownOnce sync.Once
+}
+
+/*
+registry.NewServer() returns a Server storing instances in sm. Writes are expected to be
+notified to watchers of sm before they return, as memory.ServiceManager does, so that
+the index returned to the writer includes the change.
+*/
+func NewServer(sm skynet.ServiceManager) *Server {
+	s := &Server{
+		sm:            sm,
+		mux:           http.NewServeMux(),
+		known:         make(map[string]skynet.ServiceInfo),
+		changed:       make(chan bool),
+		notifications: make(chan skynet.InstanceNotification, 100),
+		barrier:       make(chan chan uint64),
+		shutdownChan:  make(chan bool),
+	}
+
+	instances, sub := sm.Watch(&skynet.Criteria{}, s.notifications)
+	s.subscription = sub
+
+	for _, i := range instances {
+		s.known[i.UUID] = i
+	}
+
+	s.mux.HandleFunc("/instances", s.handleInstances)
+	s.mux.HandleFunc("/instances/", s.handleInstance)
+	s.mux.HandleFunc("/hosts", s.handleList(sm.ListHosts))
+	s.mux.HandleFunc("/regions", s.handleList(sm.ListRegions))
+	s.mux.HandleFunc("/services", s.handleList(sm.ListServices))
+	s.mux.HandleFunc("/versions", s.handleList(sm.ListVersions))
+	s.mux.HandleFunc("/watch", s.handleWatch)
+
+	go s.run()
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+/*
+Server.Close() stops recording changes, and ends any watches in progress
+*/
+func (s *Server) Close() error {
+	s.shutdownOnce.Do(func() {
+		close(s.shutdownChan)
+	})
+
+	return s.subscription.Close()
+}
+
+func (s *Server) run() {
+	for {
+		select {
+		case n := <-s.notifications:
+			s.record(n)
+		case c := <-s.barrier:
+			s.drain()
+
+			s.mutex.Lock()
+			c <- s.index
+			s.mutex.Unlock()
+		case <-s.shutdownChan:
+			return
+		}
+	}
+}
+
+// drain records any notifications that have already been delivered
+func (s *Server) drain() {
+	for {
+		select {
+		case n := <-s.notifications:
+			s.record(n)
+		default:
+			return
+		}
+	}
+}
+
+func (s *Server) record(n skynet.InstanceNotification) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.index++
+	e := event{index: s.index, new: n.Service, typ: n.Type}
+
+	if old, ok := s.known[n.Service.UUID]; ok {
+		e.old = &old
+	}
+
+	if n.Type == skynet.InstanceRemoved {
+		delete(s.known, n.Service.UUID)
+	} else {
+		s.known[n.Service.UUID] = n.Service
+	}
+
+	s.events = append(s.events, e)
+	if len(s.events) > maxEvents {
+		s.events = append([]event(nil), s.events[len(s.events)-maxEvents:]...)
+	}
+
+	close(s.changed)
+	s.changed = make(chan bool)
+}
+
+// sync returns the index once every change already made to the ServiceManager has been recorded
+func (s *Server) sync() uint64 {
+	c := make(chan uint64, 1)
+
+	select {
+	case s.barrier <- c:
+		return <-c
+	case <-s.shutdownChan:
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		return s.index
+	}
+}
+
+// matching must be called with mutex held
+func (s *Server) matching(criteria skynet.CriteriaMatcher) (instances []skynet.ServiceInfo) {
+	instances = []skynet.ServiceInfo{}
+
+	for _, i := range s.known {
+		if criteria.Matches(i) {
+			instances = append(instances, i)
+		}
+	}
+
+	return
+}
+
+func (s *Server) handleInstances(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		criteria, err := CriteriaFromQuery(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		s.sync()
+
+		s.mutex.Lock()
+		resp := InstancesResponse{Index: s.index, Instances: s.matching(criteria)}
+		s.mutex.Unlock()
+
+		writeJSON(w, http.StatusOK, resp)
+	case "POST":
+		var si skynet.ServiceInfo
+		if err := json.NewDecoder(r.Body).Decode(&si); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if si.UUID == "" {
+			writeError(w, http.StatusBadRequest, MissingUUID)
+			return
+		}
+
+		s.write(w, s.sm.Add(si))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, MethodNotAllowed)
+	}
+}
+
+// handleInstance serves /instances/<uuid> and /instances/<uuid>/<action>
+func (s *Server) handleInstance(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/instances/"), "/")
+	uuid := parts[0]
+
+	if uuid == "" || len(parts) > 2 {
+		writeError(w, http.StatusNotFound, NotFound)
+		return
+	}
+
+	if len(parts) == 2 {
+		s.handleAction(w, r, uuid, parts[1])
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		s.sync()
+
+		s.mutex.Lock()
+		si, ok := s.known[uuid]
+		s.mutex.Unlock()
+
+		if !ok {
+			writeError(w, http.StatusNotFound, skynet.UnknownInstance)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, si)
+	case "PUT":
+		var si skynet.ServiceInfo
+		if err := json.NewDecoder(r.Body).Decode(&si); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		si.UUID = uuid
+		s.write(w, s.sm.Update(si))
+	case "DELETE":
+		s.write(w, s.sm.Remove(skynet.ServiceInfo{UUID: uuid}))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, MethodNotAllowed)
+	}
+}
+
+func (s *Server) handleAction(w http.ResponseWriter, r *http.Request, uuid, action string) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, MethodNotAllowed)
+		return
+	}
+
+	switch action {
+	case "register":
+		s.write(w, s.sm.Register(uuid))
+	case "unregister":
+		s.write(w, s.sm.Unregister(uuid))
+	case "heartbeat":
+		ttl, err := time.ParseDuration(r.URL.Query().Get("ttl"))
+		if err != nil || ttl <= 0 {
+			writeError(w, http.StatusBadRequest, InvalidTTL)
+			return
+		}
+
+		s.write(w, s.sm.Heartbeat(uuid, ttl))
+	default:
+		writeError(w, http.StatusNotFound, NotFound)
+	}
+}
+
+func (s *Server) handleList(list func(skynet.CriteriaMatcher) ([]string, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			writeError(w, http.StatusMethodNotAllowed, MethodNotAllowed)
+			return
+		}
+
+		criteria, err := CriteriaFromQuery(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		values, err := list(criteria)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, values)
+	}
+}
+
+/*
+handleWatch blocks until there are changes to instances matching the criteria after the
+requested index, or the wait elapses
+*/
+func (s *Server) handleWatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, MethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+
+	criteria, err := CriteriaFromQuery(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	index, err := strconv.ParseUint(q.Get("index"), 10, 64)
+	if err != nil && q.Get("index") != "" {
+		writeError(w, http.StatusBadRequest, InvalidIndex)
+		return
+	}
+
+	wait := DefaultWait
+	if q.Get("wait") != "" {
+		if wait, err = time.ParseDuration(q.Get("wait")); err != nil || wait < 0 {
+			writeError(w, http.StatusBadRequest, InvalidWait)
+			return
+		}
+	}
+
+	if wait > MaxWait {
+		wait = MaxWait
+	}
+
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	for {
+		s.mutex.Lock()
+		resp, ok := s.since(index, criteria)
+		changed := s.changed
+		s.mutex.Unlock()
+
+		if ok {
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+
+		// nothing we're interested in, but there's no need to look at those events again
+		index = resp.Index
+
+		select {
+		case <-changed:
+		case <-timeout.C:
+			writeJSON(w, http.StatusOK, resp)
+			return
+		case <-r.Context().Done():
+			return
+		case <-s.shutdownChan:
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+	}
+}
+
+// since returns the events matching criteria after index, ok is false if there are none.
+// must be called with mutex held
+func (s *Server) since(index uint64, criteria skynet.CriteriaMatcher) (resp WatchResponse, ok bool) {
+	resp.Index = s.index
+
+	// the client has missed events we no longer have, or knows of events we never had
+	first := s.index + 1 - uint64(len(s.events))
+	if index+1 < first || index > s.index {
+		resp.Reset = true
+		resp.Instances = s.matching(criteria)
+
+		return resp, true
+	}
+
+	for _, e := range s.events[index+1-first:] {
+		if ev, matches := e.translate(criteria); matches {
+			resp.Events = append(resp.Events, ev)
+		}
+	}
+
+	return resp, len(resp.Events) > 0
+}
+
+// write responds to a request that changed an instance
+func (s *Server) write(w http.ResponseWriter, err error) {
+	switch err {
+	case nil:
+		writeJSON(w, http.StatusOK, WriteResponse{Index: s.sync()})
+	case skynet.UnknownInstance:
+		writeError(w, http.StatusNotFound, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, ErrorResponse{Error: err.Error()})
+}
@@ -0,0 +1,45 @@
+/*
+skyregistry serves the skynet HTTP/JSON registry, keeping instances in memory.
+
+Usage:
+
+	skyregistry [-bind addr]
+
+The address defaults to the registry.bind key from the skynet config.
+*/
+package main
+
+import (
+	"flag"
+	"github.com/skynetservices/skynet/config"
+	"github.com/skynetservices/skynet/log"
+	"github.com/skynetservices/skynet/servicemanager/memory"
+	"github.com/skynetservices/skynet/servicemanager/registry"
+	"net/http"
+	"os"
+)
+
+const (
+	defaultBindAddr = "0.0.0.0:8400"
+)
+
+func main() {
+	bind := defaultBindAddr
+	if b, err := config.RawStringDefault("registry.bind"); err == nil && b != "" {
+		bind = b
+	}
+
+	flagset := flag.NewFlagSet("skyregistry", flag.ExitOnError)
+	flagset.StringVar(&bind, "bind", bind, "address to serve the registry on")
+
+	args, _ := config.SplitFlagsetFromArgs(flagset, os.Args[1:])
+	flagset.Parse(args)
+
+	server := registry.NewServer(memory.New())
+
+	log.Println(log.INFO, "Serving registry on", bind)
+
+	if err := http.ListenAndServe(bind, server); err != nil {
+		log.Fatal(err)
+	}
+}
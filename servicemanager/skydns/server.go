@@ -0,0 +1,229 @@
+package skydns
+
+import (
+	"encoding/json"
+	"github.com/miekg/dns"
+	"github.com/skynetservices/skynet"
+	"net"
+	"strings"
+	"sync"
+)
+
+const (
+	// TTL of the records served by Server
+	serverTTL = 5
+)
+
+/*
+skydns.Server is a minimal in-process DNS server publishing instances in the scheme
+ServiceManager expects. It is intended as a stand-in for SkyDNS in tests and local development.
+*/
+type Server struct {
+	domain string
+
+	mutex     sync.RWMutex
+	instances map[string]skynet.ServiceInfo
+
+	// OmitExtra stops the TXT and address records being sent along with SRV responses,
+	// forcing clients to look them up separately.
+	OmitExtra bool
+
+	udp *dns.Server
+	tcp *dns.Server
+}
+
+/*
+skydns.NewServer() returns a Server publishing instances under domain
+*/
+func NewServer(domain string) *Server {
+	return &Server{
+		domain:    dns.Fqdn(strings.ToLower(domain)),
+		instances: make(map[string]skynet.ServiceInfo),
+	}
+}
+
+/*
+Server.Start() begins serving on addr over both UDP and TCP, use port 0 to choose any
+available port. Start() returns once the server is ready to answer queries.
+*/
+func (s *Server) Start(addr string) (err error) {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return
+	}
+
+	// answer TCP on the same port, clients fall back to it when responses are truncated
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		pc.Close()
+		return
+	}
+
+	s.udp = s.serve(&dns.Server{PacketConn: pc, Handler: s})
+	s.tcp = s.serve(&dns.Server{Listener: l, Handler: s})
+
+	return
+}
+
+func (s *Server) serve(server *dns.Server) *dns.Server {
+	started := make(chan bool)
+	server.NotifyStartedFunc = func() {
+		close(started)
+	}
+
+	go server.ActivateAndServe()
+	<-started
+
+	return server
+}
+
+/*
+Server.Addr() returns the address the server is listening on
+*/
+func (s *Server) Addr() string {
+	return s.udp.PacketConn.LocalAddr().String()
+}
+
+/*
+Server.Close() stops serving
+*/
+func (s *Server) Close() error {
+	s.tcp.Shutdown()
+	return s.udp.Shutdown()
+}
+
+/*
+Server.Add() publishes an instance, replacing any instance with the same UUID
+*/
+func (s *Server) Add(si skynet.ServiceInfo) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.instances[si.UUID] = si
+}
+
+/*
+Server.Remove() stops publishing an instance
+*/
+func (s *Server) Remove(uuid string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.instances, uuid)
+}
+
+func (s *Server) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.Authoritative = true
+
+	if len(req.Question) != 1 {
+		m.Rcode = dns.RcodeFormatError
+		w.WriteMsg(m)
+		return
+	}
+
+	q := req.Question[0]
+	qname := strings.ToLower(q.Name)
+
+	if !dns.IsSubDomain(s.domain, qname) {
+		m.Rcode = dns.RcodeRefused
+		w.WriteMsg(m)
+		return
+	}
+
+	s.mutex.RLock()
+
+	exists := false
+	for _, si := range s.instances {
+		name := Name(si, s.domain)
+
+		if !dns.IsSubDomain(qname, name) {
+			continue
+		}
+		exists = true
+
+		if name == qname {
+			switch q.Qtype {
+			case dns.TypeTXT:
+				m.Answer = append(m.Answer, s.txt(name, si))
+			case dns.TypeA, dns.TypeAAAA:
+				if rr := s.address(name, si); rr != nil && rr.Header().Rrtype == q.Qtype {
+					m.Answer = append(m.Answer, rr)
+				}
+			}
+		}
+
+		if q.Qtype == dns.TypeSRV {
+			m.Answer = append(m.Answer, s.srv(name, si))
+
+			if !s.OmitExtra {
+				m.Extra = append(m.Extra, s.txt(name, si))
+
+				if rr := s.address(name, si); rr != nil {
+					m.Extra = append(m.Extra, rr)
+				}
+			}
+		}
+	}
+
+	s.mutex.RUnlock()
+
+	if !exists {
+		m.Rcode = dns.RcodeNameError
+	}
+
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		size := dns.MinMsgSize
+		if opt := req.IsEdns0(); opt != nil {
+			size = int(opt.UDPSize())
+		}
+
+		m.Truncate(size)
+	}
+
+	w.WriteMsg(m)
+}
+
+func (s *Server) header(name string, rrtype uint16) dns.RR_Header {
+	return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: serverTTL}
+}
+
+// the SRV target is the instance name when its address is an IP, otherwise the address itself
+func (s *Server) srv(name string, si skynet.ServiceInfo) dns.RR {
+	target := dns.Fqdn(si.ServiceAddr.IPAddress)
+	if net.ParseIP(si.ServiceAddr.IPAddress) != nil {
+		target = name
+	}
+
+	return &dns.SRV{
+		Hdr:      s.header(name, dns.TypeSRV),
+		Priority: 10,
+		Weight:   10,
+		Port:     uint16(si.ServiceAddr.Port),
+		Target:   target,
+	}
+}
+
+func (s *Server) txt(name string, si skynet.ServiceInfo) dns.RR {
+	b, _ := json.Marshal(si)
+
+	return &dns.TXT{
+		Hdr: s.header(name, dns.TypeTXT),
+		Txt: txtStrings(b),
+	}
+}
+
+func (s *Server) address(name string, si skynet.ServiceInfo) dns.RR {
+	ip := net.ParseIP(si.ServiceAddr.IPAddress)
+
+	if ip == nil {
+		return nil
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return &dns.A{Hdr: s.header(name, dns.TypeA), A: ip4}
+	}
+
+	return &dns.AAAA{Hdr: s.header(name, dns.TypeAAAA), AAAA: ip}
+}
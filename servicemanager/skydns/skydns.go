@@ -0,0 +1,481 @@
+/*
+Package skydns provides a read only skynet.ServiceManager that discovers instances
+from DNS, as served by SkyDNS or any DNS server publishing records in the same scheme.
+
+Every instance is published under a name derived from its ServiceInfo:
+
+	<uuid>.<region>.<version>.<service>.<domain>
+
+with an SRV record giving the address of the instance, and a TXT record holding the
+ServiceInfo encoded as JSON. Labels are lowercased, and any character that isn't valid
+in a DNS label (including the dots in versions) is replaced with a dash. A query for SRV
+records at any name returns the records of every instance beneath it, so a query for the
+domain itself returns every instance.
+
+DNS has no way of announcing changes, so the domain is polled and changes are diffed
+to notify watchers.
+*/
+package skydns
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/miekg/dns"
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/config"
+	"github.com/skynetservices/skynet/log"
+	"github.com/skynetservices/skynet/servicemanager/memory"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPollInterval is how often the domain is queried for changes.
+	DefaultPollInterval = 5 * time.Second
+	// DefaultTimeout is how long to wait for the DNS server to respond.
+	DefaultTimeout = 2 * time.Second
+	// DefaultDomain is the domain instances are published under.
+	DefaultDomain = "skydns.local"
+
+	// the largest response we're willing to receive over UDP before falling back to TCP
+	udpBufferSize = 4096
+)
+
+var (
+	ReadOnly = skynet.ReadOnly
+)
+
+// Config controls where and how often instances are resolved
+type Config struct {
+	// Server is the address of the DNS server to query.
+	Server string
+	// Domain is the domain instances are published under.
+	Domain string
+
+	PollInterval time.Duration
+	Timeout      time.Duration
+}
+
+/*
+skydns.DefaultConfig() returns the default configuration, using the dns.server and
+dns.domain keys from the skynet config if they are provided
+*/
+func DefaultConfig() Config {
+	c := Config{
+		Server:       "127.0.0.1:53",
+		Domain:       DefaultDomain,
+		PollInterval: DefaultPollInterval,
+		Timeout:      DefaultTimeout,
+	}
+
+	if s, err := config.RawStringDefault("dns.server"); err == nil && s != "" {
+		c.Server = s
+	}
+
+	if d, err := config.RawStringDefault("dns.domain"); err == nil && d != "" {
+		c.Domain = d
+	}
+
+	return c
+}
+
+/*
+skydns.Name() returns the name an instance is published under within domain
+*/
+func Name(s skynet.ServiceInfo, domain string) string {
+	labels := []string{
+		label(s.UUID),
+		label(s.Region),
+		label(s.Version),
+		label(s.Name),
+	}
+
+	return strings.Join(labels, ".") + "." + dns.Fqdn(strings.ToLower(domain))
+}
+
+func label(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	b := []byte(strings.ToLower(s))
+
+	for i, c := range b {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			b[i] = '-'
+		}
+	}
+
+	return string(b)
+}
+
+/*
+skydns.ServiceManager resolves instances from DNS. Only the read side of
+skynet.ServiceManager is supported, modifications return ReadOnly.
+*/
+type ServiceManager struct {
+	config Config
+	domain string
+	client *dns.Client
+
+	// the instances published as of the last poll, queries are answered from it
+	view      *memory.ServiceManager
+	syncMutex sync.Mutex
+
+	shutdownChan chan bool
+	shutdownOnce sync.Once
+}
+
+/*
+skydns.New() returns a ServiceManager that has resolved the instances in the configured
+domain, and will continue to poll for changes until Shutdown() is called
+*/
+func New(c Config) (sm *ServiceManager, err error) {
+	if c.Domain == "" {
+		c.Domain = DefaultDomain
+	}
+
+	if c.PollInterval <= 0 {
+		c.PollInterval = DefaultPollInterval
+	}
+
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+
+	sm = &ServiceManager{
+		config:       c,
+		domain:       dns.Fqdn(strings.ToLower(c.Domain)),
+		client:       &dns.Client{Timeout: c.Timeout},
+		view:         memory.New(),
+		shutdownChan: make(chan bool),
+	}
+
+	if err = sm.sync(); err != nil {
+		return nil, err
+	}
+
+	go sm.poll()
+
+	return
+}
+
+func (sm *ServiceManager) Add(s skynet.ServiceInfo) error {
+	return ReadOnly
+}
+
+func (sm *ServiceManager) Update(s skynet.ServiceInfo) error {
+	return ReadOnly
+}
+
+func (sm *ServiceManager) Remove(s skynet.ServiceInfo) error {
+	return ReadOnly
+}
+
+func (sm *ServiceManager) Register(uuid string) error {
+	return ReadOnly
+}
+
+func (sm *ServiceManager) Unregister(uuid string) error {
+	return ReadOnly
+}
+
+func (sm *ServiceManager) Heartbeat(uuid string, ttl time.Duration) error {
+	return ReadOnly
+}
+
+/*
+ServiceManager.Shutdown() stops polling for changes
+*/
+func (sm *ServiceManager) Shutdown() error {
+	sm.shutdownOnce.Do(func() {
+		close(sm.shutdownChan)
+	})
+
+	return nil
+}
+
+func (sm *ServiceManager) ListHosts(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.view.ListHosts(c)
+}
+
+func (sm *ServiceManager) ListRegions(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.view.ListRegions(c)
+}
+
+func (sm *ServiceManager) ListServices(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.view.ListServices(c)
+}
+
+func (sm *ServiceManager) ListVersions(c skynet.CriteriaMatcher) ([]string, error) {
+	return sm.view.ListVersions(c)
+}
+
+func (sm *ServiceManager) ListInstances(c skynet.CriteriaMatcher) ([]skynet.ServiceInfo, error) {
+	return sm.view.ListInstances(c)
+}
+
+/*
+ServiceManager.Watch() returns all instances that currently match the criteria, and notifies
+c of changes to matching instances seen while polling, until the Subscription is closed
+*/
+func (sm *ServiceManager) Watch(criteria skynet.CriteriaMatcher, c chan<- skynet.InstanceNotification) ([]skynet.ServiceInfo, skynet.Subscription) {
+	return sm.view.Watch(criteria, c)
+}
+
+func (sm *ServiceManager) poll() {
+	ticker := time.NewTicker(sm.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := sm.sync(); err != nil {
+				log.Println(log.ERROR, "Failed to resolve instances", err)
+			}
+		case <-sm.shutdownChan:
+			return
+		}
+	}
+}
+
+// sync brings the view in line with the records currently published
+func (sm *ServiceManager) sync() error {
+	sm.syncMutex.Lock()
+	defer sm.syncMutex.Unlock()
+
+	instances, err := sm.resolve()
+	if err != nil {
+		return err
+	}
+
+	published := make([]skynet.ServiceInfo, 0, len(instances))
+	for _, s := range instances {
+		published = append(published, s)
+	}
+
+	sm.view.Replace(published)
+
+	return nil
+}
+
+// resolve returns every instance published under the domain, by UUID
+func (sm *ServiceManager) resolve() (instances map[string]skynet.ServiceInfo, err error) {
+	r, err := sm.query(sm.domain, dns.TypeSRV)
+	if err != nil {
+		return
+	}
+
+	// servers may include the TXT and address records along with the SRV records to save us asking
+	txt := make(map[string][]string)
+	addrs := make(map[string]string)
+
+	for _, rr := range r.Extra {
+		name := strings.ToLower(rr.Header().Name)
+
+		switch rr := rr.(type) {
+		case *dns.TXT:
+			txt[name] = append(txt[name], rr.Txt...)
+		case *dns.A:
+			addrs[name] = rr.A.String()
+		case *dns.AAAA:
+			addrs[name] = rr.AAAA.String()
+		}
+	}
+
+	instances = make(map[string]skynet.ServiceInfo)
+
+	for _, rr := range r.Answer {
+		srv, ok := rr.(*dns.SRV)
+		if !ok {
+			continue
+		}
+
+		name := strings.ToLower(srv.Hdr.Name)
+
+		t, ok := txt[name]
+		if !ok {
+			if t, err = sm.lookupTXT(name); err != nil {
+				return nil, err
+			}
+		}
+
+		s := sm.instance(name, t)
+
+		// the SRV record is authoritative for where the instance can be reached
+		target := strings.ToLower(srv.Target)
+
+		a, ok := addrs[target]
+		if !ok && dns.IsSubDomain(sm.domain, target) {
+			// names within the domain may only be resolvable through the server we're querying
+			if a, err = sm.lookupAddr(target); err != nil {
+				return nil, err
+			}
+		}
+
+		if a == "" {
+			a = strings.TrimSuffix(srv.Target, ".")
+		}
+
+		s.ServiceAddr.IPAddress = a
+		s.ServiceAddr.Port = int(srv.Port)
+
+		if s.UUID != "" {
+			instances[s.UUID] = s
+		}
+	}
+
+	return
+}
+
+func (sm *ServiceManager) lookupTXT(name string) (txt []string, err error) {
+	r, err := sm.query(name, dns.TypeTXT)
+	if err != nil {
+		return
+	}
+
+	for _, rr := range r.Answer {
+		if t, ok := rr.(*dns.TXT); ok {
+			txt = append(txt, t.Txt...)
+		}
+	}
+
+	return
+}
+
+func (sm *ServiceManager) lookupAddr(name string) (addr string, err error) {
+	r, err := sm.query(name, dns.TypeA)
+	if err != nil {
+		return
+	}
+
+	for _, rr := range r.Answer {
+		if a, ok := rr.(*dns.A); ok {
+			return a.A.String(), nil
+		}
+	}
+
+	if r, err = sm.query(name, dns.TypeAAAA); err != nil {
+		return
+	}
+
+	for _, rr := range r.Answer {
+		if a, ok := rr.(*dns.AAAA); ok {
+			return a.AAAA.String(), nil
+		}
+	}
+
+	return
+}
+
+// instance builds the ServiceInfo published at name, falling back to what can be
+// recovered from the name itself if the TXT record is missing or unreadable
+func (sm *ServiceManager) instance(name string, txt []string) (s skynet.ServiceInfo) {
+	if len(txt) > 0 {
+		if err := json.Unmarshal(txtBytes(txt), &s); err == nil {
+			return
+		}
+
+		log.Println(log.ERROR, "Failed to parse TXT record for", name)
+	}
+
+	labels := dns.SplitDomainName(strings.TrimSuffix(name, "."+sm.domain))
+	if len(labels) != 4 {
+		return skynet.ServiceInfo{}
+	}
+
+	return skynet.ServiceInfo{
+		UUID:       labels[0],
+		Region:     labels[1],
+		Version:    strings.Replace(labels[2], "-", ".", -1),
+		Name:       labels[3],
+		Registered: true,
+	}
+}
+
+func (sm *ServiceManager) query(name string, qtype uint16) (r *dns.Msg, err error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.SetEdns0(udpBufferSize, false)
+
+	r, _, err = sm.client.Exchange(m, sm.config.Server)
+	if err != nil {
+		return
+	}
+
+	if r.Truncated {
+		c := &dns.Client{Net: "tcp", Timeout: sm.config.Timeout}
+
+		if r, _, err = c.Exchange(m, sm.config.Server); err != nil {
+			return
+		}
+	}
+
+	switch r.Rcode {
+	case dns.RcodeSuccess:
+	case dns.RcodeNameError:
+		// nothing is published under this name, which isn't an error
+		r.Answer = nil
+	default:
+		err = fmt.Errorf("DNS query for %s failed: %s", name, dns.RcodeToString[r.Rcode])
+	}
+
+	return
+}
+
+// txtStrings splits b into the strings of a TXT record
+func txtStrings(b []byte) (txt []string) {
+	for len(b) > 0 {
+		n := len(b)
+		if n > 255 {
+			n = 255
+		}
+
+		txt = append(txt, escape(b[:n]))
+		b = b[n:]
+	}
+
+	return
+}
+
+// txtBytes joins the strings of a TXT record
+func txtBytes(txt []string) (b []byte) {
+	for _, t := range txt {
+		b = append(b, unescape(t)...)
+	}
+
+	return
+}
+
+// the dns package holds TXT strings in presentation format, where quotes and backslashes are escaped
+func escape(b []byte) string {
+	s := strings.Replace(string(b), `\`, `\\`, -1)
+	return strings.Replace(s, `"`, `\"`, -1)
+}
+
+func unescape(s string) string {
+	b := make([]byte, 0, len(s))
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b = append(b, s[i])
+			continue
+		}
+
+		// \DDD is a decimal byte value, anything else is taken literally
+		if i+3 < len(s) && isDigit(s[i+1]) && isDigit(s[i+2]) && isDigit(s[i+3]) {
+			b = append(b, (s[i+1]-'0')*100+(s[i+2]-'0')*10+(s[i+3]-'0'))
+			i += 3
+		} else {
+			b = append(b, s[i+1])
+			i++
+		}
+	}
+
+	return string(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,153 @@
+package skydns
+
+import (
+	"fmt"
+	"github.com/skynetservices/skynet"
+	"github.com/skynetservices/skynet/test"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestName(t *testing.T) {
+	s := serviceInfo("1a2b", "Tampa")
+	s.Name = "Test_Service"
+
+	if n := Name(s, "SkyDNS.local"); n != "1a2b.tampa.1-0-0.test-service.skydns.local." {
+		t.Fatal("Name() returned incorrect name", n)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	server := newServer(t)
+	defer server.Close()
+
+	// quotes and backslashes need escaping in TXT records
+	s := serviceInfo("1", `"Tampa\Bay"`)
+	server.Add(s)
+	server.Add(serviceInfo("2", "Chicago"))
+
+	sm := newServiceManager(t, server)
+	defer sm.Shutdown()
+
+	instances, _ := sm.ListInstances(&skynet.Criteria{Regions: []string{s.Region}})
+	if len(instances) != 1 || !reflect.DeepEqual(instances[0], s) {
+		t.Fatal("ListInstances() did not return published instance", instances)
+	}
+
+	regions, _ := sm.ListRegions(&skynet.Criteria{})
+	if len(regions) != 2 {
+		t.Fatal("ListRegions() returned incorrect regions", regions)
+	}
+}
+
+func TestResolveWithoutExtra(t *testing.T) {
+	server := newServer(t)
+	defer server.Close()
+
+	server.OmitExtra = true
+
+	s := serviceInfo("1", "Tampa")
+	server.Add(s)
+
+	sm := newServiceManager(t, server)
+	defer sm.Shutdown()
+
+	instances, _ := sm.ListInstances(&skynet.Criteria{})
+	if len(instances) != 1 || !reflect.DeepEqual(instances[0], s) {
+		t.Fatal("ListInstances() did not look up TXT record", instances)
+	}
+}
+
+func TestResolveTruncated(t *testing.T) {
+	server := newServer(t)
+	defer server.Close()
+
+	for i := 0; i < 100; i++ {
+		server.Add(serviceInfo(fmt.Sprintf("%d", i), "Tampa"))
+	}
+
+	sm := newServiceManager(t, server)
+	defer sm.Shutdown()
+
+	instances, _ := sm.ListInstances(&skynet.Criteria{})
+	if len(instances) != 100 {
+		t.Fatal("ListInstances() did not return all instances", len(instances))
+	}
+}
+
+func TestWatch(t *testing.T) {
+	server := newServer(t)
+	defer server.Close()
+
+	sm := newServiceManager(t, server)
+	defer sm.Shutdown()
+
+	c := make(chan skynet.InstanceNotification, 10)
+	sm.Watch(&skynet.Criteria{}, c)
+
+	s := serviceInfo("1", "Tampa")
+	server.Add(s)
+	test.ExpectNotification(t, c, skynet.InstanceAdded, s.UUID)
+
+	s.Registered = false
+	server.Add(s)
+	test.ExpectNotification(t, c, skynet.InstanceUpdated, s.UUID)
+
+	server.Remove(s.UUID)
+	test.ExpectNotification(t, c, skynet.InstanceRemoved, s.UUID)
+}
+
+func TestReadOnly(t *testing.T) {
+	server := newServer(t)
+	defer server.Close()
+
+	sm := newServiceManager(t, server)
+	defer sm.Shutdown()
+
+	if err := sm.Add(serviceInfo("1", "Tampa")); err != ReadOnly {
+		t.Fatal("Add() should not be supported", err)
+	}
+
+	if err := sm.Register("1"); err != ReadOnly {
+		t.Fatal("Register() should not be supported", err)
+	}
+}
+
+func newServer(t *testing.T) *Server {
+	server := NewServer(DefaultDomain)
+
+	if err := server.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+
+	return server
+}
+
+func newServiceManager(t *testing.T, server *Server) *ServiceManager {
+	sm, err := New(Config{
+		Server:       server.Addr(),
+		Domain:       DefaultDomain,
+		PollInterval: 10 * time.Millisecond,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sm
+}
+
+func serviceInfo(uuid, region string) skynet.ServiceInfo {
+	return skynet.ServiceInfo{
+		UUID:       uuid,
+		Name:       "TestService",
+		Version:    "1.0.0",
+		Region:     region,
+		Registered: true,
+		ServiceAddr: skynet.BindAddr{
+			IPAddress: "127.0.0.1",
+			Port:      9000,
+		},
+	}
+}
@@ -12,6 +12,12 @@ type Reporter interface {
 	MethodCompleted(method string, duration time.Duration, err error)
 }
 
+// CircuitReporter may be implemented by a Reporter to be told when a client's circuit breaker
+// changes state. instance is empty for the breaker of the whole service.
+type CircuitReporter interface {
+	CircuitChanged(service, instance, state string)
+}
+
 func AddReporter(r Reporter) {
 	reporters = append(reporters, r)
 }
@@ -33,3 +39,11 @@ func MethodCompleted(method string, duration time.Duration, err error) {
 		go r.MethodCompleted(method, duration, err)
 	}
 }
+
+func CircuitChanged(service, instance, state string) {
+	for _, r := range reporters {
+		if cr, ok := r.(CircuitReporter); ok {
+			go cr.CircuitChanged(service, instance, state)
+		}
+	}
+}
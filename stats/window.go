@@ -0,0 +1,102 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+stats.Window keeps the most recent durations added to it, so that percentiles of
+recent requests can be estimated without keeping every sample.
+*/
+type Window struct {
+	mutex   sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+/*
+stats.NewWindow() returns a Window of the last size durations
+*/
+func NewWindow(size int) *Window {
+	return &Window{
+		samples: make([]time.Duration, size),
+	}
+}
+
+/*
+Window.Add() adds d to the window, replacing the oldest duration if it is full
+*/
+func (w *Window) Add(d time.Duration) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.samples[w.next] = d
+	w.next++
+
+	if w.next == len(w.samples) {
+		w.next = 0
+		w.full = true
+	}
+}
+
+/*
+Window.Len() returns the number of durations in the window
+*/
+func (w *Window) Len() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.full {
+		return len(w.samples)
+	}
+
+	return w.next
+}
+
+/*
+Window.Percentiles() returns the duration below which each of the percentiles (0-100) of the
+durations in the window fall, or 0 if the window is empty
+*/
+func (w *Window) Percentiles(percentiles ...float64) (durations []time.Duration) {
+	w.mutex.Lock()
+	n := w.next
+	if w.full {
+		n = len(w.samples)
+	}
+
+	sorted := make([]time.Duration, n)
+	copy(sorted, w.samples[:n])
+	w.mutex.Unlock()
+
+	sort.Sort(byDuration(sorted))
+
+	durations = make([]time.Duration, len(percentiles))
+
+	if n == 0 {
+		return
+	}
+
+	for i, p := range percentiles {
+		rank := int(math.Ceil(p/100*float64(n))) - 1
+
+		if rank < 0 {
+			rank = 0
+		} else if rank >= n {
+			rank = n - 1
+		}
+
+		durations[i] = sorted[rank]
+	}
+
+	return
+}
+
+type byDuration []time.Duration
+
+func (d byDuration) Len() int           { return len(d) }
+func (d byDuration) Less(i, j int) bool { return d[i] < d[j] }
+func (d byDuration) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
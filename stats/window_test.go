@@ -0,0 +1,47 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowPercentiles(t *testing.T) {
+	w := NewWindow(100)
+
+	if p := w.Percentiles(50); p[0] != 0 {
+		t.Fatal("Empty window should have no latency", p)
+	}
+
+	// fill the window twice, only the last 100 samples should count
+	for i := 200; i > 0; i-- {
+		w.Add(time.Duration(i) * time.Millisecond)
+	}
+
+	if w.Len() != 100 {
+		t.Fatal("Unexpected window length", w.Len())
+	}
+
+	p := w.Percentiles(50, 90, 99, 100)
+
+	if p[0] != 50*time.Millisecond || p[1] != 90*time.Millisecond || p[2] != 99*time.Millisecond || p[3] != 100*time.Millisecond {
+		t.Fatal("Unexpected percentiles", p)
+	}
+}
+
+func TestWindowPartiallyFilled(t *testing.T) {
+	w := NewWindow(100)
+
+	w.Add(3 * time.Millisecond)
+	w.Add(1 * time.Millisecond)
+	w.Add(2 * time.Millisecond)
+
+	if w.Len() != 3 {
+		t.Fatal("Unexpected window length", w.Len())
+	}
+
+	p := w.Percentiles(0, 50, 99)
+
+	if p[0] != 1*time.Millisecond || p[1] != 2*time.Millisecond || p[2] != 3*time.Millisecond {
+		t.Fatal("Unexpected percentiles", p)
+	}
+}
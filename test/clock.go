@@ -0,0 +1,42 @@
+package test
+
+import (
+	"sync"
+	"time"
+)
+
+/*
+test.Clock is a fake clock for code that reads the time through a func() time.Time, such as
+the now fields replaced in tests. It only moves when advanced, and may be shared between goroutines.
+*/
+type Clock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+/*
+test.NewClock() returns a Clock stopped at the Unix epoch
+*/
+func NewClock() *Clock {
+	return &Clock{now: time.Unix(0, 0)}
+}
+
+/*
+Clock.Now() returns the current time of the clock
+*/
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+/*
+Clock.Advance() moves the clock forward by d
+*/
+func (c *Clock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+}
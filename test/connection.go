@@ -1,6 +1,7 @@
 package test
 
 import (
+	"context"
 	"github.com/skynetservices/skynet"
 	"time"
 )
@@ -14,6 +15,7 @@ type Connection struct {
 
 	SendFunc        func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error)
 	SendTimeoutFunc func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}, timeout time.Duration) (err error)
+	SendContextFunc func(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error)
 }
 
 func (c *Connection) SetIdleTimeout(timeout time.Duration) {
@@ -59,3 +61,11 @@ func (c *Connection) SendTimeout(ri *skynet.RequestInfo, fn string, in interface
 
 	return nil
 }
+
+func (c *Connection) SendContext(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+	if c.SendContextFunc != nil {
+		return c.SendContextFunc(ctx, ri, fn, in, out)
+	}
+
+	return nil
+}
@@ -4,13 +4,15 @@ import (
 	"errors"
 	"github.com/skynetservices/skynet"
 	"github.com/skynetservices/skynet/client/loadbalancer"
+	"time"
 )
 
 type LoadBalancer struct {
 	AddInstanceFunc    func(s skynet.ServiceInfo)
 	UpdateInstanceFunc func(s skynet.ServiceInfo)
 	RemoveInstanceFunc func(s skynet.ServiceInfo)
-	ChooseFunc         func() (skynet.ServiceInfo, error)
+	ChooseFunc         func(ri *skynet.RequestInfo) (skynet.ServiceInfo, error)
+	CompleteFunc       func(s skynet.ServiceInfo, duration time.Duration, err error)
 }
 
 func NewLoadBalancer(instances []skynet.ServiceInfo) (lb loadbalancer.LoadBalancer) {
@@ -35,10 +37,16 @@ func (lb *LoadBalancer) RemoveInstance(s skynet.ServiceInfo) {
 	}
 }
 
-func (lb *LoadBalancer) Choose() (skynet.ServiceInfo, error) {
+func (lb *LoadBalancer) Choose(ri *skynet.RequestInfo) (skynet.ServiceInfo, error) {
 	if lb.ChooseFunc != nil {
-		return lb.ChooseFunc()
+		return lb.ChooseFunc(ri)
 	}
 
 	return skynet.ServiceInfo{}, errors.New("No instances found that match that criteria")
 }
+
+func (lb *LoadBalancer) Complete(s skynet.ServiceInfo, duration time.Duration, err error) {
+	if lb.CompleteFunc != nil {
+		lb.CompleteFunc(s, duration, err)
+	}
+}
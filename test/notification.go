@@ -0,0 +1,24 @@
+package test
+
+import (
+	"github.com/skynetservices/skynet"
+	"testing"
+	"time"
+)
+
+/*
+test.ExpectNotification() fails the test unless the next notification received on c is of type typ for
+the instance uuid, and returns the notification
+*/
+func ExpectNotification(t *testing.T, c chan skynet.InstanceNotification, typ int, uuid string) (n skynet.InstanceNotification) {
+	select {
+	case n = <-c:
+		if n.Type != typ || n.Service.UUID != uuid {
+			t.Fatalf("Expected notification %d for %q, got %d for %q", typ, uuid, n.Type, n.Service.UUID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected notification %d for %q", typ, uuid)
+	}
+
+	return
+}
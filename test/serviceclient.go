@@ -1,6 +1,7 @@
 package test
 
 import (
+	"context"
 	"github.com/skynetservices/skynet"
 	"time"
 )
@@ -14,6 +15,9 @@ type ServiceClient struct {
 	SendFunc     func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error)
 	SendOnceFunc func(ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error)
 
+	SendContextFunc     func(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error)
+	SendOnceContextFunc func(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error)
+
 	NotifyFunc  func(n skynet.InstanceNotification)
 	MatchesFunc func(n skynet.ServiceInfo) bool
 }
@@ -50,6 +54,22 @@ func (sc *ServiceClient) SendOnce(ri *skynet.RequestInfo, fn string, in interfac
 	return
 }
 
+func (sc *ServiceClient) SendContext(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+	if sc.SendContextFunc != nil {
+		return sc.SendContextFunc(ctx, ri, fn, in, out)
+	}
+
+	return
+}
+
+func (sc *ServiceClient) SendOnceContext(ctx context.Context, ri *skynet.RequestInfo, fn string, in interface{}, out interface{}) (err error) {
+	if sc.SendOnceContextFunc != nil {
+		return sc.SendOnceContextFunc(ctx, ri, fn, in, out)
+	}
+
+	return
+}
+
 func (sc *ServiceClient) Close() {
 	if sc.CloseFunc != nil {
 		sc.CloseFunc()
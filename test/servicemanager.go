@@ -2,6 +2,7 @@ package test
 
 import (
 	"github.com/skynetservices/skynet"
+	"time"
 )
 
 type ServiceManager struct {
@@ -10,6 +11,7 @@ type ServiceManager struct {
 	RemoveFunc     func(s skynet.ServiceInfo) error
 	RegisterFunc   func(uuid string) error
 	UnregisterFunc func(uuid string) error
+	HeartbeatFunc  func(uuid string, ttl time.Duration) error
 
 	ShutdownFunc func() error
 
@@ -18,7 +20,7 @@ type ServiceManager struct {
 	ListServicesFunc  func(c skynet.CriteriaMatcher) ([]string, error)
 	ListVersionsFunc  func(c skynet.CriteriaMatcher) ([]string, error)
 	ListInstancesFunc func(c skynet.CriteriaMatcher) ([]skynet.ServiceInfo, error)
-	WatchFunc         func(criteria skynet.CriteriaMatcher, c chan<- skynet.InstanceNotification) []skynet.ServiceInfo
+	WatchFunc         func(criteria skynet.CriteriaMatcher, c chan<- skynet.InstanceNotification) ([]skynet.ServiceInfo, skynet.Subscription)
 }
 
 func (sm *ServiceManager) Add(s skynet.ServiceInfo) error {
@@ -61,6 +63,14 @@ func (sm *ServiceManager) Unregister(uuid string) error {
 	return nil
 }
 
+func (sm *ServiceManager) Heartbeat(uuid string, ttl time.Duration) error {
+	if sm.HeartbeatFunc != nil {
+		return sm.HeartbeatFunc(uuid, ttl)
+	}
+
+	return nil
+}
+
 func (sm *ServiceManager) Shutdown() error {
 	if sm.ShutdownFunc != nil {
 		return sm.ShutdownFunc()
@@ -109,10 +119,12 @@ func (sm *ServiceManager) ListInstances(c skynet.CriteriaMatcher) ([]skynet.Serv
 	return []skynet.ServiceInfo{}, nil
 }
 
-func (sm *ServiceManager) Watch(criteria skynet.CriteriaMatcher, c chan<- skynet.InstanceNotification) (s []skynet.ServiceInfo) {
-	if sm.ListInstancesFunc != nil {
+func (sm *ServiceManager) Watch(criteria skynet.CriteriaMatcher, c chan<- skynet.InstanceNotification) ([]skynet.ServiceInfo, skynet.Subscription) {
+	if sm.WatchFunc != nil {
 		return sm.WatchFunc(criteria, c)
 	}
 
-	return
+	return []skynet.ServiceInfo{}, skynet.SubscriptionFunc(func() error {
+		return nil
+	})
 }
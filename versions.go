@@ -0,0 +1,61 @@
+package skynet
+
+import (
+	"github.com/skynetservices/skynet/semver"
+	"sort"
+)
+
+/*
+skynet.SortVersions() sorts versions in ascending order of semantic version precedence.
+Versions that aren't valid semantic versions sort first, in lexical order.
+*/
+func SortVersions(versions []string) {
+	sort.Sort(byVersion(versions))
+}
+
+/*
+skynet.HighestVersion() returns the version with the highest semantic version precedence,
+or an empty string if versions is empty
+*/
+func HighestVersion(versions []string) string {
+	highest := ""
+
+	for _, v := range versions {
+		if highest == "" || compareVersions(highest, v) < 0 {
+			highest = v
+		}
+	}
+
+	return highest
+}
+
+func compareVersions(a, b string) int {
+	av, aerr := semver.Parse(a)
+	bv, berr := semver.Parse(b)
+
+	switch {
+	case aerr == nil && berr == nil:
+		if c := av.Compare(bv); c != 0 {
+			return c
+		}
+	case aerr == nil:
+		return 1
+	case berr == nil:
+		return -1
+	}
+
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+type byVersion []string
+
+func (v byVersion) Len() int           { return len(v) }
+func (v byVersion) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v byVersion) Less(i, j int) bool { return compareVersions(v[i], v[j]) < 0 }
@@ -0,0 +1,30 @@
+package skynet
+
+import (
+	"testing"
+)
+
+func TestSortVersions(t *testing.T) {
+	versions := []string{"10.0.0", "unknown", "2.0.0", "2.0.0-beta", "1.9.1", "abc"}
+	SortVersions(versions)
+
+	expected := []string{"abc", "unknown", "1.9.1", "2.0.0-beta", "2.0.0", "10.0.0"}
+	for i := range expected {
+		if versions[i] != expected[i] {
+			t.Fatal("SortVersions() returned incorrect order", versions)
+		}
+	}
+
+	if h := HighestVersion(versions); h != "10.0.0" {
+		t.Fatal("HighestVersion() returned incorrect version", h)
+	}
+}
+
+func TestIsRange(t *testing.T) {
+	for v, isRange := range map[string]bool{"": true, "1.0.0": false, "unknown": false, "1.x": true, "^1.0.0": true} {
+		sc := ServiceCriteria{Name: "TestService", Version: v}
+		if sc.IsRange() != isRange {
+			t.Errorf("IsRange() incorrect for %q", v)
+		}
+	}
+}